@@ -1,8 +1,15 @@
 package action
 
 import (
+	"fmt"
+	"net/mail"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/onozaty/maildir-cleaner/collector"
 	"github.com/onozaty/maildir-cleaner/folder"
@@ -32,10 +39,11 @@ func (g *KeepArchiveFolderNameGenerator) BaseName() string {
 
 type YearArchiveFolderNameGenerator struct {
 	ArchiveFolderBaseName string
+	Location              *time.Location // 年の区切りとするタイムゾーン(未指定の場合はUTC)
 }
 
 func (g *YearArchiveFolderNameGenerator) Generate(mail collector.Mail) string {
-	year := mail.Time.UTC().Format("2006")
+	year := archiveTime(mail, g.Location).Format("2006")
 	return g.ArchiveFolderBaseName + "." + year
 }
 
@@ -45,11 +53,13 @@ func (g *YearArchiveFolderNameGenerator) BaseName() string {
 
 type MonthArchiveFolderNameGenerator struct {
 	ArchiveFolderBaseName string
+	Location              *time.Location // 月の区切りとするタイムゾーン(未指定の場合はUTC)
 }
 
 func (g *MonthArchiveFolderNameGenerator) Generate(mail collector.Mail) string {
-	year := mail.Time.UTC().Format("2006")
-	month := mail.Time.UTC().Format("01")
+	mailTime := archiveTime(mail, g.Location)
+	year := mailTime.Format("2006")
+	month := mailTime.Format("01")
 	return g.ArchiveFolderBaseName + "." + year + "." + month
 }
 
@@ -57,39 +67,451 @@ func (g *MonthArchiveFolderNameGenerator) BaseName() string {
 	return g.ArchiveFolderBaseName
 }
 
+type TemplateArchiveFolderNameGenerator struct {
+	ArchiveFolderBaseName string
+	Location              *time.Location // 日付の区切りとするタイムゾーン(未指定の場合はUTC)
+	template              *template.Template
+	useSenderDomain       bool
+}
+
+// テンプレートで参照できる項目
+type archiveFolderTemplateData struct {
+	Base         string
+	Folder       string
+	Year         string
+	Quarter      string
+	Month        string
+	WeekYear     string
+	Week         string
+	Day          string
+	SenderDomain string
+}
+
+func NewTemplateArchiveFolderNameGenerator(archiveFolderBaseName string, templateText string) (*TemplateArchiveFolderNameGenerator, error) {
+
+	tmpl, err := template.New("archive-template").Option("missingkey=error").Parse(templateText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template '%s': %w", templateText, err)
+	}
+
+	g := &TemplateArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: archiveFolderBaseName,
+		template:              tmpl,
+		useSenderDomain:       strings.Contains(templateText, "SenderDomain"), // ヘッダの読み込みは必要な場合のみ
+	}
+
+	// 存在しない項目の参照は実行時のエラーとなるので、ここで確認しておく
+	sample := archiveFolderTemplateData{
+		Base:         archiveFolderBaseName,
+		Folder:       "Folder",
+		Year:         "2000",
+		Quarter:      "1",
+		Month:        "01",
+		WeekYear:     "2000",
+		Week:         "01",
+		Day:          "01",
+		SenderDomain: "example_com",
+	}
+	archiveFolderName, err := g.render(sample)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template '%s': %w", templateText, err)
+	}
+
+	// アーカイブフォルダ配下以外に作成されると、次回以降に再度対象となり、restoreでも見つけられなくなる
+	if !g.underBase(archiveFolderName) {
+		return nil, fmt.Errorf("invalid template '%s': the archive folder name must start with '{{.Base}}'", templateText)
+	}
+
+	return g, nil
+}
+
+func (g *TemplateArchiveFolderNameGenerator) Generate(mail collector.Mail) string {
+
+	mailTime := archiveTime(mail, g.Location)
+	weekYear, week := mailTime.ISOWeek()
+
+	data := archiveFolderTemplateData{
+		Base:     g.ArchiveFolderBaseName,
+		Folder:   mail.FolderName,
+		Year:     mailTime.Format("2006"),
+		Quarter:  strconv.Itoa((int(mailTime.Month())-1)/3 + 1),
+		Month:    mailTime.Format("01"),
+		WeekYear: fmt.Sprintf("%04d", weekYear),
+		Week:     fmt.Sprintf("%02d", week),
+		Day:      mailTime.Format("02"),
+	}
+	if g.useSenderDomain {
+		data.SenderDomain = senderDomain(mail)
+	}
+
+	archiveFolderName, err := g.render(data)
+	if err != nil || archiveFolderName == "" {
+		// エラーは作成時に確認済みなので、基本的には発生しない
+		return g.ArchiveFolderBaseName
+	}
+
+	if !g.underBase(archiveFolderName) {
+		// 条件分岐などで作成時の確認をすり抜けた場合も、アーカイブフォルダ配下に
+		return g.ArchiveFolderBaseName + "." + archiveFolderName
+	}
+	return archiveFolderName
+}
+
+func (g *TemplateArchiveFolderNameGenerator) render(data archiveFolderTemplateData) (string, error) {
+
+	var builder strings.Builder
+	if err := g.template.Execute(&builder, data); err != nil {
+		return "", err
+	}
+
+	// INBOXなどで空になった階層は詰める ("Archived.2024." -> "Archived.2024")
+	folderNames := []string{}
+	for _, name := range strings.Split(builder.String(), ".") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			folderNames = append(folderNames, name)
+		}
+	}
+
+	return strings.Join(folderNames, "."), nil
+}
+
+func (g *TemplateArchiveFolderNameGenerator) underBase(archiveFolderName string) bool {
+	return archiveFolderName == g.ArchiveFolderBaseName ||
+		strings.HasPrefix(archiveFolderName, g.ArchiveFolderBaseName+".")
+}
+
+func (g *TemplateArchiveFolderNameGenerator) BaseName() string {
+	return g.ArchiveFolderBaseName
+}
+
+func archiveTime(mail collector.Mail, location *time.Location) time.Time {
+
+	if location == nil {
+		return mail.Time.UTC()
+	}
+	return mail.Time.In(location)
+}
+
+func senderDomain(mail collector.Mail) string {
+
+	header, err := collector.ReadHeader(mail.FullPath)
+	if err != nil {
+		return ""
+	}
+
+	address, err := mailAddress(header.Get("From"))
+	if err != nil {
+		return ""
+	}
+
+	index := strings.LastIndex(address, "@")
+	if index == -1 {
+		return ""
+	}
+
+	// "."は階層の区切りになってしまうので置き換え
+	return strings.ReplaceAll(strings.ToLower(address[index+1:]), ".", "_")
+}
+
+func mailAddress(from string) (string, error) {
+
+	address, err := mail.ParseAddress(collector.DecodeHeaderValue(from))
+	if err != nil {
+		return "", err
+	}
+	return address.Address, nil
+}
+
 func Archive(rootMailFolderPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator) (*[]collector.Mail, error) {
+
+	// 名前が重複した場合は、新たな名前で移動
+	result, err := ArchiveWithConflictPolicy(rootMailFolderPath, mails, archiveFolderNameGenerator, ConflictRename, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.ArchivedMails, nil
+}
+
+type ArchiveResult struct {
+	SourceMails   *[]collector.Mail     // アーカイブしたメール(移動前) ※スキップしたものは含まない
+	ArchivedMails *[]collector.Mail     // アーカイブ後のメール(SourceMailsと同じ順)
+	Conflicts     []Conflict            // 名前が重複したもの
+	Failures      []collector.MailError // keepGoingで、エラーとなったもの
+}
+
+func ArchiveWithConflictPolicy(rootMailFolderPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy, keepGoing bool, journal *Journal) (*ArchiveResult, error) {
+
+	// 戻せるように元のフォルダを記録しておく
+	return archiveMails(rootMailFolderPath, mails, archiveFolderNameGenerator, onConflict, true, keepGoing, journal)
+}
+
+func archiveMails(rootMailFolderPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy, recordOrigins bool, keepGoing bool, journal *Journal) (*ArchiveResult, error) {
+
+	sourceMails := []collector.Mail{}
 	archivedMails := []collector.Mail{}
+	conflicts := []Conflict{}
+	failures := []collector.MailError{}
+	deltas := quotaDeltas{}
 
 	for _, mail := range *mails {
 		archiveFolderName := archiveFolderNameGenerator.Generate(mail)
-		archivedMail, err := archiveMail(rootMailFolderPath, mail, archiveFolderName)
+		archivedMail, conflict, err := archiveMail(rootMailFolderPath, mail, archiveFolderName, onConflict, recordOrigins, journal)
 		if err != nil {
+			if canKeepGoing(err, keepGoing) {
+				failures = append(failures, newMailError(mail, err))
+				continue
+			}
+			deltas.update() // 途中までアーカイブした分は反映しておく
 			return nil, err
 		}
-		archivedMails = append(archivedMails, *archivedMail)
+
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+		if archivedMail != nil {
+			sourceMails = append(sourceMails, mail)
+			archivedMails = append(archivedMails, *archivedMail)
+
+			// 別のメールボックスへのアーカイブや、重複で削除した場合にクォータが変わる
+			deltas.remove(mail)
+			if conflict == nil || conflict.Resolution != ResolutionDeduplicated {
+				deltas.add(*archivedMail)
+			}
+		}
+	}
+
+	if err := deltas.update(); err != nil {
+		return nil, err
 	}
 
-	return &archivedMails, nil
+	return &ArchiveResult{
+		SourceMails:   &sourceMails,
+		ArchivedMails: &archivedMails,
+		Conflicts:     conflicts,
+		Failures:      failures,
+	}, nil
 }
 
-func archiveMail(rootMailFolderPath string, mail collector.Mail, archiveFolderName string) (*collector.Mail, error) {
+func archiveMail(rootMailFolderPath string, mail collector.Mail, archiveFolderName string, onConflict ConflictPolicy, recordOrigins bool, journal *Journal) (*collector.Mail, *Conflict, error) {
+
+	archiveFolderPath, err := setupFolder(rootMailFolderPath, archiveFolderName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archivedMail := toArchivedMail(mail, archiveFolderPath, archiveFolderName)
 
-	archiveFolderPath, err := folder.Setup(rootMailFolderPath, archiveFolderName)
+	// renameは移動先があると上書きしてしまうので、事前に確認
+	found, err := exists(archivedMail.FullPath)
 	if err != nil {
+		return nil, nil, err
+	}
+
+	// 移動と元のフォルダの記録までを1つの操作としてジャーナルに
+	move := func() error {
+		return journal.record(OperationArchive, mail, archivedMail.FullPath, func() error {
+			if err := moveFile(mail.FullPath, archivedMail.FullPath); err != nil {
+				return err
+			}
+			if recordOrigins {
+				return recordOrigin(*archivedMail, mail.FolderName)
+			}
+			return nil
+		})
+	}
+
+	if !found {
+		if err := move(); err != nil {
+			return nil, nil, err
+		}
+		return archivedMail, nil, nil
+	}
+
+	resolution, err := resolveConflict(mail, archivedMail.FullPath, onConflict)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflict := &Conflict{
+		Mail:         mail,
+		ExistingPath: archivedMail.FullPath,
+		Resolution:   resolution,
+	}
+
+	switch resolution {
+	case ResolutionSkipped:
+		return nil, conflict, nil
+	case ResolutionDeduplicated:
+		// 同じ内容のものが既にアーカイブされているので、移動元を削除するのみ
+		// (既にあるものの元のフォルダは、記録が無い場合のみ記録)
+		err := journal.record(OperationDedupe, mail, archivedMail.FullPath, func() error {
+			if err := os.Remove(mail.FullPath); err != nil {
+				return err
+			}
+			if recordOrigins {
+				return recordOriginIfMissing(*archivedMail, mail.FolderName)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return archivedMail, conflict, nil
+	default:
+		archivedMail.FileName = uniqueFileName(filepath.Dir(archivedMail.FullPath), mail.FileName)
+		archivedMail.FullPath = filepath.Join(filepath.Dir(archivedMail.FullPath), archivedMail.FileName)
+		if err := move(); err != nil {
+			return nil, nil, err
+		}
+		return archivedMail, conflict, nil
+	}
+}
+
+func ArchiveToRoot(archiveRootPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy, keepGoing bool, journal *Journal) (*ArchiveResult, error) {
+
+	// 別のMaildir++にアーカイブ (無ければルートから作成)
+	if err := folder.SetupRoot(archiveRootPath); err != nil {
 		return nil, err
 	}
 
-	archiveMailPath := filepath.Join(archiveFolderPath, mail.SubDirName, mail.FileName)
-	if err := os.Rename(mail.FullPath, archiveMailPath); err != nil {
+	return ArchiveWithConflictPolicy(archiveRootPath, mails, archiveFolderNameGenerator, onConflict, keepGoing, journal)
+}
+
+type ArchivePlan struct {
+	CreateRootPath       string            // 新たに作成されるアーカイブ先のルート
+	ArchivedMails        *[]collector.Mail // アーカイブ後のメール
+	CreateFolderNames    []string          // 新たに作成されるフォルダ
+	SubscribeFolderNames []string          // 新たに購読されるフォルダ
+	Conflicts            []Conflict        // 名前が重複するもの
+}
+
+func PlanArchive(rootMailFolderPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy) (*ArchivePlan, error) {
+
+	return planArchive(rootMailFolderPath, mails, archiveFolderNameGenerator, onConflict, folder.PlanSetup)
+}
+
+func PlanArchiveToRoot(archiveRootPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy) (*ArchivePlan, error) {
+
+	if folder.IsRoot(archiveRootPath) {
+		return PlanArchive(archiveRootPath, mails, archiveFolderNameGenerator, onConflict)
+	}
+
+	// ルートがまだ無いので、全てのフォルダが新たに作成される
+	plan, err := planArchive(archiveRootPath, mails, archiveFolderNameGenerator, onConflict, func(_ string, folderName string) (*folder.SetupPlan, error) {
+		return folder.PlanSetupInNewRoot(folderName), nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &collector.Mail{
-		FullPath:   archiveMailPath,
-		FolderName: archiveFolderName,
-		SubDirName: mail.SubDirName,
-		FileName:   mail.FileName,
-		Size:       mail.Size,
-		Time:       mail.Time,
+	plan.CreateRootPath = archiveRootPath
+	return plan, nil
+}
+
+func planArchive(rootMailFolderPath string, mails *[]collector.Mail, archiveFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy, planSetup func(rootMailFolderPath string, folderName string) (*folder.SetupPlan, error)) (*ArchivePlan, error) {
+
+	// 実際には移動せずに、アーカイブした場合の結果を返す
+	archivedMails := []collector.Mail{}
+	createFolderNames := newUniqueNames()
+	subscribeFolderNames := newUniqueNames()
+	plannedFolderNames := map[string]bool{}
+	plannedPaths := map[string]string{} // 移動先 -> 移動元
+	conflicts := []Conflict{}
+
+	for _, mail := range *mails {
+		archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+		if archiveFolderName != "" && !plannedFolderNames[archiveFolderName] {
+			setupPlan, err := planSetup(rootMailFolderPath, archiveFolderName)
+			if err != nil {
+				return nil, err
+			}
+			createFolderNames.add(setupPlan.CreateFolderNames...)
+			subscribeFolderNames.add(setupPlan.SubscribeFolderNames...)
+			plannedFolderNames[archiveFolderName] = true
+		}
+
+		archiveFolderPath, err := folder.MailFolderPath(rootMailFolderPath, archiveFolderName)
+		if err != nil {
+			return nil, err
+		}
+
+		archivedMail := toArchivedMail(mail, archiveFolderPath, archiveFolderName)
+		archivedMails = append(archivedMails, *archivedMail)
+
+		// 既存のファイルだけでなく、先に移動するメールとの重複も
+		contentPath, planned := plannedPaths[archivedMail.FullPath]
+		if !planned {
+			found, err := exists(archivedMail.FullPath)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				plannedPaths[archivedMail.FullPath] = mail.FullPath
+				continue
+			}
+			contentPath = archivedMail.FullPath
+		}
+
+		resolution := ResolutionFailed
+		if onConflict != ConflictFail {
+			resolution, err = resolveConflict(mail, contentPath, onConflict)
+			if err != nil {
+				return nil, err
+			}
+		}
+		conflicts = append(conflicts, Conflict{
+			Mail:         mail,
+			ExistingPath: archivedMail.FullPath,
+			Resolution:   resolution,
+		})
+	}
+
+	return &ArchivePlan{
+		ArchivedMails:        &archivedMails,
+		CreateFolderNames:    createFolderNames.sorted(),
+		SubscribeFolderNames: subscribeFolderNames.sorted(),
+		Conflicts:            conflicts,
 	}, nil
 }
+
+func setupFolder(rootMailFolderPath string, folderName string) (string, error) {
+
+	if folderName == "" {
+		// INBOX(ルート)は既にあるはずなので作成しない (restoreで元のフォルダがINBOXの場合)
+		return rootMailFolderPath, nil
+	}
+
+	return folder.Setup(rootMailFolderPath, folderName)
+}
+
+func toArchivedMail(mail collector.Mail, archiveFolderPath string, archiveFolderName string) *collector.Mail {
+
+	archivedMail := mail
+	archivedMail.FullPath = filepath.Join(archiveFolderPath, mail.SubDirName, mail.FileName)
+	archivedMail.FolderName = archiveFolderName
+
+	return &archivedMail
+}
+
+type uniqueNames map[string]bool
+
+func newUniqueNames() uniqueNames {
+	return uniqueNames{}
+}
+
+func (u uniqueNames) add(names ...string) {
+	for _, name := range names {
+		u[name] = true
+	}
+}
+
+func (u uniqueNames) sorted() []string {
+	names := []string{}
+	for name := range u {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
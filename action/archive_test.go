@@ -289,6 +289,370 @@ func TestArchive_ArchiveFolderBaseNameMultibyte(t *testing.T) {
 	}
 }
 
+func TestYearArchiveFolderNameGenerator_Location(t *testing.T) {
+
+	// ARRANGE
+	location, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	archiveFolderNameGenerator := &YearArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+		Location:              location,
+	}
+
+	// Asia/Tokyoでは2024/1/1 8:00
+	mail := collector.Mail{
+		Time: time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	assert.Equal(t, "Archived.2024", archiveFolderName)
+}
+
+func TestMonthArchiveFolderNameGenerator_Location(t *testing.T) {
+
+	// ARRANGE
+	location, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	archiveFolderNameGenerator := &MonthArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+		Location:              location,
+	}
+
+	// Asia/Tokyoでは2024/4/1 0:00
+	mail := collector.Mail{
+		Time: time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	assert.Equal(t, "Archived.2024.04", archiveFolderName)
+}
+
+func TestMonthArchiveFolderNameGenerator_NoLocation(t *testing.T) {
+
+	// ARRANGE
+	archiveFolderNameGenerator := &MonthArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	mail := collector.Mail{
+		Time: time.Date(2024, 3, 31, 15, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	// 未指定の場合はUTC
+	assert.Equal(t, "Archived.2024.03", archiveFolderName)
+}
+
+func TestTemplateArchiveFolderNameGenerator(t *testing.T) {
+
+	// ARRANGE
+	archiveFolderNameGenerator, err := NewTemplateArchiveFolderNameGenerator(
+		"Archived",
+		"{{.Base}}.{{.Year}}.Q{{.Quarter}}.{{.Month}}.{{.Day}}.W{{.WeekYear}}-{{.Week}}.{{.Folder}}")
+	require.NoError(t, err)
+
+	mail := collector.Mail{
+		FolderName: "A.B",
+		Time:       time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), // ISO週では2020年の53週
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	assert.Equal(t, "Archived.2021.Q1.01.02.W2020-53.A.B", archiveFolderName)
+	assert.Equal(t, "Archived", archiveFolderNameGenerator.BaseName())
+}
+
+func TestTemplateArchiveFolderNameGenerator_Inbox(t *testing.T) {
+
+	// ARRANGE
+	archiveFolderNameGenerator, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{.Base}}.{{.Year}}.{{.Folder}}")
+	require.NoError(t, err)
+
+	mail := collector.Mail{
+		FolderName: "", // INBOX
+		Time:       time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	// 空になった階層は詰められること
+	assert.Equal(t, "Archived.2024", archiveFolderName)
+}
+
+func TestTemplateArchiveFolderNameGenerator_SenderDomain(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mailPath := filepath.Join(temp, "a")
+	test.CreateFile(t, mailPath, "From: =?UTF-8?B?44OG44K544OI?= <Test@Mail.Example.COM>\r\nSubject: test\r\n\r\nbody\r\n")
+
+	archiveFolderNameGenerator, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{.Base}}.{{.SenderDomain}}")
+	require.NoError(t, err)
+
+	mail := collector.Mail{
+		FullPath:   mailPath,
+		FolderName: "",
+		Time:       time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	// "."は階層とならないように置き換えられること
+	assert.Equal(t, "Archived.mail_example_com", archiveFolderName)
+}
+
+func TestTemplateArchiveFolderNameGenerator_SenderDomainNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mailPath := filepath.Join(temp, "a")
+	test.CreateFile(t, mailPath, "Subject: test\r\n\r\nbody\r\n")
+
+	archiveFolderNameGenerator, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{.Base}}.{{.SenderDomain}}.{{.Year}}")
+	require.NoError(t, err)
+
+	mail := collector.Mail{
+		FullPath:   mailPath,
+		FolderName: "",
+		Time:       time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	assert.Equal(t, "Archived.2024", archiveFolderName)
+}
+
+func TestNewTemplateArchiveFolderNameGenerator_UnknownField(t *testing.T) {
+
+	// ACT
+	_, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{.Base}}.{{.Hour}}")
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid template '{{.Base}}.{{.Hour}}'")
+}
+
+func TestTemplateArchiveFolderNameGenerator_OutsideBase(t *testing.T) {
+
+	// ARRANGE
+	// INBOXの場合だけアーカイブフォルダ以外になるテンプレート
+	archiveFolderNameGenerator, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{if .Folder}}{{.Base}}.{{.Folder}}{{else}}Inbox.{{.Year}}{{end}}")
+	require.NoError(t, err)
+
+	mail := collector.Mail{
+		FolderName: "", // INBOX
+		Time:       time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// ACT
+	archiveFolderName := archiveFolderNameGenerator.Generate(mail)
+
+	// ASSERT
+	// アーカイブフォルダ配下になること
+	assert.Equal(t, "Archived.Inbox.2024", archiveFolderName)
+}
+
+func TestNewTemplateArchiveFolderNameGenerator_NotStartWithBase(t *testing.T) {
+
+	testCases := []string{
+		"{{.Year}}.{{.Folder}}",
+		"{{.Folder}}.{{.Base}}",
+		"{{.Base}}{{.Year}}",
+	}
+
+	for _, templateText := range testCases {
+
+		// ACT
+		_, err := NewTemplateArchiveFolderNameGenerator("Archived", templateText)
+
+		// ASSERT
+		assert.EqualError(t, err, "invalid template '"+templateText+"': the archive folder name must start with '{{.Base}}'")
+	}
+}
+
+func TestNewTemplateArchiveFolderNameGenerator_InvalidSyntax(t *testing.T) {
+
+	// ACT
+	_, err := NewTemplateArchiveFolderNameGenerator("Archived", "{{.Base")
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid template '{{.Base'")
+}
+
+func TestPlanArchive(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "new", 2020, 1),
+		createMailByYearMonth(t, temp, "A", "cur", 2021, 12),
+	}
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\nArchived\n")
+
+	archiveFolderNameGenerator := &MonthArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	plan, err := PlanArchive(temp, &targetMails, archiveFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Archived", "Archived.2020", "Archived.2020.01", "Archived.2021", "Archived.2021.12"}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"Archived.2020", "Archived.2020.01", "Archived.2021", "Archived.2021.12"}, plan.SubscribeFolderNames)
+
+	expectedArchivedMails := []collector.Mail{
+		{
+			FullPath:   filepath.Join(temp, ".Archived.2020.01", "new", targetMails[0].FileName),
+			FolderName: "Archived.2020.01",
+			SubDirName: "new",
+			FileName:   targetMails[0].FileName,
+			Size:       targetMails[0].Size,
+			Time:       targetMails[0].Time,
+		},
+		{
+			FullPath:   filepath.Join(temp, ".Archived.2021.12", "cur", targetMails[1].FileName),
+			FolderName: "Archived.2021.12",
+			SubDirName: "cur",
+			FileName:   targetMails[1].FileName,
+			Size:       targetMails[1].Size,
+			Time:       targetMails[1].Time,
+		},
+	}
+	assert.Equal(t, &expectedArchivedMails, plan.ArchivedMails)
+	assert.Empty(t, plan.Conflicts)
+
+	// 実際には移動されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	assert.NoDirExists(t, filepath.Join(temp, ".Archived.2020"))
+	assert.Equal(t, "A\nArchived\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestArchiveToRoot(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	archiveRootPath := filepath.Join(temp, "archive", "Maildir") // 存在しないフォルダ
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "", "new", 2020, 1),
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2021, 12),
+	}
+
+	archiveFolderNameGenerator := &YearArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	result, err := ArchiveToRoot(archiveRootPath, &targetMails, archiveFolderNameGenerator, ConflictRename, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expectedPaths := []string{
+		filepath.Join(archiveRootPath, ".Archived.2020", "new", targetMails[0].FileName),
+		filepath.Join(archiveRootPath, ".Archived.2021", "cur", targetMails[1].FileName),
+	}
+	for i, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+		assert.FileExists(t, expectedPaths[i])
+		assert.Equal(t, expectedPaths[i], (*result.ArchivedMails)[i].FullPath)
+	}
+
+	assert.Equal(t, "Archived\nArchived.2020\nArchived.2021\n", test.ReadFile(t, filepath.Join(archiveRootPath, "subscriptions")))
+}
+
+func TestPlanArchiveToRoot_NotExists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	archiveRootPath := filepath.Join(temp, "archive") // 存在しないフォルダ
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2021, 12),
+	}
+
+	archiveFolderNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	plan, err := PlanArchiveToRoot(archiveRootPath, &targetMails, archiveFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, archiveRootPath, plan.CreateRootPath)
+	assert.Equal(t, []string{"Archived", "Archived.A"}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"Archived", "Archived.A"}, plan.SubscribeFolderNames)
+	assert.Equal(t, filepath.Join(archiveRootPath, ".Archived.A", "cur", targetMails[0].FileName), (*plan.ArchivedMails)[0].FullPath)
+
+	// 実際には作成されていないこと
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.NoDirExists(t, archiveRootPath)
+}
+
+func TestPlanArchiveToRoot_Exists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	archiveRootPath := test.CreateDir(t, temp, "archive")
+	test.CreateFile(t, filepath.Join(archiveRootPath, "subscriptions"), "Archived\n")
+	test.CreateMailFolder(t, archiveRootPath, ".Archived")
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2021, 12),
+	}
+
+	archiveFolderNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	plan, err := PlanArchiveToRoot(archiveRootPath, &targetMails, archiveFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, "", plan.CreateRootPath)
+	assert.Equal(t, []string{"Archived.A"}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"Archived.A"}, plan.SubscribeFolderNames)
+}
+
 func TestArchive_MailNotFound(t *testing.T) {
 
 	// ARRANGE
@@ -0,0 +1,165 @@
+package action
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+)
+
+// 移動先に同じ名前のファイルが既に存在した場合の対処
+type ConflictPolicy string
+
+const (
+	ConflictSkip   ConflictPolicy = "skip"   // 移動しない
+	ConflictRename ConflictPolicy = "rename" // 新たな名前で移動
+	ConflictFail   ConflictPolicy = "fail"   // エラーとする
+	ConflictDedupe ConflictPolicy = "dedupe" // 内容が同じならば移動元を削除、異なれば新たな名前で移動
+)
+
+const (
+	ResolutionSkipped      = "skipped"
+	ResolutionRenamed      = "renamed"
+	ResolutionDeduplicated = "deduplicated"
+	ResolutionFailed       = "failed" // dry-runの場合のみ(実際にはエラーとなる)
+)
+
+type Conflict struct {
+	Mail         collector.Mail // 移動しようとしたメール
+	ExistingPath string         // 既に存在していたファイル
+	Resolution   string
+}
+
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+
+	switch policy := ConflictPolicy(value); policy {
+	case ConflictSkip, ConflictRename, ConflictFail, ConflictDedupe:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid on-conflict '%s'", value)
+	}
+}
+
+func resolveConflict(mail collector.Mail, existingPath string, onConflict ConflictPolicy) (string, error) {
+
+	switch onConflict {
+	case ConflictSkip:
+		return ResolutionSkipped, nil
+	case ConflictRename:
+		return ResolutionRenamed, nil
+	case ConflictDedupe:
+		same, err := sameContent(mail.FullPath, existingPath)
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return ResolutionDeduplicated, nil
+		}
+		return ResolutionRenamed, nil
+	default:
+		return "", fmt.Errorf("%s already exists", existingPath)
+	}
+}
+
+func sameContent(path1 string, path2 string) (bool, error) {
+
+	info1, err := os.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	info2, err := os.Stat(path2)
+	if err != nil {
+		return false, err
+	}
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+
+	hash1, err := fileHash(path1)
+	if err != nil {
+		return false, err
+	}
+	hash2, err := fileHash(path2)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(hash1, hash2), nil
+}
+
+func fileHash(path string) ([]byte, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+var uniqueFileNameCounter uint64
+
+// フォルダ内で重複しないMaildir形式のファイル名を生成
+func uniqueFileName(dirPath string, fileName string) string {
+
+	// 時刻(先頭)と、サイズなどの付加情報(",S=545"など)、フラグ(":2,"以降)は元のファイル名から引き継ぐ
+	base := fileName
+	info := ""
+	if index := strings.LastIndex(fileName, ":2,"); index != -1 {
+		base = fileName[:index]
+		info = fileName[index:]
+	}
+
+	timePart := base
+	if index := strings.Index(base, "."); index != -1 {
+		timePart = base[:index]
+	}
+
+	attributes := ""
+	if index := strings.Index(base, ","); index != -1 {
+		attributes = base[index:]
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	// Maildirの仕様に従い、"/"と":"はエスケープ
+	hostname = strings.ReplaceAll(hostname, "/", `\057`)
+	hostname = strings.ReplaceAll(hostname, ":", `\072`)
+
+	for {
+		counter := atomic.AddUint64(&uniqueFileNameCounter, 1)
+		now := time.Now()
+		name := fmt.Sprintf("%s.M%dP%dQ%d.%s%s%s", timePart, now.Nanosecond()/1000, os.Getpid(), counter, hostname, attributes, info)
+
+		if _, err := os.Lstat(filepath.Join(dirPath, name)); os.IsNotExist(err) {
+			return name
+		}
+	}
+}
+
+func exists(path string) (bool, error) {
+
+	_, err := os.Lstat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
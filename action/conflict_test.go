@@ -0,0 +1,335 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveWithConflictPolicy_Skip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a:2,S"), // 重複
+		createMailByName(t, temp, "", "cur", "b:2,S"),
+	}
+	existingPath := filepath.Join(archiveFolderPath, "cur", "a:2,S")
+	test.CreateFile(t, existingPath, "existing")
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictSkip, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 重複したものは移動しない
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.Equal(t, "existing", test.ReadFile(t, existingPath))
+	assert.NoFileExists(t, targetMails[1].FullPath)
+	assert.FileExists(t, filepath.Join(archiveFolderPath, "cur", "b:2,S"))
+
+	assert.Equal(t, []collector.Mail{targetMails[1]}, *result.SourceMails)
+	assert.Len(t, *result.ArchivedMails, 1)
+	assert.Equal(t, []Conflict{
+		{
+			Mail:         targetMails[0],
+			ExistingPath: existingPath,
+			Resolution:   ResolutionSkipped,
+		},
+	}, result.Conflicts)
+}
+
+func TestArchiveWithConflictPolicy_Rename(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "1674617693.M1P2.host,S=1:2,S"),
+	}
+	existingPath := filepath.Join(archiveFolderPath, "cur", targetMails[0].FileName)
+	test.CreateFile(t, existingPath, "existing")
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictRename, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 既存のものは上書きされず、別の名前で移動
+	assert.Equal(t, "existing", test.ReadFile(t, existingPath))
+	assert.NoFileExists(t, targetMails[0].FullPath)
+
+	archivedMail := (*result.ArchivedMails)[0]
+	assert.NotEqual(t, existingPath, archivedMail.FullPath)
+	assert.Equal(t, filepath.Join(archiveFolderPath, "cur", archivedMail.FileName), archivedMail.FullPath)
+	assert.FileExists(t, archivedMail.FullPath)
+	// 時刻とサイズ、フラグは引き継がれること
+	assert.Regexp(t, regexp.MustCompile(`^1674617693\.M\d+P\d+Q\d+\..+,S=1:2,S$`), archivedMail.FileName)
+
+	assert.Equal(t, []Conflict{
+		{
+			Mail:         targetMails[0],
+			ExistingPath: existingPath,
+			Resolution:   ResolutionRenamed,
+		},
+	}, result.Conflicts)
+}
+
+func TestArchiveWithConflictPolicy_Fail(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a:2,S"),
+	}
+	existingPath := filepath.Join(archiveFolderPath, "cur", "a:2,S")
+	test.CreateFile(t, existingPath, "existing")
+
+	// ACT
+	_, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictFail, false, nil)
+
+	// ASSERT
+	require.EqualError(t, err, existingPath+" already exists")
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.Equal(t, "existing", test.ReadFile(t, existingPath))
+}
+
+func TestArchiveWithConflictPolicy_Dedupe(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a:2,S"), // 同じ内容
+		createMailByName(t, temp, "", "cur", "b:2,S"), // 異なる内容
+	}
+	test.CreateFile(t, targetMails[0].FullPath, "same")
+	test.CreateFile(t, targetMails[1].FullPath, "new")
+
+	existingPath1 := filepath.Join(archiveFolderPath, "cur", "a:2,S")
+	test.CreateFile(t, existingPath1, "same")
+	existingPath2 := filepath.Join(archiveFolderPath, "cur", "b:2,S")
+	test.CreateFile(t, existingPath2, "old")
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictDedupe, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 同じ内容のものは移動元を削除
+	assert.NoFileExists(t, targetMails[0].FullPath)
+	assert.Equal(t, existingPath1, (*result.ArchivedMails)[0].FullPath)
+
+	// 異なる内容のものは別の名前で移動
+	assert.NoFileExists(t, targetMails[1].FullPath)
+	assert.Equal(t, "old", test.ReadFile(t, existingPath2))
+	assert.NotEqual(t, existingPath2, (*result.ArchivedMails)[1].FullPath)
+	assert.Equal(t, "new", test.ReadFile(t, (*result.ArchivedMails)[1].FullPath))
+
+	assert.Equal(t, []Conflict{
+		{
+			Mail:         targetMails[0],
+			ExistingPath: existingPath1,
+			Resolution:   ResolutionDeduplicated,
+		},
+		{
+			Mail:         targetMails[1],
+			ExistingPath: existingPath2,
+			Resolution:   ResolutionRenamed,
+		},
+	}, result.Conflicts)
+}
+
+func TestPlanArchive_Conflicts(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	setupConflictArchive(t, temp)
+
+	// 年のフォルダに、同じ名前のメールが移動される
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "A", "cur", 2021, 1),
+		createMailByYearMonth(t, temp, "B", "cur", 2021, 1),
+	}
+	test.CreateFile(t, targetMails[0].FullPath, "b1")
+	test.CreateFile(t, targetMails[1].FullPath, "b2")
+
+	generator := &YearArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"}
+
+	// ACT
+	plan, err := PlanArchive(temp, &targetMails, generator, ConflictDedupe)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 先に移動するメールと内容が異なるので別の名前で
+	assert.Equal(t, []Conflict{
+		{
+			Mail:         targetMails[1],
+			ExistingPath: filepath.Join(temp, ".Archived.2021", "cur", targetMails[1].FileName),
+			Resolution:   ResolutionRenamed,
+		},
+	}, plan.Conflicts)
+
+	// 実際には移動されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestPlanArchive_ConflictsWithExisting(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a:2,S"),
+	}
+	existingPath := filepath.Join(archiveFolderPath, "cur", "a:2,S")
+	test.CreateFile(t, existingPath, "existing")
+
+	// ACT
+	plan, err := PlanArchive(temp, &targetMails, archiveFolderNameGenerator(), ConflictFail)
+
+	// ASSERT
+	require.NoError(t, err) // dry-runではエラーとせずに結果として返す
+
+	assert.Equal(t, []Conflict{
+		{
+			Mail:         targetMails[0],
+			ExistingPath: existingPath,
+			Resolution:   ResolutionFailed,
+		},
+	}, plan.Conflicts)
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+
+	for _, value := range []string{"skip", "rename", "fail", "dedupe"} {
+		// ACT
+		policy, err := ParseConflictPolicy(value)
+
+		// ASSERT
+		require.NoError(t, err)
+		assert.Equal(t, ConflictPolicy(value), policy)
+	}
+}
+
+func TestParseConflictPolicy_Invalid(t *testing.T) {
+
+	// ACT
+	_, err := ParseConflictPolicy("overwrite")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid on-conflict 'overwrite'")
+}
+
+func TestUniqueFileName(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	hostname, _ := os.Hostname()
+
+	// ACT
+	name1 := uniqueFileName(temp, "1674617693.M958571P8888.localhost,S=545,W=562:2,FS")
+	name2 := uniqueFileName(temp, "1674617693.M958571P8888.localhost,S=545,W=562:2,FS")
+
+	// ASSERT
+	assert.Regexp(t, regexp.MustCompile(`^1674617693\.M\d+P\d+Q\d+\.`+regexp.QuoteMeta(hostname)+`,S=545,W=562:2,FS$`), name1)
+	assert.NotEqual(t, name1, name2)
+}
+
+func TestUniqueFileName_NoInfo(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	name := uniqueFileName(temp, "abc")
+
+	// ASSERT
+	assert.Regexp(t, regexp.MustCompile(`^abc\.M\d+P\d+Q\d+\.[^:,]+$`), name)
+}
+
+func TestArchiveWithConflictPolicy_DedupeKeepsOrigin(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	fixedFolderNameGenerator := &FixedFolderNameGenerator{FolderName: "Archived"}
+
+	// 元のフォルダが記録されるようにアーカイブしておく
+	archivedMail := createMailByName(t, temp, "A", "cur", "a")
+	_, err := ArchiveWithConflictPolicy(temp, &[]collector.Mail{archivedMail}, fixedFolderNameGenerator, ConflictRename, false, nil)
+	require.NoError(t, err)
+
+	// 別のフォルダにある同じ内容のもの
+	targetMail := createMailByName(t, temp, "B", "cur", "a")
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &[]collector.Mail{targetMail}, fixedFolderNameGenerator, ConflictDedupe, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, ResolutionDeduplicated, result.Conflicts[0].Resolution)
+
+	// 既にあるものの元のフォルダは上書きされないこと
+	origins, err := readOrigins(filepath.Join(temp, ".Archived"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "A"}, origins)
+}
+
+func TestArchiveWithConflictPolicy_DedupeNotRecorded(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	archiveFolderPath := setupConflictArchive(t, temp)
+
+	// 元のフォルダが記録される前にアーカイブされたもの
+	test.CreateFile(t, filepath.Join(archiveFolderPath, "cur", "a"), "same")
+
+	targetMail := createMailByName(t, temp, "B", "cur", "a")
+	test.CreateFile(t, targetMail.FullPath, "same")
+
+	// ACT
+	_, err := ArchiveWithConflictPolicy(temp, &[]collector.Mail{targetMail}, &FixedFolderNameGenerator{FolderName: "Archived"}, ConflictDedupe, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 記録が無い場合は記録されること
+	origins, err := readOrigins(archiveFolderPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "B"}, origins)
+}
+
+func setupConflictArchive(t *testing.T, root string) string {
+
+	subscriptionsPath := filepath.Join(root, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Archived\n")
+
+	return test.CreateMailFolder(t, root, ".Archived")
+}
+
+func archiveFolderNameGenerator() ArchiveFolderNameGenerator {
+	return &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+}
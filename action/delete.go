@@ -6,12 +6,26 @@ import (
 	"github.com/onozaty/maildir-cleaner/collector"
 )
 
-func Delete(rootMailFolderPath string, mails *[]collector.Mail) error {
+// keepGoingの場合は、エラーとなったものを返す
+func Delete(rootMailFolderPath string, mails *[]collector.Mail, keepGoing bool, journal *Journal) ([]collector.MailError, error) {
+
+	failures := []collector.MailError{}
+	deltas := quotaDeltas{}
+
 	for _, mail := range *mails {
-		if err := os.Remove(mail.FullPath); err != nil {
-			return err
+		err := journal.record(OperationDelete, mail, "", func() error {
+			return os.Remove(mail.FullPath)
+		})
+		if err != nil {
+			if canKeepGoing(err, keepGoing) {
+				failures = append(failures, newMailError(mail, err))
+				continue
+			}
+			deltas.update() // 途中まで削除した分は反映しておく
+			return nil, err
 		}
+		deltas.remove(mail)
 	}
 
-	return nil
+	return failures, deltas.update()
 }
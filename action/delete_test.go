@@ -32,7 +32,7 @@ func TestDelete(t *testing.T) {
 	}
 
 	// ACT
-	err := Delete(temp, &targetMails)
+	_, err := Delete(temp, &targetMails, false, nil)
 
 	// ASSERT
 	require.NoError(t, err)
@@ -67,7 +67,7 @@ func TestDelete_NotFound(t *testing.T) {
 	}
 
 	// ACT
-	err := Delete(temp, &targetMails)
+	_, err := Delete(temp, &targetMails, false, nil)
 
 	// ASSERT
 	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package action
+
+import (
+	"os"
+	"syscall"
+)
+
+func sameDevice(path1 string, path2 string) (bool, error) {
+
+	// シンボリックリンクの場合はリンク先で判断
+	stat1, err := os.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	stat2, err := os.Stat(path2)
+	if err != nil {
+		return false, err
+	}
+
+	sysStat1, ok1 := stat1.Sys().(*syscall.Stat_t)
+	sysStat2, ok2 := stat2.Sys().(*syscall.Stat_t)
+	if !ok1 || !ok2 {
+		// 判断できない場合はrenameを試す
+		return true, nil
+	}
+
+	return sysStat1.Dev == sysStat2.Dev, nil
+}
+
+func syncDir(path string) error {
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package action
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+func sameDevice(path1 string, path2 string) (bool, error) {
+
+	absPath1, err := filepath.Abs(path1)
+	if err != nil {
+		return false, err
+	}
+	absPath2, err := filepath.Abs(path2)
+	if err != nil {
+		return false, err
+	}
+
+	// ドライブが異なる場合はrenameできない
+	return strings.EqualFold(filepath.VolumeName(absPath1), filepath.VolumeName(absPath2)), nil
+}
+
+func syncDir(path string) error {
+
+	// Windowsではフォルダを同期できない
+	return nil
+}
@@ -0,0 +1,478 @@
+package action
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/folder"
+)
+
+type ExportFormat string
+
+const (
+	ExportMbox   ExportFormat = "mbox"
+	ExportMboxGz ExportFormat = "mbox.gz"
+	ExportTarGz  ExportFormat = "tar.gz"
+	ExportTarZst ExportFormat = "tar.zst"
+)
+
+// mboxの区切り行の日時(asctime形式)
+const mboxTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+func ParseExportFormat(value string) (ExportFormat, error) {
+
+	switch format := ExportFormat(value); format {
+	case ExportMbox, ExportMboxGz, ExportTarGz, ExportTarZst:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid format '%s'", value)
+	}
+}
+
+type ExportedMail struct {
+	Mail       collector.Mail // エクスポートするメール
+	ExportName string         // 出力先の名前(アーカイブフォルダ名と同じ規則)
+	ExportPath string         // 出力先のファイル
+}
+
+// tarに含めるメールの一覧
+type exportManifest struct {
+	Archive string                `json:"archive"`
+	Entries []exportManifestEntry `json:"entries"`
+}
+
+type exportManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Time   string `json:"time"`
+	SHA256 string `json:"sha256"`
+}
+
+// tar形式(元のメールを残すかを選べる)か
+func (f ExportFormat) IsTar() bool {
+	return f == ExportTarGz || f == ExportTarZst
+}
+
+func PlanExport(exportDirPath string, mails *[]collector.Mail, exportNameGenerator ArchiveFolderNameGenerator, format ExportFormat) ([]ExportedMail, error) {
+
+	// 実際には出力せずに、どのファイルに出力されるかを返す
+	exportedMails := []ExportedMail{}
+	exportPaths := map[string]string{} // 名前 -> 出力先
+
+	for _, mail := range *mails {
+		exportName := exportNameGenerator.Generate(mail)
+
+		exportPath, found := exportPaths[exportName]
+		if !found {
+			var err error
+			exportPath, err = exportFilePath(exportDirPath, exportName, format)
+			if err != nil {
+				return nil, err
+			}
+			exportPaths[exportName] = exportPath
+		}
+
+		exportedMails = append(exportedMails, ExportedMail{
+			Mail:       mail,
+			ExportName: exportName,
+			ExportPath: exportPath,
+		})
+	}
+
+	return exportedMails, nil
+}
+
+func Export(exportDirPath string, mails *[]collector.Mail, exportNameGenerator ArchiveFolderNameGenerator, format ExportFormat, removeSources bool) ([]ExportedMail, error) {
+
+	exportedMails, err := PlanExport(exportDirPath, mails, exportNameGenerator, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(exportDirPath, 0777); err != nil {
+		return nil, err
+	}
+
+	// 出力先のファイル毎にまとめて書き込み
+	exportPaths := []string{}
+	exportPathMails := map[string][]collector.Mail{}
+	for _, exportedMail := range exportedMails {
+		if _, found := exportPathMails[exportedMail.ExportPath]; !found {
+			exportPaths = append(exportPaths, exportedMail.ExportPath)
+		}
+		exportPathMails[exportedMail.ExportPath] = append(exportPathMails[exportedMail.ExportPath], exportedMail.Mail)
+	}
+
+	deltas := quotaDeltas{}
+	for _, exportPath := range exportPaths {
+		if err := writeExportFile(exportPath, exportPathMails[exportPath], format); err != nil {
+			deltas.update() // 途中まで削除した分は反映しておく
+			return nil, err
+		}
+
+		if !removeSources {
+			continue
+		}
+
+		// 出力先のファイルがディスクに書き込まれる毎に元のメールを削除
+		// (途中で失敗して再実行した場合に、同じメールが重複して出力されないように)
+		for _, mail := range exportPathMails[exportPath] {
+			if err := os.Remove(mail.FullPath); err != nil {
+				deltas.update()
+				return nil, err
+			}
+			deltas.remove(mail)
+		}
+	}
+
+	return exportedMails, deltas.update()
+}
+
+func exportFilePath(exportDirPath string, exportName string, format ExportFormat) (string, error) {
+
+	// パスの区切りとならないように
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(exportName)
+
+	if !format.IsTar() {
+		// mboxは追記するので、既存のファイルと同じ名前で
+		return filepath.Join(exportDirPath, name+"."+string(format)), nil
+	}
+
+	// tarは追記できないので、既存のファイルとは別の名前に (Archived.tar.gz, Archived.1.tar.gz, ...)
+	for i := 0; ; i++ {
+		baseName := name
+		if i != 0 {
+			baseName = fmt.Sprintf("%s.%d", name, i)
+		}
+
+		exportPath := filepath.Join(exportDirPath, baseName+"."+string(format))
+		found, err := exists(exportPath)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return exportPath, nil
+		}
+	}
+}
+
+func manifestPath(exportPath string, format ExportFormat) string {
+	// Archived.tar.gz -> Archived.manifest.json
+	return strings.TrimSuffix(exportPath, "."+string(format)) + ".manifest.json"
+}
+
+func writeExportFile(exportPath string, mails []collector.Mail, format ExportFormat) error {
+
+	switch format {
+	case ExportTarGz, ExportTarZst:
+		return writeTarFile(exportPath, mails, format)
+	default:
+		return writeMboxFile(exportPath, mails, format == ExportMboxGz)
+	}
+}
+
+func writeTarFile(exportPath string, mails []collector.Mail, format ExportFormat) error {
+
+	// 書き込みが完了するまでは別の名前で
+	tmpPath := exportPath + ".tmp"
+	manifest, err := writeTarTmpFile(tmpPath, mails, format)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, exportPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	manifest.Archive = filepath.Base(exportPath)
+	return writeManifestFile(manifestPath(exportPath, format), manifest)
+}
+
+func writeTarTmpFile(tmpPath string, mails []collector.Mail, format ExportFormat) (*exportManifest, error) {
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var compressor io.WriteCloser
+	if format == ExportTarZst {
+		compressor, err = zstd.NewWriter(file)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		compressor = gzip.NewWriter(file)
+	}
+
+	manifest := &exportManifest{
+		Entries: []exportManifestEntry{},
+	}
+
+	tarWriter := tar.NewWriter(compressor)
+	for _, mail := range mails {
+		entry, err := writeTarEntry(tarWriter, mail)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, *entry)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		return nil, err
+	}
+
+	return manifest, file.Close()
+}
+
+func writeTarEntry(tarWriter *tar.Writer, mail collector.Mail) (*exportManifestEntry, error) {
+
+	src, err := os.Open(mail.FullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	entryPath, err := tarEntryPath(mail)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entryPath,
+		Size:     info.Size(),
+		Mode:     int64(info.Mode().Perm()),
+		ModTime:  info.ModTime(),
+		Format:   tar.FormatPAX, // 長いファイル名やマルチバイトも扱えるように
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tarWriter, hash), src, info.Size()); err != nil {
+		return nil, err
+	}
+
+	return &exportManifestEntry{
+		Path:   entryPath,
+		Size:   info.Size(),
+		Time:   mail.Time.UTC().Format(time.RFC3339),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+func tarEntryPath(mail collector.Mail) (string, error) {
+
+	// Maildirと同じ構成で (INBOXは cur/xxx、その他は .<エンコードしたフォルダ名>/cur/xxx)
+	if mail.FolderName == "" {
+		return path.Join(mail.SubDirName, mail.FileName), nil
+	}
+
+	encodedFolderName, err := folder.EncodeMailFolderName(mail.FolderName)
+	if err != nil {
+		return "", err
+	}
+	return path.Join("."+encodedFolderName, mail.SubDirName, mail.FileName), nil
+}
+
+func writeManifestFile(manifestPath string, manifest *exportManifest) error {
+
+	file, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeMboxFile(exportPath string, mails []collector.Mail, compress bool) error {
+
+	// 途中で失敗した場合に既存のファイルに中途半端に追記されないように、別のファイルに書き込んでから
+	tmpPath := exportPath + ".tmp"
+	if err := writeMboxTmpFile(tmpPath, mails, compress); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	found, err := exists(exportPath)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return os.Rename(tmpPath, exportPath)
+	}
+
+	// 既にある場合は追記 (gzipの場合も、連結されたものとして読み込める)
+	return appendFile(exportPath, tmpPath)
+}
+
+func appendFile(exportPath string, tmpPath string) error {
+
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	file, err := os.OpenFile(exportPath, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, src); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeMboxTmpFile(tmpPath string, mails []collector.Mail, compress bool) error {
+
+	// 前回失敗した際のものが残っていても上書き
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var writer io.Writer = file
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(file)
+		writer = gzipWriter
+	}
+
+	bufWriter := bufio.NewWriter(writer)
+	for _, mail := range mails {
+		if err := writeMboxMessage(bufWriter, mail); err != nil {
+			return err
+		}
+	}
+
+	if err := bufWriter.Flush(); err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeMboxMessage(writer *bufio.Writer, mail collector.Mail) error {
+
+	header, err := collector.ReadHeader(mail.FullPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(mail.FullPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// 区切り行
+	fmt.Fprintf(writer, "From %s %s\n", envelopeSender(header.Get("Return-Path")), mail.Time.UTC().Format(mboxTimeLayout))
+
+	reader := bufio.NewReader(src)
+	lineEnded := true
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if line != "" {
+			// 改行はLFに揃える
+			if strings.HasSuffix(line, "\r\n") {
+				line = line[:len(line)-2] + "\n"
+			}
+
+			// mboxrd: "From "(前に">"が続くものも含む)で始まる行は">"を付けて区別
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				writer.WriteString(">")
+			}
+
+			writer.WriteString(line)
+			lineEnded = strings.HasSuffix(line, "\n")
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if !lineEnded {
+		writer.WriteString("\n")
+	}
+
+	// メール間は空行で区切る
+	_, err = writer.WriteString("\n")
+	return err
+}
+
+func envelopeSender(returnPath string) string {
+
+	// "<user@example.com>" -> "user@example.com"
+	sender := strings.TrimSpace(returnPath)
+	sender = strings.TrimSuffix(strings.TrimPrefix(sender, "<"), ">")
+
+	fields := strings.Fields(sender)
+	if len(fields) == 0 {
+		// バウンスメールなど送信者が無い場合
+		return "MAILER-DAEMON"
+	}
+
+	return fields[0]
+}
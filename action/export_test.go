@@ -0,0 +1,463 @@
+package action
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport_Mbox(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := filepath.Join(temp, "export") // 存在しないフォルダ
+
+	targetMails := []collector.Mail{
+		createMailByContent(t, temp, "", "cur", "a",
+			"Return-Path: <user1@example.com>\r\nSubject: a\r\n\r\nFrom here\r\n>From there\r\nend\r\n",
+			time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+		createMailByContent(t, temp, "", "new", "b",
+			"Subject: b\n\nno newline",
+			time.Date(2021, 1, 12, 3, 4, 5, 0, time.UTC)),
+		createMailByContent(t, temp, "A", "cur", "c",
+			"Return-Path: <>\nSubject: c\n\nc\n",
+			time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportMbox, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 元のメールは削除されていること
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+
+	assert.Equal(t, []ExportedMail{
+		{Mail: targetMails[0], ExportName: "Archived", ExportPath: filepath.Join(exportDirPath, "Archived.mbox")},
+		{Mail: targetMails[1], ExportName: "Archived", ExportPath: filepath.Join(exportDirPath, "Archived.mbox")},
+		{Mail: targetMails[2], ExportName: "Archived.A", ExportPath: filepath.Join(exportDirPath, "Archived.A.mbox")},
+	}, exportedMails)
+
+	// mboxrd形式で出力されていること
+	assert.Equal(t,
+		"From user1@example.com Sat Jan  2 03:04:05 2021\n"+
+			"Return-Path: <user1@example.com>\nSubject: a\n\n>From here\n>>From there\nend\n"+
+			"\n"+
+			"From MAILER-DAEMON Tue Jan 12 03:04:05 2021\n"+
+			"Subject: b\n\nno newline\n"+
+			"\n",
+		test.ReadFile(t, filepath.Join(exportDirPath, "Archived.mbox")))
+	assert.Equal(t,
+		"From MAILER-DAEMON Sat Jan  1 00:00:00 2022\n"+
+			"Return-Path: <>\nSubject: c\n\nc\n"+
+			"\n",
+		test.ReadFile(t, filepath.Join(exportDirPath, "Archived.A.mbox")))
+}
+
+func TestExport_MboxGz(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := test.CreateDir(t, temp, "export")
+
+	// 既に出力されているファイル
+	exportPath := filepath.Join(exportDirPath, "Archived.2021.mbox.gz")
+	writeGzipFile(t, exportPath, "From MAILER-DAEMON Fri Jan  1 00:00:00 2021\nSubject: x\n\nx\n\n")
+
+	targetMails := []collector.Mail{
+		createMailByContent(t, temp, "", "cur", "a",
+			"Return-Path: <user1@example.com>\nSubject: a\n\na\n",
+			time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+
+	exportNameGenerator := &YearArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportMboxGz, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, exportPath, exportedMails[0].ExportPath)
+	assert.NoFileExists(t, targetMails[0].FullPath)
+
+	// 既存の内容に追記されていること
+	assert.Equal(t,
+		"From MAILER-DAEMON Fri Jan  1 00:00:00 2021\nSubject: x\n\nx\n\n"+
+			"From user1@example.com Sat Jan  2 03:04:05 2021\nReturn-Path: <user1@example.com>\nSubject: a\n\na\n\n",
+		readGzipFile(t, exportPath))
+}
+
+func TestExport_MailNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := filepath.Join(temp, "export")
+
+	existsMail := createMailByContent(t, temp, "", "cur", "a", "Subject: a\n\na\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	notFoundMail := existsMail
+	notFoundMail.FullPath = filepath.Join(temp, "cur", "b") // 存在しないメール
+
+	targetMails := []collector.Mail{existsMail, notFoundMail}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	_, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportMbox, true)
+
+	// ASSERT
+	require.Error(t, err)
+
+	// 出力できなかった場合は元のメールは削除されないこと
+	assert.FileExists(t, existsMail.FullPath)
+}
+
+func TestExport_MboxPartialFailure(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := test.CreateDir(t, temp, "export")
+
+	// 既に出力されているファイル
+	existsExportPath := filepath.Join(exportDirPath, "Archived.A.mbox")
+	test.CreateFile(t, existsExportPath, "From MAILER-DAEMON Fri Jan  1 00:00:00 2021\nSubject: x\n\nx\n\n")
+
+	inboxMail := createMailByContent(t, temp, "", "cur", "a", "Subject: a\n\na\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	existsMail := createMailByContent(t, temp, "A", "cur", "b", "Subject: b\n\nb\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	notFoundMail := existsMail
+	notFoundMail.FullPath = filepath.Join(temp, ".A", "cur", "c") // 存在しないメール
+
+	targetMails := []collector.Mail{inboxMail, existsMail, notFoundMail}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	_, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportMbox, true)
+
+	// ASSERT
+	require.Error(t, err)
+
+	// 出力できたファイルの分は、元のメールが削除されていること (再実行で重複しないように)
+	assert.NoFileExists(t, inboxMail.FullPath)
+	assert.Equal(t,
+		"From MAILER-DAEMON Sat Jan  2 03:04:05 2021\nSubject: a\n\na\n\n",
+		test.ReadFile(t, filepath.Join(exportDirPath, "Archived.mbox")))
+
+	// 出力できなかったファイルは、既存の内容のままで元のメールも残っていること
+	assert.FileExists(t, existsMail.FullPath)
+	assert.Equal(t,
+		"From MAILER-DAEMON Fri Jan  1 00:00:00 2021\nSubject: x\n\nx\n\n",
+		test.ReadFile(t, existsExportPath))
+
+	// 書き込み途中のファイルが残っていないこと
+	entries, err := os.ReadDir(exportDirPath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestExport_TarGz(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := filepath.Join(temp, "export")
+
+	targetMails := []collector.Mail{
+		createMailByContent(t, temp, "", "cur", "a", "Subject: a\r\n\r\na\r\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+		createMailByContent(t, temp, "テスト", "new", "b", "Subject: b\n\nb\n", time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)),
+	}
+
+	// 全て同じアーカイブに
+	exportNameGenerator := &YearArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportTarGz, false)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	exportPath := filepath.Join(exportDirPath, "Archived.2021.tar.gz")
+	assert.Equal(t, []ExportedMail{
+		{Mail: targetMails[0], ExportName: "Archived.2021", ExportPath: exportPath},
+		{Mail: targetMails[1], ExportName: "Archived.2021", ExportPath: exportPath},
+	}, exportedMails)
+
+	// 指定が無い場合は元のメールは残ること
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 書き込み途中のファイルは残っていないこと
+	assert.NoFileExists(t, exportPath+".tmp")
+
+	// Maildirのフォルダ構成で格納されていること
+	file, err := os.Open(exportPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"cur/a":             "Subject: a\r\n\r\na\r\n",
+		".&MMYwuTDI-/new/b": "Subject: b\n\nb\n",
+	}, readTarEntries(t, gzipReader))
+
+	// マニフェスト
+	assert.Equal(t, exportManifest{
+		Archive: "Archived.2021.tar.gz",
+		Entries: []exportManifestEntry{
+			{Path: "cur/a", Size: 17, Time: "2021-01-02T03:04:05Z", SHA256: sha256Hex("Subject: a\r\n\r\na\r\n")},
+			{Path: ".&MMYwuTDI-/new/b", Size: 14, Time: "2021-02-03T04:05:06Z", SHA256: sha256Hex("Subject: b\n\nb\n")},
+		},
+	}, readManifestFile(t, filepath.Join(exportDirPath, "Archived.2021.manifest.json")))
+}
+
+func TestExport_TarZst(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := test.CreateDir(t, temp, "export")
+
+	// 既に出力されているアーカイブ
+	test.CreateFile(t, filepath.Join(exportDirPath, "Archived.tar.zst"), "x")
+	test.CreateFile(t, filepath.Join(exportDirPath, "Archived.manifest.json"), "x")
+
+	targetMails := []collector.Mail{
+		createMailByContent(t, temp, "A", "cur", "a", "Subject: a\n\na\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportTarZst, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 既存のアーカイブは上書きせずに別の名前で
+	exportPath := filepath.Join(exportDirPath, "Archived.A.tar.zst")
+	assert.Equal(t, exportPath, exportedMails[0].ExportPath)
+	assert.Equal(t, "x", test.ReadFile(t, filepath.Join(exportDirPath, "Archived.tar.zst")))
+
+	// 指定した場合は元のメールは削除されること
+	assert.NoFileExists(t, targetMails[0].FullPath)
+
+	file, err := os.Open(exportPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	zstdReader, err := zstd.NewReader(file)
+	require.NoError(t, err)
+	defer zstdReader.Close()
+
+	assert.Equal(t, map[string]string{
+		".A/cur/a": "Subject: a\n\na\n",
+	}, readTarEntries(t, zstdReader))
+
+	manifest := readManifestFile(t, filepath.Join(exportDirPath, "Archived.A.manifest.json"))
+	assert.Equal(t, "Archived.A.tar.zst", manifest.Archive)
+	assert.Equal(t, ".A/cur/a", manifest.Entries[0].Path)
+}
+
+func TestExport_TarUniqueName(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := test.CreateDir(t, temp, "export")
+
+	// 既に出力されているアーカイブ
+	test.CreateFile(t, filepath.Join(exportDirPath, "Archived.tar.gz"), "x")
+	test.CreateFile(t, filepath.Join(exportDirPath, "Archived.1.tar.gz"), "x")
+
+	targetMails := []collector.Mail{
+		createMailByContent(t, temp, "", "cur", "a", "Subject: a\n\na\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportTarGz, false)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 存在しない名前になること
+	assert.Equal(t, filepath.Join(exportDirPath, "Archived.2.tar.gz"), exportedMails[0].ExportPath)
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.2.manifest.json"))
+	assert.Equal(t, "x", test.ReadFile(t, filepath.Join(exportDirPath, "Archived.tar.gz")))
+	assert.Equal(t, "x", test.ReadFile(t, filepath.Join(exportDirPath, "Archived.1.tar.gz")))
+}
+
+func TestExport_TarMailNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := filepath.Join(temp, "export")
+
+	existsMail := createMailByContent(t, temp, "", "cur", "a", "Subject: a\n\na\n", time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	notFoundMail := existsMail
+	notFoundMail.FullPath = filepath.Join(temp, "cur", "b") // 存在しないメール
+
+	targetMails := []collector.Mail{existsMail, notFoundMail}
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	_, err := Export(exportDirPath, &targetMails, exportNameGenerator, ExportTarGz, true)
+
+	// ASSERT
+	require.Error(t, err)
+
+	// 書き込みが完了しなかった場合は、アーカイブは残らず元のメールも削除されないこと
+	assert.NoFileExists(t, filepath.Join(exportDirPath, "Archived.tar.gz"))
+	assert.NoFileExists(t, filepath.Join(exportDirPath, "Archived.tar.gz.tmp"))
+	assert.NoFileExists(t, filepath.Join(exportDirPath, "Archived.manifest.json"))
+	assert.FileExists(t, existsMail.FullPath)
+}
+
+func TestPlanExport(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	exportDirPath := filepath.Join(temp, "export")
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "A", "cur", 2021, 1),
+	}
+	targetMails[1].FolderName = "A/B" // パスの区切りを含む
+
+	exportNameGenerator := &KeepArchiveFolderNameGenerator{
+		ArchiveFolderBaseName: "Archived",
+	}
+
+	// ACT
+	exportedMails, err := PlanExport(exportDirPath, &targetMails, exportNameGenerator, ExportMboxGz)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []ExportedMail{
+		{Mail: targetMails[0], ExportName: "Archived", ExportPath: filepath.Join(exportDirPath, "Archived.mbox.gz")},
+		// パスの区切りは置き換えられること
+		{Mail: targetMails[1], ExportName: "Archived.A/B", ExportPath: filepath.Join(exportDirPath, "Archived.A_B.mbox.gz")},
+	}, exportedMails)
+
+	// 実際には出力されていないこと
+	assert.NoDirExists(t, exportDirPath)
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestParseExportFormat_Invalid(t *testing.T) {
+
+	// ACT
+	_, err := ParseExportFormat("zip")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid format 'zip'")
+}
+
+func createMailByContent(t *testing.T, rootDir string, folderName string, sub string, name string, content string, mailTime time.Time) collector.Mail {
+
+	mail := createMailByName(t, rootDir, folderName, sub, name)
+	test.CreateFile(t, mail.FullPath, content)
+
+	mail.Size = int64(len(content))
+	mail.Time = mailTime
+	return mail
+}
+
+func writeGzipFile(t *testing.T, path string, content string) {
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+}
+
+func readGzipFile(t *testing.T, path string) string {
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func readTarEntries(t *testing.T, reader io.Reader) map[string]string {
+
+	entries := map[string]string{}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		entries[header.Name] = string(content)
+	}
+
+	return entries
+}
+
+func readManifestFile(t *testing.T, path string) exportManifest {
+
+	var manifest exportManifest
+	require.NoError(t, json.Unmarshal([]byte(test.ReadFile(t, path)), &manifest))
+	return manifest
+}
+
+func sha256Hex(content string) string {
+
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,284 @@
+package action
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+)
+
+// ジャーナルに記録する操作
+const (
+	OperationArchive = "archive" // アーカイブフォルダへ移動
+	OperationDedupe  = "dedupe"  // 同じ内容がアーカイブ済みのため削除
+	OperationTrash   = "trash"   // ゴミ箱へ移動
+	OperationDelete  = "delete"  // 削除
+)
+
+const (
+	JournalStarted = "started" // 操作前
+	JournalDone    = "done"    // 操作後
+)
+
+type JournalEntry struct {
+	Time        string `json:"time"`
+	Operation   string `json:"operation"`
+	Status      string `json:"status"`
+	Folder      string `json:"folder"` // 元のフォルダ名
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+type journalError struct {
+	err error
+}
+
+func (e *journalError) Error() string {
+	return "failed to write the journal: " + e.err.Error()
+}
+
+func (e *journalError) Unwrap() error {
+	return e.err
+}
+
+// ファイル操作の前後を追記していくジャーナル (複数のmaildirから並列に書き込まれる)
+type Journal struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+func OpenJournal(journalPath string) (*Journal, error) {
+
+	file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		file: file,
+	}, nil
+}
+
+func (j *Journal) Close() error {
+
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+func (j *Journal) record(operation string, mail collector.Mail, dstPath string, operate func() error) error {
+
+	// ジャーナル無しで実行された場合は、そのまま操作
+	if j == nil {
+		return operate()
+	}
+
+	entry := JournalEntry{
+		Operation:   operation,
+		Folder:      mail.FolderName,
+		Source:      mail.FullPath,
+		Destination: dstPath,
+		Size:        mail.Size,
+	}
+
+	// 操作前の記録は、操作より先にディスクに書き込まれている必要がある
+	if err := j.write(entry, JournalStarted, true); err != nil {
+		return &journalError{err: err}
+	}
+
+	if err := operate(); err != nil {
+		return err
+	}
+
+	// 操作後の記録が失われても、再開時にファイルの状態から判断できる
+	if err := j.write(entry, JournalDone, false); err != nil {
+		return &journalError{err: err}
+	}
+	return nil
+}
+
+func (j *Journal) write(entry JournalEntry, status string, sync bool) error {
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	entry.Time = time.Now().Format(time.RFC3339)
+	entry.Status = status
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func ReadJournal(journalPath string) ([]JournalEntry, error) {
+
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []JournalEntry{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// 書き込み途中で中断された行は無視
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// 開始したが完了が記録されていない操作
+func interruptedEntries(entries []JournalEntry) []JournalEntry {
+
+	done := map[JournalEntry]bool{}
+	for _, entry := range entries {
+		if entry.Status == JournalDone {
+			done[entry.withoutStatus()] = true
+		}
+	}
+
+	interrupted := []JournalEntry{}
+	for _, entry := range entries {
+		if entry.Status == JournalStarted && !done[entry.withoutStatus()] {
+			interrupted = append(interrupted, entry)
+		}
+	}
+
+	return interrupted
+}
+
+func (e JournalEntry) withoutStatus() JournalEntry {
+
+	e.Time = ""
+	e.Status = ""
+	return e
+}
+
+func (e JournalEntry) mail() collector.Mail {
+
+	return collector.Mail{
+		FullPath:   e.Source,
+		FolderName: e.Folder,
+		SubDirName: filepath.Base(filepath.Dir(e.Source)),
+		FileName:   filepath.Base(e.Source),
+		Size:       e.Size,
+	}
+}
+
+type ResumeResult struct {
+	Completed []JournalEntry // 中断されたが、完了させたもの
+	Retried   []JournalEntry // 中断されたため、もう一度実施が必要なもの
+}
+
+// 中断された操作を完了させて、続きを記録できるようにジャーナルを開く
+func ResumeJournal(journalPath string) (*Journal, *ResumeResult, error) {
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	journal, err := OpenJournal(journalPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &ResumeResult{
+		Completed: []JournalEntry{},
+		Retried:   []JournalEntry{},
+	}
+
+	for _, entry := range interruptedEntries(entries) {
+		completed, err := completeInterrupted(entry)
+		if err != nil {
+			journal.Close()
+			return nil, nil, err
+		}
+
+		if !completed {
+			// 移動元が残っているので、続きの実行で対象となる
+			result.Retried = append(result.Retried, entry)
+			continue
+		}
+
+		if err := journal.write(entry, JournalDone, false); err != nil {
+			journal.Close()
+			return nil, nil, err
+		}
+		result.Completed = append(result.Completed, entry)
+	}
+
+	return journal, result, nil
+}
+
+func completeInterrupted(entry JournalEntry) (bool, error) {
+
+	srcFound, err := exists(entry.Source)
+	if err != nil {
+		return false, err
+	}
+
+	switch entry.Operation {
+	case OperationArchive, OperationTrash:
+		dstFound, err := exists(entry.Destination)
+		if err != nil {
+			return false, err
+		}
+
+		if !dstFound {
+			// 別のファイルシステムへのコピー途中だったものは消しておく (やり直す際に邪魔になるので)
+			tmpPath := filepath.Join(filepath.Dir(filepath.Dir(entry.Destination)), "tmp", filepath.Base(entry.Destination))
+			if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			return !srcFound, nil
+		}
+
+		if srcFound {
+			// コピーは終わっていて、移動元の削除前に中断された
+			same, err := sameContent(entry.Source, entry.Destination)
+			if err != nil || !same {
+				return false, err
+			}
+			if err := os.Remove(entry.Source); err != nil {
+				return false, err
+			}
+		}
+
+		if entry.Operation == OperationArchive {
+			// 元のフォルダの記録前に中断された可能性もある
+			archivedMail := entry.mail()
+			archivedMail.FullPath = entry.Destination
+			archivedMail.FileName = filepath.Base(entry.Destination)
+			if err := recordOrigin(archivedMail, entry.Folder); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		// 削除は移動元が無くなっていれば完了
+		return !srcFound, nil
+	}
+}
@@ -0,0 +1,349 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveWithConflictPolicy_Journal(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+		createMailByName(t, temp, "A", "new", "b"),
+	}
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, &KeepArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"}, ConflictRename, false, journal)
+	require.NoError(t, journal.Close())
+
+	// ASSERT
+	require.NoError(t, err)
+
+	entries, err := ReadJournal(journalPath)
+	require.NoError(t, err)
+
+	// 操作毎に前後が記録されていること
+	assert.Equal(t, 4, len(entries))
+	for i, mail := range targetMails {
+		for j, status := range []string{JournalStarted, JournalDone} {
+			entry := entries[i*2+j]
+			assert.Equal(t, OperationArchive, entry.Operation)
+			assert.Equal(t, status, entry.Status)
+			assert.Equal(t, mail.FolderName, entry.Folder)
+			assert.Equal(t, mail.FullPath, entry.Source)
+			assert.Equal(t, (*result.ArchivedMails)[i].FullPath, entry.Destination)
+			assert.Equal(t, mail.Size, entry.Size)
+			assert.NotEmpty(t, entry.Time)
+		}
+	}
+}
+
+func TestMoveToTrash_Journal(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "A", "cur", "a"),
+		createMailByName(t, temp, "Trash", "cur", "b"),
+	}
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+
+	// ACT
+	plan, err := MoveToTrash(temp, &targetMails, "Trash", false, journal)
+	require.NoError(t, journal.Close())
+
+	// ASSERT
+	require.NoError(t, err)
+
+	entries, err := ReadJournal(journalPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, OperationTrash, entries[0].Operation)
+	assert.Equal(t, targetMails[0].FullPath, entries[0].Source)
+	assert.Equal(t, (*plan.TrashedMails)[0].FullPath, entries[0].Destination)
+
+	// ゴミ箱にあったものは削除として記録
+	assert.Equal(t, OperationDelete, entries[2].Operation)
+	assert.Equal(t, targetMails[1].FullPath, entries[2].Source)
+	assert.Equal(t, "", entries[2].Destination)
+}
+
+func TestResumeJournal(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// コピー後、移動元の削除前に中断されたもの
+	copiedMail := createMailByName(t, temp, "", "cur", "a")
+	copiedPath := filepath.Join(test.CreateMailFolder(t, temp, ".Archived"), "cur", "a")
+	test.CreateFile(t, copiedPath, test.ReadFile(t, copiedMail.FullPath))
+
+	// コピー途中で中断されたもの
+	notMovedMail := createMailByName(t, temp, "", "cur", "b")
+	notMovedPath := filepath.Join(temp, ".Archived", "cur", "b")
+	tmpPath := filepath.Join(temp, ".Archived", "tmp", "b")
+	test.CreateFile(t, tmpPath, "x")
+
+	// 削除後に中断されたもの
+	deletedPath := filepath.Join(temp, "cur", "c")
+
+	// 完了まで記録されているもの
+	doneMail := createMailByName(t, temp, "", "cur", "d")
+
+	journalPath := filepath.Join(temp, "journal")
+	writeJournal(t, journalPath, []JournalEntry{
+		{Operation: OperationArchive, Status: JournalStarted, Source: copiedMail.FullPath, Destination: copiedPath, Size: 1},
+		{Operation: OperationArchive, Status: JournalStarted, Source: notMovedMail.FullPath, Destination: notMovedPath, Size: 1},
+		{Operation: OperationDelete, Status: JournalStarted, Source: deletedPath, Size: 1},
+		{Operation: OperationDelete, Status: JournalStarted, Source: doneMail.FullPath, Size: 1},
+		{Operation: OperationDelete, Status: JournalDone, Source: doneMail.FullPath, Size: 1},
+	})
+
+	// ACT
+	journal, result, err := ResumeJournal(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	assert.Equal(t, []string{copiedMail.FullPath, deletedPath}, entrySources(result.Completed))
+	assert.Equal(t, []string{notMovedMail.FullPath}, entrySources(result.Retried))
+
+	// コピー済みのものは移動元が削除され、元のフォルダが記録されること
+	assert.NoFileExists(t, copiedMail.FullPath)
+	assert.FileExists(t, copiedPath)
+	assert.Equal(t, `{"name":"a","folder":""}`+"\n", test.ReadFile(t, filepath.Join(temp, ".Archived", OriginsFileName)))
+
+	// コピー途中のものは移動元が残り、書きかけのものは削除されること
+	assert.FileExists(t, notMovedMail.FullPath)
+	assert.NoFileExists(t, tmpPath)
+
+	// 完了したものが追記されていること
+	entries, err := ReadJournal(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, 7, len(entries))
+	assert.Equal(t, []string{JournalDone, JournalDone}, []string{entries[5].Status, entries[6].Status})
+	assert.Equal(t, []string{copiedMail.FullPath, deletedPath}, entrySources(entries[5:]))
+}
+
+func TestResumeJournal_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	_, _, err := ResumeJournal(filepath.Join(temp, "journal"))
+
+	// ASSERT
+	require.Error(t, err)
+}
+
+func TestReadJournal_BrokenLine(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	journalPath := filepath.Join(temp, "journal")
+	test.CreateFile(t, journalPath, `{"operation":"delete","status":"started","source":"a"}
+{"operation":"delete","status":"do`)
+
+	// ACT
+	entries, err := ReadJournal(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 書き込み途中の行は無視
+	assert.Equal(t, []JournalEntry{
+		{Operation: OperationDelete, Status: JournalStarted, Source: "a"},
+	}, entries)
+}
+
+func TestUndo(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+		createMailByName(t, temp, "A.B", "new", "b"),
+		createMailByName(t, temp, "C", "cur", "c"),
+	}
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+
+	_, err = ArchiveWithConflictPolicy(temp, &targetMails, &YearArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"}, ConflictRename, false, journal)
+	require.NoError(t, err)
+	_, err = MoveToTrash(temp, &[]collector.Mail{createMailByName(t, temp, "C", "cur", "d")}, "Trash", false, journal)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// 元のフォルダが削除されていても、作成し直されること
+	require.NoError(t, os.RemoveAll(filepath.Join(temp, ".A.B")))
+
+	// ACT
+	result, err := Undo(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 新しいものから順に戻すこと
+	assert.Equal(t, []string{
+		filepath.Join(temp, ".C", "cur", "d"),
+		targetMails[2].FullPath,
+		targetMails[1].FullPath,
+		targetMails[0].FullPath,
+	}, entrySources(result.Entries))
+	assert.Equal(t, []UndoSkipped{}, result.Skipped)
+
+	for _, mail := range *result.RestoredMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	for _, entry := range result.Entries {
+		assert.NoFileExists(t, entry.Destination)
+	}
+
+	// 戻したものは元のフォルダの記録から除かれること
+	originsPaths, err := filepath.Glob(filepath.Join(temp, ".Archived.*", OriginsFileName))
+	require.NoError(t, err)
+	assert.Empty(t, originsPaths)
+}
+
+func TestUndo_Dedupe(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMail := createMailByName(t, temp, "", "cur", "a")
+
+	// 同じ内容のものがアーカイブ済み
+	existsMail := createMailByName(t, temp, "Archived", "cur", "a")
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+
+	_, err = ArchiveWithConflictPolicy(temp, &[]collector.Mail{targetMail}, &KeepArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"}, ConflictDedupe, false, journal)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+	require.NoFileExists(t, targetMail.FullPath)
+
+	// ACT
+	result, err := Undo(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{targetMail.FullPath}, entrySources(result.Entries))
+
+	// 残したものからコピーして戻すこと
+	assert.FileExists(t, targetMail.FullPath)
+	assert.FileExists(t, existsMail.FullPath)
+}
+
+func TestUndo_Skipped(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 既に戻されているもの
+	restoredMail := createMailByName(t, temp, "", "cur", "a")
+
+	// 移動先が見つからないもの
+	movedPath := filepath.Join(temp, "cur", "b")
+
+	journalPath := filepath.Join(temp, "journal")
+	writeJournal(t, journalPath, []JournalEntry{
+		{Operation: OperationDelete, Status: JournalStarted, Source: filepath.Join(temp, "cur", "c")},
+		{Operation: OperationArchive, Status: JournalStarted, Source: movedPath, Destination: filepath.Join(temp, ".Archived", "cur", "b")},
+		{Operation: OperationArchive, Status: JournalStarted, Source: restoredMail.FullPath, Destination: filepath.Join(temp, ".Archived", "cur", "a")},
+	})
+
+	// ACT
+	result, err := PlanUndo(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []JournalEntry{}, result.Entries)
+	assert.Equal(t, []string{"source already exists", "destination not found", "deleted mail cannot be restored"}, []string{
+		result.Skipped[0].Reason,
+		result.Skipped[1].Reason,
+		result.Skipped[2].Reason,
+	})
+}
+
+func TestPlanUndo(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "A", "cur", "a"),
+	}
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, &KeepArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"}, ConflictRename, false, journal)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// ACT
+	plan, err := PlanUndo(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{targetMails[0].FullPath}, entrySources(plan.Entries))
+
+	// 実際には戻されていないこと
+	assert.NoFileExists(t, targetMails[0].FullPath)
+	assert.FileExists(t, (*result.ArchivedMails)[0].FullPath)
+}
+
+func writeJournal(t *testing.T, journalPath string, entries []JournalEntry) {
+
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	for _, entry := range entries {
+		require.NoError(t, journal.write(entry, entry.Status, false))
+	}
+}
+
+func entrySources(entries []JournalEntry) []string {
+
+	sources := []string{}
+	for _, entry := range entries {
+		sources = append(sources, entry.Source)
+	}
+	return sources
+}
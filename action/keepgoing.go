@@ -0,0 +1,40 @@
+package action
+
+import (
+	"errors"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+)
+
+func canKeepGoing(err error, keepGoing bool) bool {
+
+	// ジャーナルに書き込めない場合は、再開や元に戻すことができなくなるので続けない
+	var journalErr *journalError
+	return keepGoing && !errors.As(err, &journalErr)
+}
+
+func newMailError(mail collector.Mail, err error) collector.MailError {
+
+	return collector.MailError{
+		FolderName: mail.FolderName,
+		Path:       mail.FullPath,
+		Err:        err,
+	}
+}
+
+// エラーとなったものを除いたメール (処理できたもの)
+func ExcludeFailures(mails *[]collector.Mail, failures []collector.MailError) *[]collector.Mail {
+
+	failedPaths := map[string]bool{}
+	for _, failure := range failures {
+		failedPaths[failure.Path] = true
+	}
+
+	succeededMails := []collector.Mail{}
+	for _, mail := range *mails {
+		if !failedPaths[mail.FullPath] {
+			succeededMails = append(succeededMails, mail)
+		}
+	}
+	return &succeededMails
+}
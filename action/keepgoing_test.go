@@ -0,0 +1,136 @@
+package action
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelete_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+		notFoundMail(temp, "A", "b"),
+		createMailByName(t, temp, "A", "cur", "c"),
+	}
+
+	// ACT
+	failures, err := Delete(temp, &targetMails, true, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 存在しないものがあっても、残りは削除されること
+	assert.NoFileExists(t, targetMails[0].FullPath)
+	assert.NoFileExists(t, targetMails[2].FullPath)
+
+	require.Equal(t, 1, len(failures))
+	assert.Equal(t, "A", failures[0].FolderName)
+	assert.Equal(t, targetMails[1].FullPath, failures[0].Path)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	assert.Contains(t, failures[0].Err.Error(), "remove "+targetMails[1].FullPath)
+}
+
+func TestArchiveWithConflictPolicy_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		notFoundMail(temp, "", "a"),
+		createMailByName(t, temp, "", "cur", "b"),
+	}
+
+	// ACT
+	result, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictRename, true, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 存在しないものを除いてアーカイブされること
+	assert.Equal(t, []collector.Mail{targetMails[1]}, *result.SourceMails)
+	assert.FileExists(t, (*result.ArchivedMails)[0].FullPath)
+
+	require.Equal(t, 1, len(result.Failures))
+	assert.Equal(t, targetMails[0].FullPath, result.Failures[0].Path)
+	assert.Contains(t, result.Failures[0].Err.Error(), "rename "+targetMails[0].FullPath)
+}
+
+func TestArchiveWithConflictPolicy_KeepGoingJournalError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+	}
+
+	// 書き込めないジャーナル
+	journal, err := OpenJournal(filepath.Join(temp, "journal"))
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// ACT
+	_, err = ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictRename, true, journal)
+
+	// ASSERT
+	// ジャーナルに書き込めない場合は続けないこと
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write the journal: ")
+	assert.FileExists(t, targetMails[0].FullPath)
+}
+
+func TestMoveToTrash_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	targetMails := []collector.Mail{
+		notFoundMail(temp, "", "a"),
+		createMailByName(t, temp, "", "cur", "b"),
+		notFoundMail(temp, "Trash", "c"),
+		createMailByName(t, temp, "Trash", "cur", "d"),
+	}
+
+	// ACT
+	plan, err := MoveToTrash(temp, &targetMails, "Trash", true, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 成功したもののみとなること
+	assert.Equal(t, []collector.Mail{targetMails[1]}, *plan.MovedMails)
+	assert.Equal(t, 1, len(*plan.TrashedMails))
+	assert.Equal(t, []collector.Mail{targetMails[3]}, *plan.DeletedMails)
+
+	assert.Equal(t, []string{targetMails[0].FullPath, targetMails[2].FullPath}, []string{
+		plan.Failures[0].Path,
+		plan.Failures[1].Path,
+	})
+}
+
+func notFoundMail(rootDir string, folderName string, name string) collector.Mail {
+
+	folderPath := rootDir
+	if folderName != "" {
+		folderPath = filepath.Join(rootDir, "."+folderName)
+	}
+
+	return collector.Mail{
+		FullPath:   filepath.Join(folderPath, "cur", name),
+		FolderName: folderName,
+		SubDirName: "cur",
+		FileName:   name,
+		Size:       1,
+	}
+}
@@ -0,0 +1,162 @@
+package action
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/onozaty/maildir-cleaner/folder"
+)
+
+func moveFile(srcPath string, dstPath string) error {
+
+	// 判断できなかった場合(移動元が無いなど)は、renameでエラーとなる
+	same, err := sameDevice(srcPath, filepath.Dir(dstPath))
+	if err != nil || same {
+		// renameだと既存のファイルを置き換えてしまうので、linkしてから移動元を削除
+		err := linkFile(srcPath, dstPath)
+		if err == nil {
+			return os.Remove(srcPath)
+		}
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+
+	// 別のファイルシステムへはrenameできないので、コピーして検証してから移動元を削除
+	return copyAndRemove(srcPath, dstPath)
+}
+
+func copyAndRemove(srcPath string, dstPath string) error {
+
+	// 移動先のフォルダのtmpに書き込んでから、cur/newにrename (Maildirの配送と同じ手順)
+	tmpPath := filepath.Join(filepath.Dir(filepath.Dir(dstPath)), "tmp", filepath.Base(dstPath))
+
+	if err := copyAndVerify(srcPath, tmpPath); err != nil {
+		return err
+	}
+
+	// renameだと既存のファイルを置き換えてしまうので、linkで既存のものがあればエラーに
+	err := linkFile(tmpPath, dstPath)
+	os.Remove(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	// 移動先が確実に書き込まれてから移動元を削除
+	if err := syncDir(filepath.Dir(dstPath)); err != nil {
+		return err
+	}
+
+	return os.Remove(srcPath)
+}
+
+func linkFile(srcPath string, dstPath string) error {
+
+	err := os.Link(srcPath, dstPath)
+	if err == nil || errors.Is(err, os.ErrExist) || errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	// ハードリンクに対応していないファイルシステムの場合は、存在確認してからrename
+	if _, statErr := os.Lstat(dstPath); statErr == nil {
+		return &os.LinkError{Op: "link", Old: srcPath, New: dstPath, Err: os.ErrExist}
+	}
+	return os.Rename(srcPath, dstPath)
+}
+
+func copyAndVerify(srcPath string, tmpPath string) error {
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	srcHash, err := copyFile(srcPath, tmpPath, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if err := verifyCopiedFile(tmpPath, srcInfo, srcHash); err != nil {
+		// 検証できなかったものは残さない
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+func verifyCopiedFile(tmpPath string, srcInfo os.FileInfo, srcHash []byte) error {
+
+	// 書き込んだ内容を読み直して検証
+	tmpInfo, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	if tmpInfo.Size() != srcInfo.Size() {
+		return fmt.Errorf("failed to verify %s: size mismatch", tmpPath)
+	}
+
+	tmpHash, err := fileHash(tmpPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcHash, tmpHash) {
+		return fmt.Errorf("failed to verify %s: checksum mismatch", tmpPath)
+	}
+
+	// 更新日時をメールの日時として使うこともあるので引き継ぐ
+	if err := os.Chtimes(tmpPath, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return err
+	}
+
+	return folder.ChownInherited(tmpPath)
+}
+
+func copyFile(srcPath string, dstPath string, perm os.FileMode) ([]byte, error) {
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// 既存のファイルは上書きしない
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := writeFile(dst, src)
+	if err != nil {
+		// 途中まで書き込んだものが残らないように
+		dst.Close()
+		os.Remove(dstPath)
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+func writeFile(dst *os.File, src io.Reader) ([]byte, error) {
+
+	// コピーしながら移動元のハッシュを算出
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, hash), src); err != nil {
+		return nil, err
+	}
+
+	if err := dst.Sync(); err != nil {
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
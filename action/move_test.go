@@ -0,0 +1,173 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveFile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "cur", "a")
+	test.CreateFile(t, srcPath, "abc")
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+
+	// ACT
+	err := moveFile(srcPath, dstPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, srcPath)
+	assert.Equal(t, "abc", test.ReadFile(t, dstPath))
+}
+
+func TestMoveFile_SrcNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "cur", "a") // 存在しないファイル
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+
+	// ACT
+	err := moveFile(srcPath, dstPath)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.NoFileExists(t, dstPath)
+}
+
+func TestMoveFile_DstExists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "cur", "a")
+	test.CreateFile(t, srcPath, "abc")
+
+	// 移動先に同じ名前のファイルが既にある
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+	test.CreateFile(t, dstPath, "x")
+
+	// ACT
+	err := moveFile(srcPath, dstPath)
+
+	// ASSERT
+	require.ErrorIs(t, err, os.ErrExist)
+
+	// どちらも変更されていないこと
+	assert.Equal(t, "abc", test.ReadFile(t, srcPath))
+	assert.Equal(t, "x", test.ReadFile(t, dstPath))
+}
+
+func TestCopyAndRemove(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "new", "a")
+	test.CreateFile(t, srcPath, "abcdefg")
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.Local)
+	require.NoError(t, os.Chtimes(srcPath, modTime, modTime))
+
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+
+	// ACT
+	// 別デバイスを用意できないので、コピーでの移動を直接呼び出す
+	err := copyAndRemove(srcPath, dstPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, srcPath)
+	assert.Equal(t, "abcdefg", test.ReadFile(t, dstPath))
+
+	// 更新日時が引き継がれていること
+	dstInfo, err := os.Stat(dstPath)
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(dstInfo.ModTime()))
+
+	// tmpに残っていないこと
+	entries, err := os.ReadDir(filepath.Join(dstFolderPath, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCopyAndRemove_TmpExists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "new", "a")
+	test.CreateFile(t, srcPath, "abc")
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+
+	// tmpに同じ名前のファイルが既にある
+	tmpPath := filepath.Join(dstFolderPath, "tmp", "a")
+	test.CreateFile(t, tmpPath, "x")
+
+	// ACT
+	err := copyAndRemove(srcPath, dstPath)
+
+	// ASSERT
+	require.Error(t, err)
+
+	// 移動元は削除されていないこと
+	assert.Equal(t, "abc", test.ReadFile(t, srcPath))
+	assert.NoFileExists(t, dstPath)
+}
+
+func TestCopyAndRemove_DstExists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	srcFolderPath := test.CreateMailFolder(t, temp, "")
+	dstFolderPath := test.CreateMailFolder(t, temp, ".A")
+
+	srcPath := filepath.Join(srcFolderPath, "new", "a")
+	test.CreateFile(t, srcPath, "abc")
+
+	// 移動先に同じ名前のファイルが既にある
+	dstPath := filepath.Join(dstFolderPath, "cur", "a")
+	test.CreateFile(t, dstPath, "x")
+
+	// ACT
+	err := copyAndRemove(srcPath, dstPath)
+
+	// ASSERT
+	require.ErrorIs(t, err, os.ErrExist)
+
+	// どちらも変更されていないこと
+	assert.Equal(t, "abc", test.ReadFile(t, srcPath))
+	assert.Equal(t, "x", test.ReadFile(t, dstPath))
+
+	// tmpに残っていないこと
+	entries, err := os.ReadDir(filepath.Join(dstFolderPath, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,60 @@
+package action
+
+import (
+	"sort"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/quota"
+)
+
+// Maildir++ のクォータ(maildirsize)に反映する、メールボックス毎の増減
+type quotaDeltas map[string]*[2]int64 // ルートのパス -> サイズ, 件数
+
+func (d quotaDeltas) add(mails ...collector.Mail) {
+
+	for _, mail := range mails {
+		d.change(mailRootPath(mail), mail, 1)
+	}
+}
+
+func (d quotaDeltas) remove(mails ...collector.Mail) {
+
+	for _, mail := range mails {
+		d.change(mailRootPath(mail), mail, -1)
+	}
+}
+
+func (d quotaDeltas) change(rootPath string, mail collector.Mail, sign int64) {
+
+	delta := d[rootPath]
+	if delta == nil {
+		delta = &[2]int64{}
+		d[rootPath] = delta
+	}
+
+	delta[0] += sign * quota.MailSize(mail)
+	delta[1] += sign
+}
+
+func (d quotaDeltas) update() error {
+
+	rootPaths := []string{}
+	for rootPath := range d {
+		rootPaths = append(rootPaths, rootPath)
+	}
+	sort.Strings(rootPaths)
+
+	for _, rootPath := range rootPaths {
+		delta := d[rootPath]
+		if delta[0] == 0 && delta[1] == 0 {
+			// 同じメールボックス内での移動
+			continue
+		}
+
+		if err := quota.Update(rootPath, delta[0], delta[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
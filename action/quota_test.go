@@ -0,0 +1,139 @@
+package action
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/quota"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelete_UpdateQuota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	quotaPath := filepath.Join(temp, quota.FileName)
+	test.CreateFile(t, quotaPath, "1000S\n100 5\n")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a,S=10"),
+		createMailByName(t, temp, "A", "cur", "b"),
+	}
+
+	// ACT
+	_, err := Delete(temp, &targetMails, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// ファイル名のサイズ(S=)を優先して、減った分が追記される
+	assert.Equal(t, "1000S\n100 5\n-11 -2\n", test.ReadFile(t, quotaPath))
+}
+
+func TestDelete_NoQuota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+	}
+
+	// ACT
+	_, err := Delete(temp, &targetMails, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(temp, quota.FileName))
+}
+
+func TestArchiveWithConflictPolicy_UpdateQuota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+	quotaPath := filepath.Join(temp, quota.FileName)
+	test.CreateFile(t, quotaPath, "1000S\n100 5\n")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+		createMailByName(t, temp, "", "cur", "b"),
+	}
+
+	// 同じ内容のものがアーカイブ済み
+	createMailByName(t, temp, "Archived", "cur", "b")
+
+	// ACT
+	_, err := ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictDedupe, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 同じメールボックス内での移動は変わらず、重複で削除した分のみ減る
+	assert.Equal(t, "1000S\n100 5\n-1 -1\n", test.ReadFile(t, quotaPath))
+}
+
+func TestArchiveToRoot_UpdateQuota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	test.CreateFile(t, filepath.Join(maildirPath, "subscriptions"), "")
+	quotaPath := filepath.Join(maildirPath, quota.FileName)
+	test.CreateFile(t, quotaPath, "1000S\n100 5\n")
+
+	archiveRootPath := filepath.Join(temp, "Archive")
+	test.CreateDir(t, temp, "Archive")
+	archiveQuotaPath := filepath.Join(archiveRootPath, quota.FileName)
+	test.CreateFile(t, archiveQuotaPath, "0S\n0 0\n")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, maildirPath, "", "cur", "a"),
+		createMailByName(t, maildirPath, "A", "cur", "b"),
+	}
+
+	// ACT
+	_, err := ArchiveToRoot(archiveRootPath, &targetMails, archiveFolderNameGenerator(), ConflictRename, false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 移動元は減って、移動先は増える
+	assert.Equal(t, "1000S\n100 5\n-2 -2\n", test.ReadFile(t, quotaPath))
+	assert.Equal(t, "0S\n0 0\n2 2\n", test.ReadFile(t, archiveQuotaPath))
+}
+
+func TestUndo_UpdateQuota(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+	quotaPath := filepath.Join(temp, quota.FileName)
+	test.CreateFile(t, quotaPath, "1000S\n100 5\n")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "a"),
+		createMailByName(t, temp, "", "cur", "b"),
+	}
+	createMailByName(t, temp, "Archived", "cur", "b")
+
+	journalPath := filepath.Join(temp, "journal")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+	_, err = ArchiveWithConflictPolicy(temp, &targetMails, archiveFolderNameGenerator(), ConflictDedupe, false, journal)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// ACT
+	_, err = Undo(journalPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 重複で削除したものを戻した分だけ増える
+	assert.Equal(t, "1000S\n100 5\n-1 -1\n1 1\n", test.ReadFile(t, quotaPath))
+}
@@ -0,0 +1,269 @@
+package action
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/folder"
+)
+
+// アーカイブ時に元のフォルダを記録するファイル (アーカイブフォルダ毎)
+const OriginsFileName = "maildir-cleaner-origins"
+
+type mailOrigin struct {
+	Name   string `json:"name"`   // フラグを除いたファイル名
+	Folder string `json:"folder"` // 元のフォルダ名
+}
+
+// 元のフォルダに戻す
+type RestoreFolderNameGenerator struct {
+	folderNames map[string]string // メールのパス -> 元のフォルダ名
+}
+
+func NewRestoreFolderNameGenerator(mails *[]collector.Mail, archiveFolderBaseName string) (*RestoreFolderNameGenerator, error) {
+
+	folderNames := map[string]string{}
+	folderOrigins := map[string]map[string]string{} // アーカイブフォルダのパス -> 記録
+
+	for _, mail := range *mails {
+		archiveFolderPath := filepath.Dir(filepath.Dir(mail.FullPath))
+
+		origins, found := folderOrigins[archiveFolderPath]
+		if !found {
+			var err error
+			origins, err = readOrigins(archiveFolderPath)
+			if err != nil {
+				return nil, err
+			}
+			folderOrigins[archiveFolderPath] = origins
+		}
+
+		if folderName, found := origins[mailUniqueName(mail.FileName)]; found {
+			folderNames[mail.FullPath] = folderName
+			continue
+		}
+
+		// 記録が無い場合は、keepパターンとしてアーカイブフォルダ名から元のフォルダを求める
+		switch {
+		case mail.FolderName == archiveFolderBaseName:
+			folderNames[mail.FullPath] = ""
+		case strings.HasPrefix(mail.FolderName, archiveFolderBaseName+"."):
+			folderNames[mail.FullPath] = mail.FolderName[len(archiveFolderBaseName)+1:]
+		default:
+			return nil, fmt.Errorf("original folder of %s is unknown", mail.FullPath)
+		}
+	}
+
+	return &RestoreFolderNameGenerator{
+		folderNames: folderNames,
+	}, nil
+}
+
+func (g *RestoreFolderNameGenerator) Generate(mail collector.Mail) string {
+	return g.folderNames[mail.FullPath]
+}
+
+func (g *RestoreFolderNameGenerator) BaseName() string {
+	return ""
+}
+
+// 全て指定したフォルダに戻す
+type FixedFolderNameGenerator struct {
+	FolderName string
+}
+
+func (g *FixedFolderNameGenerator) Generate(mail collector.Mail) string {
+	return g.FolderName
+}
+
+func (g *FixedFolderNameGenerator) BaseName() string {
+	return g.FolderName
+}
+
+func Restore(rootMailFolderPath string, mails *[]collector.Mail, restoreFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy) (*ArchiveResult, error) {
+
+	// 移動先が元のフォルダとなるだけで、アーカイブと同じ (元のフォルダは記録しない)
+	result, err := archiveMails(rootMailFolderPath, mails, restoreFolderNameGenerator, onConflict, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 戻したものは記録から除く
+	if err := pruneOrigins(*result.SourceMails); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func PlanRestore(rootMailFolderPath string, mails *[]collector.Mail, restoreFolderNameGenerator ArchiveFolderNameGenerator, onConflict ConflictPolicy) (*ArchivePlan, error) {
+
+	return PlanArchive(rootMailFolderPath, mails, restoreFolderNameGenerator, onConflict)
+}
+
+func recordOrigin(archivedMail collector.Mail, originalFolderName string) error {
+
+	originsPath := filepath.Join(filepath.Dir(filepath.Dir(archivedMail.FullPath)), OriginsFileName)
+
+	found, err := exists(originsPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(originsPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(mailOrigin{
+		Name:   mailUniqueName(archivedMail.FileName),
+		Folder: originalFolderName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if !found {
+		// オーナーをアーカイブフォルダと同じに
+		return folder.ChownInherited(originsPath)
+	}
+	return nil
+}
+
+func recordOriginIfMissing(archivedMail collector.Mail, originalFolderName string) error {
+
+	// 既に記録されているものは、そちらが本来の元のフォルダなので上書きしない
+	origins, err := readOrigins(filepath.Dir(filepath.Dir(archivedMail.FullPath)))
+	if err != nil {
+		return err
+	}
+	if _, found := origins[mailUniqueName(archivedMail.FileName)]; found {
+		return nil
+	}
+
+	return recordOrigin(archivedMail, originalFolderName)
+}
+
+// アーカイブフォルダから無くなったメールの記録を削除
+func pruneOrigins(archivedMails []collector.Mail) error {
+
+	archiveFolderPaths := []string{}
+	folderNames := map[string]map[string]bool{} // アーカイブフォルダのパス -> 削除する記録
+	for _, archivedMail := range archivedMails {
+		archiveFolderPath := filepath.Dir(filepath.Dir(archivedMail.FullPath))
+		if _, found := folderNames[archiveFolderPath]; !found {
+			archiveFolderPaths = append(archiveFolderPaths, archiveFolderPath)
+			folderNames[archiveFolderPath] = map[string]bool{}
+		}
+		folderNames[archiveFolderPath][mailUniqueName(archivedMail.FileName)] = true
+	}
+
+	for _, archiveFolderPath := range archiveFolderPaths {
+		if err := removeOrigins(archiveFolderPath, folderNames[archiveFolderPath]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeOrigins(archiveFolderPath string, names map[string]bool) error {
+
+	originsPath := filepath.Join(archiveFolderPath, OriginsFileName)
+
+	data, err := os.ReadFile(originsPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+	removed := false
+	for _, line := range strings.Split(string(data), "\n") {
+		var origin mailOrigin
+		if err := json.Unmarshal([]byte(line), &origin); err != nil {
+			// 書き込み途中で中断された行も除く
+			removed = removed || line != ""
+			continue
+		}
+		if names[origin.Name] {
+			removed = true
+			continue
+		}
+		lines = append(lines, line+"\n")
+	}
+
+	if !removed {
+		return nil
+	}
+	if len(lines) == 0 {
+		return os.Remove(originsPath)
+	}
+
+	// 書き込み途中で中断されても記録が失われないように、別の名前で書き込んでから置き換え
+	tmpPath := originsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(lines, "")), 0666); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := folder.ChownInherited(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, originsPath)
+}
+
+func readOrigins(archiveFolderPath string) (map[string]string, error) {
+
+	origins := map[string]string{}
+
+	file, err := os.Open(filepath.Join(archiveFolderPath, OriginsFileName))
+	if os.IsNotExist(err) {
+		// 記録する前にアーカイブされたもの
+		return origins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var origin mailOrigin
+		if err := json.Unmarshal(scanner.Bytes(), &origin); err != nil {
+			// 書き込み途中で中断された行は無視
+			continue
+		}
+
+		// 同じメールが何度かアーカイブされた場合は最後のものを
+		origins[origin.Name] = origin.Folder
+	}
+
+	return origins, scanner.Err()
+}
+
+func mailUniqueName(fileName string) string {
+
+	// フラグ(":2,"以降)は既読などで変わるので除く
+	index := strings.LastIndex(fileName, ":2,")
+	if index == -1 {
+		return fileName
+	}
+	return fileName[:index]
+}
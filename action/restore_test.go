@@ -0,0 +1,207 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestore_Year(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "A\n")
+
+	sourceMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2021, 1),
+		createMailByYearMonth(t, temp, "A", "new", 2021, 2),
+		createMailByYearMonth(t, temp, "A", "cur", 2022, 3),
+	}
+
+	// 元のフォルダが記録されるようにアーカイブしておく
+	archivedMails, err := Archive(temp, &sourceMails, &YearArchiveFolderNameGenerator{ArchiveFolderBaseName: "Archived"})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2021", OriginsFileName))
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2022", OriginsFileName))
+
+	// アーカイブ後にフラグが変わったもの
+	flaggedMail := (*archivedMails)[1]
+	flaggedMail.FileName += ":2,S"
+	flaggedMail.FullPath += ":2,S"
+	require.NoError(t, os.Rename((*archivedMails)[1].FullPath, flaggedMail.FullPath))
+	(*archivedMails)[1] = flaggedMail
+
+	// 元のフォルダは削除されていても、作成し直されること
+	require.NoError(t, os.RemoveAll(filepath.Join(temp, ".A")))
+
+	restoreFolderNameGenerator, err := NewRestoreFolderNameGenerator(archivedMails, "Archived")
+	require.NoError(t, err)
+
+	// ACT
+	result, err := Restore(temp, archivedMails, restoreFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, len(*result.ArchivedMails))
+	for i, sourceMail := range sourceMails {
+		restoredMail := (*result.ArchivedMails)[i]
+		assert.Equal(t, sourceMail.FolderName, restoredMail.FolderName)
+		assert.Equal(t, filepath.Dir(sourceMail.FullPath), filepath.Dir(restoredMail.FullPath))
+		assert.FileExists(t, restoredMail.FullPath)
+		assert.NoFileExists(t, (*archivedMails)[i].FullPath)
+	}
+
+	// フラグは戻した後も保持
+	assert.Equal(t, flaggedMail.FileName, (*result.ArchivedMails)[1].FileName)
+
+	// 戻した際には記録しないこと
+	assert.NoFileExists(t, filepath.Join(temp, OriginsFileName))
+	assert.NoFileExists(t, filepath.Join(temp, ".A", OriginsFileName))
+	assert.Equal(t, "A\nArchived\nArchived.2021\nArchived.2022\n", test.ReadFile(t, filepath.Join(temp, "subscriptions")))
+}
+
+func TestRestore_PruneOrigins(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	sourceMails := []collector.Mail{
+		createMailByName(t, temp, "A", "cur", "a"),
+		createMailByName(t, temp, "B", "cur", "b"),
+	}
+
+	archivedMails, err := Archive(temp, &sourceMails, &FixedFolderNameGenerator{FolderName: "Archived"})
+	require.NoError(t, err)
+
+	restoreMails := []collector.Mail{(*archivedMails)[0]}
+	restoreFolderNameGenerator, err := NewRestoreFolderNameGenerator(&restoreMails, "Archived")
+	require.NoError(t, err)
+
+	// ACT
+	_, err = Restore(temp, &restoreMails, restoreFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.FileExists(t, sourceMails[0].FullPath)
+
+	// 戻したものは記録から除かれること
+	originsPath := filepath.Join(temp, ".Archived", OriginsFileName)
+	assert.Equal(t, "{\"name\":\"b\",\"folder\":\"B\"}\n", test.ReadFile(t, originsPath))
+
+	// 全て戻した場合はファイルごと削除されること
+	restoreMails = []collector.Mail{(*archivedMails)[1]}
+	restoreFolderNameGenerator, err = NewRestoreFolderNameGenerator(&restoreMails, "Archived")
+	require.NoError(t, err)
+	_, err = Restore(temp, &restoreMails, restoreFolderNameGenerator, ConflictRename)
+	require.NoError(t, err)
+	assert.NoFileExists(t, originsPath)
+}
+
+func TestRestore_KeepNotRecorded(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Archived\nArchived.A\n")
+	test.CreateMailFolder(t, temp, "")
+
+	// 記録される前にアーカイブされたもの
+	archivedMails := []collector.Mail{
+		createMailByName(t, temp, "Archived", "cur", "a"),
+		createMailByName(t, temp, "Archived.A", "cur", "b"),
+		createMailByName(t, temp, "Archived.A.B", "new", "c"),
+	}
+
+	restoreFolderNameGenerator, err := NewRestoreFolderNameGenerator(&archivedMails, "Archived")
+	require.NoError(t, err)
+
+	// ACT
+	result, err := Restore(temp, &archivedMails, restoreFolderNameGenerator, ConflictRename)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// keepパターンとして元のフォルダに
+	assert.Equal(t, []collector.Mail{
+		restoredMail(archivedMails[0], "", filepath.Join(temp, "cur", "a")),
+		restoredMail(archivedMails[1], "A", filepath.Join(temp, ".A", "cur", "b")),
+		restoredMail(archivedMails[2], "A.B", filepath.Join(temp, ".A.B", "new", "c")),
+	}, *result.ArchivedMails)
+
+	for _, mail := range *result.ArchivedMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestRestore_OriginUnknown(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// アーカイブフォルダ名から元のフォルダが分からないもの
+	archivedMails := []collector.Mail{
+		createMailByName(t, temp, "Old", "cur", "a"),
+	}
+
+	// ACT
+	_, err := NewRestoreFolderNameGenerator(&archivedMails, "Archived")
+
+	// ASSERT
+	require.EqualError(t, err, "original folder of "+archivedMails[0].FullPath+" is unknown")
+}
+
+func TestPlanRestore(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Archived.2021\n")
+
+	archivedMails := []collector.Mail{
+		createMailByName(t, temp, "Archived.2021", "cur", "a"),
+		createMailByName(t, temp, "Archived.2021", "cur", "b"),
+	}
+
+	// 戻し先に同じ名前のもの
+	existsMail := createMailByName(t, temp, "X", "cur", "b")
+
+	// ACT
+	plan, err := PlanRestore(temp, &archivedMails, &FixedFolderNameGenerator{FolderName: "X"}, ConflictSkip)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"X"}, plan.SubscribeFolderNames)
+	assert.Equal(t, []Conflict{
+		{Mail: archivedMails[1], ExistingPath: existsMail.FullPath, Resolution: ResolutionSkipped},
+	}, plan.Conflicts)
+
+	// 実際には移動されていないこと
+	for _, mail := range archivedMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestMailUniqueName(t *testing.T) {
+
+	// ACT
+	withFlags := mailUniqueName("1674617693.M958571P8888.localhost:2,FS")
+	withoutFlags := mailUniqueName("1674617693.M958571P8888.localhost")
+
+	// ASSERT
+	assert.Equal(t, "1674617693.M958571P8888.localhost", withFlags)
+	assert.Equal(t, "1674617693.M958571P8888.localhost", withoutFlags)
+}
+
+func restoredMail(mail collector.Mail, folderName string, fullPath string) collector.Mail {
+
+	mail.FolderName = folderName
+	mail.FullPath = fullPath
+	return mail
+}
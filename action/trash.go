@@ -0,0 +1,188 @@
+package action
+
+import (
+	"path/filepath"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/folder"
+)
+
+// 実施した場合、メールは成功したもののみ
+type TrashPlan struct {
+	MovedMails           *[]collector.Mail     // ゴミ箱に移動するメール(移動前)
+	TrashedMails         *[]collector.Mail     // ゴミ箱に移動した後のメール
+	DeletedMails         *[]collector.Mail     // 既にゴミ箱にあるため削除するメール
+	CreateFolderNames    []string              // 新たに作成されるフォルダ
+	SubscribeFolderNames []string              // 新たに購読されるフォルダ
+	Conflicts            []Conflict            // 名前が重複したもの(新たな名前で移動)
+	Failures             []collector.MailError // keepGoingで、エラーとなったもの
+}
+
+func MoveToTrash(rootMailFolderPath string, mails *[]collector.Mail, trashFolderName string, keepGoing bool, journal *Journal) (*TrashPlan, error) {
+
+	// 名前の重複は、移動する際に確認
+	plan, err := planMoveToTrash(rootMailFolderPath, mails, trashFolderName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*plan.MovedMails) != 0 {
+		if _, err := folder.Setup(rootMailFolderPath, trashFolderName); err != nil {
+			return nil, err
+		}
+
+		movedMails := []collector.Mail{}
+		trashedMails := []collector.Mail{}
+		conflicts := []Conflict{}
+		for i, mail := range *plan.MovedMails {
+			trashedMail := (*plan.TrashedMails)[i]
+			conflict, err := moveMailToTrash(mail, &trashedMail, journal)
+			if err != nil {
+				if canKeepGoing(err, keepGoing) {
+					plan.Failures = append(plan.Failures, newMailError(mail, err))
+					continue
+				}
+				return nil, err
+			}
+			movedMails = append(movedMails, mail)
+			trashedMails = append(trashedMails, trashedMail)
+			if conflict != nil {
+				conflicts = append(conflicts, *conflict)
+			}
+		}
+		plan.MovedMails = &movedMails
+		plan.TrashedMails = &trashedMails
+		plan.Conflicts = conflicts
+	}
+
+	failures, err := Delete(rootMailFolderPath, plan.DeletedMails, keepGoing, journal)
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) != 0 {
+		plan.DeletedMails = ExcludeFailures(plan.DeletedMails, failures)
+		plan.Failures = append(plan.Failures, failures...)
+	}
+
+	return plan, nil
+}
+
+func moveMailToTrash(mail collector.Mail, trashedMail *collector.Mail, journal *Journal) (*Conflict, error) {
+
+	// ゴミ箱にあるものを置き換えないように、同じ名前のものがあれば新たな名前で移動
+	found, err := exists(trashedMail.FullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflict *Conflict
+	if found {
+		conflict = &Conflict{
+			Mail:         mail,
+			ExistingPath: trashedMail.FullPath,
+			Resolution:   ResolutionRenamed,
+		}
+		trashedMail.FileName = uniqueFileName(filepath.Dir(trashedMail.FullPath), trashedMail.FileName)
+		trashedMail.FullPath = filepath.Join(filepath.Dir(trashedMail.FullPath), trashedMail.FileName)
+	}
+
+	err = journal.record(OperationTrash, mail, trashedMail.FullPath, func() error {
+		return moveFile(mail.FullPath, trashedMail.FullPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflict, nil
+}
+
+func PlanMoveToTrash(rootMailFolderPath string, mails *[]collector.Mail, trashFolderName string) (*TrashPlan, error) {
+
+	// 実際には移動せずに、ゴミ箱に移動した場合の結果を返す
+	plan, err := planMoveToTrash(rootMailFolderPath, mails, trashFolderName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 既存のファイルだけでなく、先に移動するメールとの重複も
+	plannedPaths := map[string]bool{}
+	for i, mail := range *plan.MovedMails {
+		trashedMail := (*plan.TrashedMails)[i]
+
+		found := plannedPaths[trashedMail.FullPath]
+		if !found {
+			found, err = exists(trashedMail.FullPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if found {
+			plan.Conflicts = append(plan.Conflicts, Conflict{
+				Mail:         mail,
+				ExistingPath: trashedMail.FullPath,
+				Resolution:   ResolutionRenamed,
+			})
+			continue
+		}
+		plannedPaths[trashedMail.FullPath] = true
+	}
+
+	return plan, nil
+}
+
+func planMoveToTrash(rootMailFolderPath string, mails *[]collector.Mail, trashFolderName string) (*TrashPlan, error) {
+
+	movedMails := []collector.Mail{}
+	trashedMails := []collector.Mail{}
+	deletedMails := []collector.Mail{}
+
+	trashFolderPath, err := folder.MailFolderPath(rootMailFolderPath, trashFolderName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mail := range *mails {
+		if collector.MatchFolder(mail.FolderName, []string{trashFolderName}) {
+			// ゴミ箱(サブフォルダ含む)にあるものは本当に削除
+			deletedMails = append(deletedMails, mail)
+			continue
+		}
+
+		movedMails = append(movedMails, mail)
+		trashedMails = append(trashedMails, *toTrashedMail(mail, trashFolderPath, trashFolderName))
+	}
+
+	plan := &TrashPlan{
+		MovedMails:           &movedMails,
+		TrashedMails:         &trashedMails,
+		DeletedMails:         &deletedMails,
+		CreateFolderNames:    []string{},
+		SubscribeFolderNames: []string{},
+		Conflicts:            []Conflict{},
+		Failures:             []collector.MailError{},
+	}
+
+	if len(movedMails) != 0 {
+		setupPlan, err := folder.PlanSetup(rootMailFolderPath, trashFolderName)
+		if err != nil {
+			return nil, err
+		}
+		plan.CreateFolderNames = setupPlan.CreateFolderNames
+		plan.SubscribeFolderNames = setupPlan.SubscribeFolderNames
+	}
+
+	return plan, nil
+}
+
+func toTrashedMail(mail collector.Mail, trashFolderPath string, trashFolderName string) *collector.Mail {
+
+	// フラグを付けられるのはcurのみなので、newにあったものもcurに
+	trashedMail := mail
+	trashedMail.FileName = collector.AddMailFlag(mail.FileName, 'T')
+	trashedMail.SubDirName = "cur"
+	trashedMail.FullPath = filepath.Join(trashFolderPath, trashedMail.SubDirName, trashedMail.FileName)
+	trashedMail.FolderName = trashFolderName
+	trashedMail.Flags.Trashed = true
+
+	return &trashedMail
+}
@@ -0,0 +1,196 @@
+package action
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveToTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+
+	movedMails := []collector.Mail{
+		createMailByName(t, temp, "", "new", "a"),
+		createMailByName(t, temp, "", "cur", "b:2,S"),
+		createMailByName(t, temp, "A", "cur", "c:2,FS"),
+	}
+	deletedMails := []collector.Mail{
+		createMailByName(t, temp, "Trash", "cur", "d:2,ST"),
+		createMailByName(t, temp, "Trash.X", "new", "e"),
+	}
+
+	targetMails := append(append([]collector.Mail{}, movedMails...), deletedMails...)
+
+	// ACT
+	plan, err := MoveToTrash(temp, &targetMails, "Trash", false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, movedMails, *plan.MovedMails)
+	assert.Equal(t, deletedMails, *plan.DeletedMails)
+
+	// Tフラグを付けてゴミ箱のcurに移動
+	trashFolderPath := filepath.Join(temp, ".Trash")
+	expectedFileNames := []string{"a:2,T", "b:2,ST", "c:2,FST"}
+	for i, mail := range movedMails {
+		assert.NoFileExists(t, mail.FullPath)
+
+		trashedMail := (*plan.TrashedMails)[i]
+		assert.Equal(t, filepath.Join(trashFolderPath, "cur", expectedFileNames[i]), trashedMail.FullPath)
+		assert.Equal(t, "Trash", trashedMail.FolderName)
+		assert.Equal(t, "cur", trashedMail.SubDirName)
+		assert.True(t, trashedMail.Flags.Trashed)
+		assert.FileExists(t, trashedMail.FullPath)
+	}
+
+	// 元々ゴミ箱にあったものは削除
+	for _, mail := range deletedMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+
+	assert.Equal(t, "A\nTrash\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestMoveToTrash_Conflict(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Trash\n")
+
+	// ゴミ箱に同じ名前のものが既にある
+	existingMail := createMailByName(t, temp, "Trash", "cur", "1600000000.a:2,ST")
+	test.CreateFile(t, existingMail.FullPath, "existing")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "cur", "1600000000.a:2,S"),
+		createMailByName(t, temp, "A", "cur", "1600000000.b:2,S"),
+	}
+	test.CreateFile(t, targetMails[0].FullPath, "moved")
+
+	// ACT
+	plan, err := MoveToTrash(temp, &targetMails, "Trash", false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, targetMails, *plan.MovedMails)
+
+	// 既にあるものは置き換えずに、新たな名前で移動
+	assert.Equal(t, "existing", test.ReadFile(t, existingMail.FullPath))
+	renamedMail := (*plan.TrashedMails)[0]
+	assert.NotEqual(t, existingMail.FullPath, renamedMail.FullPath)
+	assert.Regexp(t, `^1600000000\.M\d+P\d+Q\d+\..+:2,ST$`, renamedMail.FileName)
+	assert.Equal(t, "moved", test.ReadFile(t, renamedMail.FullPath))
+	assert.FileExists(t, (*plan.TrashedMails)[1].FullPath)
+
+	assert.Equal(t, []Conflict{
+		{Mail: targetMails[0], ExistingPath: existingMail.FullPath, Resolution: ResolutionRenamed},
+	}, plan.Conflicts)
+}
+
+func TestMoveToTrash_OnlyTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ゴミ箱のメールのみの場合は、subscriptionsが無くても削除できる
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "Trash", "cur", "a:2,ST"),
+	}
+
+	// ACT
+	plan, err := MoveToTrash(temp, &targetMails, "Trash", false, nil)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Empty(t, *plan.MovedMails)
+	assert.Equal(t, targetMails, *plan.DeletedMails)
+	assert.NoFileExists(t, targetMails[0].FullPath)
+}
+
+func TestPlanMoveToTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "A", "new", "a"),
+		createMailByName(t, temp, "Trash", "cur", "b:2,ST"),
+	}
+
+	// ACT
+	plan, err := PlanMoveToTrash(temp, &targetMails, "Trash")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []collector.Mail{targetMails[0]}, *plan.MovedMails)
+	assert.Equal(t, filepath.Join(temp, ".Trash", "cur", "a:2,T"), (*plan.TrashedMails)[0].FullPath)
+	assert.Equal(t, []collector.Mail{targetMails[1]}, *plan.DeletedMails)
+	assert.Equal(t, []string{}, plan.CreateFolderNames) // ゴミ箱のメールを作る際にフォルダは作成済み
+	assert.Equal(t, []string{"Trash"}, plan.SubscribeFolderNames)
+
+	// 実際には移動/削除されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	assert.Equal(t, "A\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestPlanMoveToTrash_Conflict(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Trash\n")
+
+	existingMail := createMailByName(t, temp, "Trash", "cur", "a:2,T")
+
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "", "new", "a"),      // ゴミ箱に既にあるものと重複
+		createMailByName(t, temp, "A", "cur", "b:2,S"), // 重複しない
+		createMailByName(t, temp, "B", "cur", "b:2,S"), // 先に移動するものと重複
+	}
+
+	// ACT
+	plan, err := PlanMoveToTrash(temp, &targetMails, "Trash")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []Conflict{
+		{Mail: targetMails[0], ExistingPath: existingMail.FullPath, Resolution: ResolutionRenamed},
+		{Mail: targetMails[2], ExistingPath: filepath.Join(temp, ".Trash", "cur", "b:2,ST"), Resolution: ResolutionRenamed},
+	}, plan.Conflicts)
+}
+
+func TestMoveToTrash_SubscriptionsNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// subscriptions無し
+	targetMails := []collector.Mail{
+		createMailByName(t, temp, "A", "new", "a"),
+	}
+
+	// ACT
+	_, err := MoveToTrash(temp, &targetMails, "Trash", false, nil)
+
+	// ASSERT
+	require.EqualError(t, err, "subscriptions file not found: currently only dovecot is supported")
+	assert.FileExists(t, targetMails[0].FullPath)
+}
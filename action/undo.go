@@ -0,0 +1,160 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+)
+
+type UndoResult struct {
+	Entries       []JournalEntry    // 元に戻した操作 (新しいものから順に)
+	RestoredMails *[]collector.Mail // 元に戻したメール(Entriesと同じ順)
+	Skipped       []UndoSkipped     // 元に戻せなかった操作
+}
+
+type UndoSkipped struct {
+	Entry  JournalEntry
+	Reason string
+}
+
+// ジャーナルに記録された操作を新しいものから順に元に戻す
+func Undo(journalPath string) (*UndoResult, error) {
+
+	return undo(journalPath, false)
+}
+
+func PlanUndo(journalPath string) (*UndoResult, error) {
+
+	// 実際には戻さずに、戻した場合の結果を返す
+	return undo(journalPath, true)
+}
+
+func undo(journalPath string, dryRun bool) (*UndoResult, error) {
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UndoResult{
+		Entries:       []JournalEntry{},
+		RestoredMails: &[]collector.Mail{},
+		Skipped:       []UndoSkipped{},
+	}
+
+	undone := map[JournalEntry]bool{}
+	deltas := quotaDeltas{}
+	movedBackMails := []collector.Mail{} // アーカイブフォルダから戻したもの
+	for i := len(entries) - 1; i >= 0; i-- {
+		// 完了が記録されていないものも、ファイルの状態から判断して戻す
+		entry := entries[i]
+		if entry.Status != JournalStarted || undone[entry.withoutStatus()] {
+			continue
+		}
+		undone[entry.withoutStatus()] = true
+
+		reason, err := undoEntry(entry, dryRun)
+		if err != nil {
+			// 途中まで戻した分は反映しておく
+			deltas.update()
+			pruneOrigins(movedBackMails)
+			return nil, err
+		}
+
+		if reason != "" {
+			result.Skipped = append(result.Skipped, UndoSkipped{Entry: entry, Reason: reason})
+			continue
+		}
+
+		result.Entries = append(result.Entries, entry)
+		*result.RestoredMails = append(*result.RestoredMails, entry.mail())
+
+		if !dryRun {
+			// 別のメールボックスから戻した場合や、重複で削除したものを戻した場合にクォータが変わる
+			deltas.add(entry.mail())
+			if entry.Operation != OperationDedupe {
+				// 移動先はアーカイブフォルダかゴミ箱なので、ルート以外のフォルダ
+				destinationRootPath := filepath.Dir(filepath.Dir(filepath.Dir(entry.Destination)))
+				deltas.change(destinationRootPath, collector.Mail{FileName: filepath.Base(entry.Destination), Size: entry.Size}, -1)
+			}
+			if entry.Operation == OperationArchive {
+				movedBackMails = append(movedBackMails, collector.Mail{FullPath: entry.Destination, FileName: filepath.Base(entry.Destination)})
+			}
+		}
+	}
+
+	if err := deltas.update(); err != nil {
+		return nil, err
+	}
+	if err := pruneOrigins(movedBackMails); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func undoEntry(entry JournalEntry, dryRun bool) (string, error) {
+
+	if entry.Operation == OperationDelete {
+		return "deleted mail cannot be restored", nil
+	}
+
+	srcFound, err := exists(entry.Source)
+	if err != nil {
+		return "", err
+	}
+	if srcFound {
+		// 既に戻されている
+		return "source already exists", nil
+	}
+
+	dstFound, err := exists(entry.Destination)
+	if err != nil {
+		return "", err
+	}
+	if !dstFound {
+		// 移動先でフラグが変わった、さらに移動されたなど
+		return "destination not found", nil
+	}
+
+	if dryRun {
+		return "", nil
+	}
+
+	if _, err := setupFolder(mailRootPath(entry.mail()), entry.Folder); err != nil {
+		return "", err
+	}
+
+	if entry.Operation == OperationDedupe {
+		// 同じ内容のものを残して削除したので、残したものからコピー
+		return "", copyBack(entry.Destination, entry.Source)
+	}
+
+	return "", moveFile(entry.Destination, entry.Source)
+}
+
+func mailRootPath(mail collector.Mail) string {
+
+	// <root>/cur/<mail> または <root>/.<folder>/cur/<mail>
+	folderPath := filepath.Dir(filepath.Dir(mail.FullPath))
+	if mail.FolderName == "" {
+		return folderPath
+	}
+	return filepath.Dir(folderPath)
+}
+
+func copyBack(srcPath string, dstPath string) error {
+
+	tmpPath := filepath.Join(filepath.Dir(filepath.Dir(dstPath)), "tmp", filepath.Base(dstPath))
+
+	if err := copyAndVerify(srcPath, tmpPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/onozaty/maildir-cleaner/action"
 	"github.com/onozaty/maildir-cleaner/collector"
@@ -17,95 +18,252 @@ func newArchiveCmd() *cobra.Command {
 		Short: "Archive old mails",
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			maildirPath, _ := cmd.Flags().GetString("dir")
-			age, _ := cmd.Flags().GetInt64("age")
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
 
 			archiveFolderNameGenerator, err := newArchiveFolderNameGenerator(cmd.Flags())
 			if err != nil { // 許可されていなパラメータの可能性あり
 				return err
 			}
 
-			excludeFolderNames, _ := cmd.Flags().GetStringArray("exclude-folder")
+			if err := requireAgeOr(cmd.Flags(), "target-size", "keep-last"); err != nil {
+				return err
+			}
+
+			condition, err := newCondition(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			condition.KeepGoing, _ = cmd.Flags().GetBool("keep-going")
+
+			targetSizeOption, err := newTargetSizeOption(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			onConflictValue, _ := cmd.Flags().GetString("on-conflict")
+			onConflict, err := action.ParseConflictPolicy(onConflictValue)
+			if err != nil {
+				return err
+			}
+
+			archiveRootPath, _ := cmd.Flags().GetString("archive-root")
+			if archiveRootPath != "" && maildirTargets.Multiple {
+				// ユーザ毎に別のアーカイブ先となるべきなので
+				return fmt.Errorf("--archive-root can only be used with --dir")
+			}
+			if targetSizeOption != nil && archiveRootPath == "" {
+				// 同じmaildir内のアーカイブフォルダに移動してもサイズが減らない
+				return fmt.Errorf("--target-size can only be used with --archive-root")
+			}
+
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			journal, err := openJournal(cmd.Flags(), output.Progress)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
 
 			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
 			cmd.SilenceUsage = true
 
-			return runArchive(
-				maildirPath,
-				age,
-				archiveFolderNameGenerator,
-				excludeFolderNames,
-				cmd.OutOrStdout())
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runArchive(
+					maildirPath,
+					*condition,
+					targetSizeOption,
+					archiveFolderNameGenerator,
+					archiveRootPath,
+					onConflict,
+					dryRun,
+					journal,
+					writer,
+					output.isTable())
+			})
 		},
 	}
 
-	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
-	subCmd.MarkFlagRequired("dir")
+	addMaildirFlags(subCmd)
 	subCmd.Flags().Int64P("age", "a", 0, "The number of age days to be archived.\nIf you specify 10, mail that has been in the mailbox for more than 10 days since its arrival will be archived.")
-	subCmd.MarkFlagRequired("age")
+	addTargetSizeFlags(subCmd.Flags())
 
 	subCmd.Flags().StringP("archive-folder", "", "Archived", "Archive folder name.")
-	subCmd.Flags().StringP("archive-pattern", "", "keep", "Archive pattern. can be specified: keep, year, month")
-	subCmd.Flags().StringArrayP("exclude-folder", "", []string{}, "The name of the folder to exclude.")
+	subCmd.Flags().StringP("archive-pattern", "", "keep", "Archive pattern. can be specified: keep, year, month, template")
+	subCmd.Flags().StringP("archive-template", "", "", "Template of the archive folder name. (used with --archive-pattern template)\ne.g. '{{.Base}}.{{.Year}}.{{.Folder}}'")
+	subCmd.Flags().StringP("archive-root", "", "", "Path of another maildir to archive into. (created if it does not exist)\nIf not specified, archive into the target maildir.")
+	addConditionFlags(subCmd.Flags())
+	subCmd.Flags().StringP("on-conflict", "", string(action.ConflictRename), "How to handle a mail with the same name already in the archive folder. can be specified: skip, rename, fail, dedupe\ndedupe deletes the mail if the contents are the same, otherwise renames it.")
+	subCmd.Flags().BoolP("dry-run", "", false, "Show how the mails would be archived without actually archiving them.")
+	addJournalFlags(subCmd.Flags())
+	addKeepGoingFlag(subCmd.Flags())
+	addOutputFlag(subCmd.Flags())
 
 	return subCmd
 }
 
-func runArchive(maildirPath string, age int64, archiveFolderNameGenerator action.ArchiveFolderNameGenerator, excludeFolderNames []string, writer io.Writer) error {
+func runArchive(maildirPath string, condition collector.Condition, targetSizeOption *targetSizeOption, archiveFolderNameGenerator action.ArchiveFolderNameGenerator, archiveRootPath string, onConflict action.ConflictPolicy, dryRun bool, journal *action.Journal, writer io.Writer, renderTable bool) (*report, error) {
 
 	// 対象のメールを収集
-	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d\n", maildirPath, age)
-	collector := collector.NewCollector(
-		age,
-		// アーカイブフォルダも対象外に
-		append(excludeFolderNames, archiveFolderNameGenerator.BaseName())...)
+	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d%s\n", maildirPath, condition.AgeOfDays, targetSizeOption)
+
+	// アーカイブフォルダも対象外に
+	// (複数のmaildirで並列に処理されるので、元のスライスは変更しないように)
+	condition.ExcludeFolderNames = append(
+		append([]string{}, condition.ExcludeFolderNames...),
+		archiveFolderNameGenerator.BaseName())
+	collector := collector.NewConditionCollector(condition)
 	mails, err := collector.Collect(maildirPath)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+	failures := collector.Failures() // --keep-going で読み込めなかったもの
+
+	var targetSize *targetSizeReport
+	if targetSizeOption != nil {
+		// 目標サイズになるまでのメールに絞る (アーカイブフォルダはメールボックスのサイズに含めない)
+		mails, targetSize, err = selectByTargetSize(maildirPath, mails, condition, targetSizeOption, writer)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if len(*mails) == 0 {
 		// アーカイブ対象無し
 		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
-		return nil
+		renderFreedSize(writer, targetSize, mails, failures, dryRun)
+		renderFailures(writer, failures, renderTable)
+
+		report := &report{TargetSize: targetSize}
+		report.addFailures("", failures)
+		return report, nil
 	}
 
 	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
-	renderTargetMails(writer, mails)
+	if renderTable {
+		renderTargetMails(writer, mails)
+	}
+
+	if dryRun {
+		// アーカイブした場合の内容を表示するのみ
+		var plan *action.ArchivePlan
+		if archiveRootPath == "" {
+			plan, err = action.PlanArchive(maildirPath, mails, archiveFolderNameGenerator, onConflict)
+		} else {
+			plan, err = action.PlanArchiveToRoot(archiveRootPath, mails, archiveFolderNameGenerator, onConflict)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be archived as listed below.\n")
+		if renderTable {
+			renderArchiveFolders(writer, mails, plan.ArchivedMails)
+		}
+		renderArchivePlan(writer, mails, plan)
+		renderConflicts(writer, plan.Conflicts)
+		renderFreedSize(writer, targetSize, mails, failures, dryRun)
+		renderFailures(writer, failures, renderTable)
+
+		report := newReport("", "", mails)
+		report.addArchivedMails("", mails, plan.ArchivedMails)
+		report.addConflicts("", plan.Conflicts)
+		report.TargetSize = targetSize
+		report.addFailures("", failures)
+		return report, nil
+	}
 
 	// アーカイブ実施
-	fmt.Fprintf(writer, "Starts archiving mails.\n")
-	archivedMails, err := action.Archive(maildirPath, mails, archiveFolderNameGenerator)
+	var result *action.ArchiveResult
+	if archiveRootPath == "" {
+		fmt.Fprintf(writer, "Starts archiving mails.\n")
+		result, err = action.ArchiveWithConflictPolicy(maildirPath, mails, archiveFolderNameGenerator, onConflict, condition.KeepGoing, journal)
+	} else {
+		fmt.Fprintf(writer, "Starts archiving mails. archive root: %s\n", archiveRootPath)
+		result, err = action.ArchiveToRoot(archiveRootPath, mails, archiveFolderNameGenerator, onConflict, condition.KeepGoing, journal)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Fprintf(writer, "Completed archive. The archived mails are listed below.\n")
-	renderTargetMails(writer, archivedMails)
+	if renderTable {
+		renderTargetMails(writer, result.ArchivedMails)
+	}
+	renderConflicts(writer, result.Conflicts)
+	failures = append(failures, result.Failures...)
+	renderFreedSize(writer, targetSize, result.SourceMails, nil, dryRun) // スキップしたものやエラーとなったものは含まれない
+	renderFailures(writer, failures, renderTable)
 
-	return nil
+	// アーカイブできたもののみ (スキップしたものやエラーとなったものは含まれない)
+	report := newReport("", "", result.SourceMails)
+	report.addArchivedMails("", result.SourceMails, result.ArchivedMails)
+	report.addConflicts("", result.Conflicts)
+	report.TargetSize = targetSize
+	report.addFailures("", failures)
+	return report, nil
 }
 
 func newArchiveFolderNameGenerator(f *pflag.FlagSet) (action.ArchiveFolderNameGenerator, error) {
 
 	archiveFolderName, _ := f.GetString("archive-folder")
 	archivePattern, _ := f.GetString("archive-pattern")
+	archiveTemplate, _ := f.GetString("archive-template")
+
+	location, err := getLocation(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return newArchiveFolderNameGeneratorByPattern(archiveFolderName, archivePattern, archiveTemplate, location)
+}
+
+func newArchiveFolderNameGeneratorByPattern(archiveFolderName string, archivePattern string, archiveTemplate string, location *time.Location) (action.ArchiveFolderNameGenerator, error) {
+
+	return newFolderNameGenerator("archive", archiveFolderName, archivePattern, archiveTemplate, location)
+}
+
+// アーカイブフォルダ名と同じ規則で名前を生成 (exportの出力先も)
+func newFolderNameGenerator(optionPrefix string, baseName string, pattern string, templateText string, location *time.Location) (action.ArchiveFolderNameGenerator, error) {
+
+	if pattern != "template" && templateText != "" {
+		return nil, fmt.Errorf("%[1]s-template can only be used with %[1]s-pattern 'template'", optionPrefix)
+	}
 
-	switch archivePattern {
+	switch pattern {
 	case "keep":
 		return &action.KeepArchiveFolderNameGenerator{
-			ArchiveFolderBaseName: archiveFolderName,
+			ArchiveFolderBaseName: baseName,
 		}, nil
 	case "year":
 		return &action.YearArchiveFolderNameGenerator{
-			ArchiveFolderBaseName: archiveFolderName,
+			ArchiveFolderBaseName: baseName,
+			Location:              location,
 		}, nil
 	case "month":
 		return &action.MonthArchiveFolderNameGenerator{
-			ArchiveFolderBaseName: archiveFolderName,
+			ArchiveFolderBaseName: baseName,
+			Location:              location,
 		}, nil
+	case "template":
+		if templateText == "" {
+			return nil, fmt.Errorf("%[1]s-template is required for %[1]s-pattern 'template'", optionPrefix)
+		}
+		generator, err := action.NewTemplateArchiveFolderNameGenerator(baseName, templateText)
+		if err != nil {
+			return nil, err
+		}
+		generator.Location = location
+		return generator, nil
 	default:
-		return nil, fmt.Errorf("invalid archive-pattern '%s'", archivePattern)
+		return nil, fmt.Errorf("invalid %s-pattern '%s'", optionPrefix, pattern)
 	}
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"testing"
@@ -366,6 +367,246 @@ Completed archive. The archived mails are listed below.
 	assert.Equal(t, expected, result)
 }
 
+func TestArchiveCmd_ArchivePatternTemplate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// アーカイブ対象
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "Sent", "cur", 2021, 1),
+	}
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Sent\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "template",
+		"--archive-template", "{{.Base}}.{{.Year}}.{{.Folder}}",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMails[0].FullPath)
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2020", "cur", targetMails[0].FileName))
+	assert.NoFileExists(t, targetMails[1].FullPath)
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2021.Sent", "cur", targetMails[1].FileName))
+
+	// subscriptionsに登録されていること
+	assert.Equal(t, "Sent\nArchived\nArchived.2020\nArchived.2021\nArchived.2021.Sent\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestArchiveCmd_ArchivePatternTemplateTwice(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// INBOXの場合だけ{{.Base}}で始まらない
+	createMailByYearMonth(t, temp, "", "cur", 2020, 12)
+	createMailByYearMonth(t, temp, "Sent", "cur", 2021, 1)
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Sent\n")
+
+	args := []string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "template",
+		"--archive-template", "{{if .Folder}}{{.Base}}.{{.Folder}}{{else}}Inbox.{{.Year}}{{end}}",
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(args)
+	rootCmd.SetOutput(new(bytes.Buffer))
+	require.NoError(t, rootCmd.Execute())
+
+	rootCmd = newRootCmd()
+	rootCmd.SetArgs(args)
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// アーカイブフォルダ配下に作成されるので、2回目は対象が無いこと
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. There were no target mails.
+`, temp, 10)
+	assert.Equal(t, expected, result)
+
+	assert.Equal(t, "Sent\nArchived\nArchived.Inbox\nArchived.Inbox.2020\nArchived.Sent\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestArchiveCmd_ArchiveTemplateNotStartWithBase(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "template",
+		"--archive-template", "{{.Year}}.{{.Folder}}",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid template '{{.Year}}.{{.Folder}}': the archive folder name must start with '{{.Base}}'")
+}
+
+func TestArchiveCmd_ArchiveTemplateRequired(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "template",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "archive-template is required for archive-pattern 'template'")
+}
+
+func TestArchiveCmd_ArchiveTemplateWithoutPattern(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-template", "{{.Base}}.{{.Year}}",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "archive-template can only be used with archive-pattern 'template'")
+}
+
+func TestArchiveCmd_InvalidArchiveTemplate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "template",
+		"--archive-template", "{{.Base}}.{{.Hour}}",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid template '{{.Base}}.{{.Hour}}'")
+}
+
+func TestArchiveCmd_Timezone(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 2021/1/1 0:00(UTC) は America/New_York では 2020/12/31
+	targetMail := createMailByYearMonth(t, temp, "", "cur", 2021, 1)
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "year",
+		"--timezone", "America/New_York",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMail.FullPath)
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2020", "cur", targetMail.FileName))
+	assert.Equal(t, "Archived\nArchived.2020\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestArchiveCmd_InvalidTimezone(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--timezone", "Asia/Xxx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid timezone 'Asia/Xxx'")
+}
+
 func TestArchiveCmd_IgnoreArchiveFolder(t *testing.T) {
 
 	// ARRANGE
@@ -694,6 +935,102 @@ Completed archive. The archived mails are listed below.
 	assert.Equal(t, expected, result)
 }
 
+func TestArchiveCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// アーカイブ対象(10日以上経過) ※収集される順に
+	targetMails := []collector.Mail{
+		// INBOX
+		createMailByYearMonth(t, temp, "", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "", "new", 2021, 1),
+		// A
+		createMailByYearMonth(t, temp, "A", "cur", 2020, 1),
+	}
+
+	// アーカイブ対象外
+	nonTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "new", 1),
+		createMailByDays(t, temp, "A", "new", 9),
+	}
+
+	// 2021は既に存在するフォルダ
+	createMailByDays(t, temp, "Archived.2021", "new", 100)
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\nArchived\nArchived.2021\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--archive-pattern", "year",
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象/対象外のメールが移動されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// フォルダが作成されていないこと
+	assert.NoDirExists(t, filepath.Join(temp, ".Archived.2020"))
+
+	// subscriptionsが変更されていないこと
+	assert.Equal(t, "A\nArchived\nArchived.2021\n", test.ReadFile(t, subscriptionsPath))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |            4,054 |
+| A     |               1 |            2,021 |
++-------+-----------------+------------------+
+| Total |               3 |            6,075 |
++-------+-----------------+------------------+
+Dry run. The mails would be archived as listed below.
++------+----------------+-----------------+------------------+
+| Name | Archive folder | Number of mails | Total size(byte) |
++------+----------------+-----------------+------------------+
+|      | Archived.2020  |               1 |            2,032 |
+|      | Archived.2021  |               1 |            2,022 |
+| A    | Archived.2020  |               1 |            2,021 |
++------+----------------+-----------------+------------------+
+|                 Total |               3 |            6,075 |
++------+----------------+-----------------+------------------+
+Folders to be created:
+  Archived
+  Archived.2020
+Folders to be subscribed:
+  Archived.2020
+Mails to be moved:
+  %s -> %s
+  %s -> %s
+  %s -> %s
+`, temp, 10,
+		targetMails[0].FullPath, filepath.Join(temp, ".Archived.2020", "cur", targetMails[0].FileName),
+		targetMails[1].FullPath, filepath.Join(temp, ".Archived.2021", "new", targetMails[1].FileName),
+		targetMails[2].FullPath, filepath.Join(temp, ".Archived.2020", "cur", targetMails[2].FileName))
+	assert.Equal(t, expected, result)
+}
+
 func TestArchiveCmd_Empty(t *testing.T) {
 
 	// ARRANGE
@@ -748,29 +1085,422 @@ Completed search. There were no target mails.
 	assert.Equal(t, expected, result)
 }
 
-func TestArchiveCmd_SubscriptionsNotFound(t *testing.T) {
+func TestArchiveCmd_OutputJSON(t *testing.T) {
 
 	// ARRANGE
 	temp := t.TempDir()
 
-	// アーカイブ対象
-	createMailByDays(t, temp, "", "new", 100)
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+	test.CreateMailFolder(t, temp, "")
+
+	targetMail := createMailByYearMonth(t, temp, "A", "cur", 2021, 1)
 
 	rootCmd := newRootCmd()
 	rootCmd.SetArgs([]string{
 		"archive",
 		"-d", temp,
 		"-a", "10",
+		"--archive-pattern", "year",
+		"--output", "json",
 	})
 
-	buf := new(bytes.Buffer)
-	rootCmd.SetOutput(buf)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
 
 	// ACT
 	err := rootCmd.Execute()
 
 	// ASSERT
-	require.EqualError(t, err, "subscriptions file not found: currently only dovecot is supported")
+	require.NoError(t, err)
+
+	archivedMailPath := filepath.Join(temp, ".Archived.2021", "cur", targetMail.FileName)
+	assert.NoFileExists(t, targetMail.FullPath)
+	assert.FileExists(t, archivedMailPath)
+
+	// アーカイブ先の一覧も含まれること
+	expected := fmt.Sprintf(`{
+  "command": "archive",
+  "dryRun": false,
+  "maildirs": [
+    {
+      "user": "%s",
+      "maildir": "%s",
+      "status": "ok",
+      "folders": [
+        {
+          "name": "A",
+          "count": 1,
+          "size": 2022
+        }
+      ],
+      "total": {
+        "count": 1,
+        "size": 2022
+      },
+      "archived": [
+        {
+          "folder": "A",
+          "archiveFolder": "Archived.2021",
+          "source": "%s",
+          "destination": "%s",
+          "size": 2022
+        }
+      ]
+    }
+  ],
+  "total": {
+    "count": 1,
+    "size": 2022
+  }
+}
+`, temp, temp, targetMail.FullPath, archivedMailPath)
+	assert.Equal(t, expected, stdout.String())
+}
+
+func TestArchiveCmd_OnConflictSkip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Archived\n")
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 10), // 重複
+		createMailByDays(t, temp, "", "cur", 11),
+	}
+
+	// アーカイブフォルダに同じ名前のファイルが存在
+	archiveFolderPath := test.CreateMailFolder(t, temp, ".Archived")
+	existingPath := filepath.Join(archiveFolderPath, "cur", targetMails[0].FileName)
+	test.CreateFile(t, existingPath, "existing")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--on-conflict", "skip",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.Equal(t, "existing", test.ReadFile(t, existingPath))
+	assert.NoFileExists(t, targetMails[1].FullPath)
+	assert.FileExists(t, filepath.Join(archiveFolderPath, "cur", targetMails[1].FileName))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               21 |
++-------+-----------------+------------------+
+| Total |               2 |               21 |
++-------+-----------------+------------------+
+Starts archiving mails.
+Completed archive. The archived mails are listed below.
++----------+-----------------+------------------+
+| Name     | Number of mails | Total size(byte) |
++----------+-----------------+------------------+
+| Archived |               1 |               11 |
++----------+-----------------+------------------+
+|    Total |               1 |               11 |
++----------+-----------------+------------------+
+Conflicts with existing files: 1 (skipped: 1)
+  %s -> %s (skipped)
+`, temp, 10, targetMails[0].FullPath, existingPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestArchiveCmd_OnConflictDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Archived\n")
+
+	targetMail := createMailByDaysAndContent(t, temp, "", "cur", 10, "same")
+
+	archiveFolderPath := test.CreateMailFolder(t, temp, ".Archived")
+	existingPath := filepath.Join(archiveFolderPath, "cur", targetMail.FileName)
+	test.CreateFile(t, existingPath, "same")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--on-conflict", "dedupe",
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.FileExists(t, targetMail.FullPath)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Dry run. The mails would be archived as listed below.
++------+----------------+-----------------+------------------+
+| Name | Archive folder | Number of mails | Total size(byte) |
++------+----------------+-----------------+------------------+
+|      | Archived       |               1 |                4 |
++------+----------------+-----------------+------------------+
+|                 Total |               1 |                4 |
++------+----------------+-----------------+------------------+
+Mails to be moved:
+  %s -> %s (conflict: deduplicated)
+Conflicts with existing files: 1 (deduplicated: 1)
+  %s -> %s (deduplicated)
+`, targetMail.FullPath, existingPath, targetMail.FullPath, existingPath)
+	assert.Contains(t, result, expected)
+}
+
+func TestArchiveCmd_ArchiveRoot(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	archiveRootPath := filepath.Join(temp, "archive", "user1", "Maildir") // 存在しないフォルダ
+
+	// アーカイブ対象
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "", "cur", 2020, 12),
+		createMailByYearMonth(t, maildirPath, "A", "new", 2021, 1),
+	}
+
+	subscriptionsPath := filepath.Join(maildirPath, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", maildirPath,
+		"-a", "10",
+		"--archive-pattern", "year",
+		"--archive-root", archiveRootPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// アーカイブ先のルートに移動されていること
+	assert.NoFileExists(t, targetMails[0].FullPath)
+	assert.FileExists(t, filepath.Join(archiveRootPath, ".Archived.2020", "cur", targetMails[0].FileName))
+	assert.NoFileExists(t, targetMails[1].FullPath)
+	assert.FileExists(t, filepath.Join(archiveRootPath, ".Archived.2021", "new", targetMails[1].FileName))
+
+	// アーカイブ先のルートがMaildir++として作成されていること
+	assert.DirExists(t, filepath.Join(archiveRootPath, "cur"))
+	assert.DirExists(t, filepath.Join(archiveRootPath, "new"))
+	assert.DirExists(t, filepath.Join(archiveRootPath, "tmp"))
+	assert.Equal(t, "Archived\nArchived.2020\nArchived.2021\n", test.ReadFile(t, filepath.Join(archiveRootPath, "subscriptions")))
+
+	// 元のmaildirには作成されていないこと
+	assert.NoDirExists(t, filepath.Join(maildirPath, ".Archived"))
+	assert.Equal(t, "A\n", test.ReadFile(t, subscriptionsPath))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |            2,032 |
+| A     |               1 |            2,022 |
++-------+-----------------+------------------+
+| Total |               2 |            4,054 |
++-------+-----------------+------------------+
+Starts archiving mails. archive root: %s
+Completed archive. The archived mails are listed below.
++---------------+-----------------+------------------+
+| Name          | Number of mails | Total size(byte) |
++---------------+-----------------+------------------+
+| Archived.2020 |               1 |            2,032 |
+| Archived.2021 |               1 |            2,022 |
++---------------+-----------------+------------------+
+|         Total |               2 |            4,054 |
++---------------+-----------------+------------------+
+`, maildirPath, 10, archiveRootPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestArchiveCmd_ArchiveRootDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	archiveRootPath := filepath.Join(temp, "archive") // 存在しないフォルダ
+
+	test.CreateMailFolder(t, maildirPath, "")
+
+	// アーカイブ対象
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2020, 12),
+	}
+
+	test.CreateFile(t, filepath.Join(maildirPath, "subscriptions"), "A\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", maildirPath,
+		"-a", "10",
+		"--archive-root", archiveRootPath,
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 移動されていないこと＆アーカイブ先のルートが作成されていないこと
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.NoDirExists(t, archiveRootPath)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+| A     |               1 |            2,032 |
++-------+-----------------+------------------+
+| Total |               1 |            2,032 |
++-------+-----------------+------------------+
+Dry run. The mails would be archived as listed below.
++------+----------------+-----------------+------------------+
+| Name | Archive folder | Number of mails | Total size(byte) |
++------+----------------+-----------------+------------------+
+| A    | Archived.A     |               1 |            2,032 |
++------+----------------+-----------------+------------------+
+|                 Total |               1 |            2,032 |
++------+----------------+-----------------+------------------+
+Archive root to be created:
+  %s
+Folders to be created:
+  Archived
+  Archived.A
+Folders to be subscribed:
+  Archived
+  Archived.A
+Mails to be moved:
+  %s -> %s
+`, maildirPath, 10,
+		archiveRootPath,
+		targetMails[0].FullPath, filepath.Join(archiveRootPath, ".Archived.A", "cur", targetMails[0].FileName))
+	assert.Equal(t, expected, result)
+}
+
+func TestArchiveCmd_ArchiveRootMultipleMaildirs(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user1"), "")
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user2"), "")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"--dir-glob", filepath.Join(temp, "*"),
+		"-a", "10",
+		"--archive-root", filepath.Join(temp, "archive"),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--archive-root can only be used with --dir")
+}
+
+func TestArchiveCmd_InvalidOnConflict(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--on-conflict", "overwrite",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid on-conflict 'overwrite'")
+}
+
+func TestArchiveCmd_SubscriptionsNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// アーカイブ対象
+	createMailByDays(t, temp, "", "new", 100)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "subscriptions file not found: currently only dovecot is supported")
 }
 
 func TestArchiveCmd_MaildirNotFound(t *testing.T) {
@@ -822,3 +1552,122 @@ func TestArchiveCmd_InvalidArchivePattern(t *testing.T) {
 	// ASSERT
 	require.EqualError(t, err, "invalid archive-pattern 'xxx'")
 }
+
+func TestArchiveCmd_KeepGoingOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	createMailByDays(t, temp, "", "cur", 10)
+	brokenPath := createBrokenFolder(t, temp, "A")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--keep-going",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 mails")
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	assert.Equal(t, "partial", output.Maildirs[0].Status)
+	assert.Equal(t, 1, len(output.Maildirs[0].Archived))
+	assert.Equal(t, []failureReport{
+		{Folder: "A", Path: brokenPath, Error: readDirError(t, brokenPath)},
+	}, output.Maildirs[0].Failures)
+
+	// テーブル以外では一覧のみ
+	assert.Contains(t, stderr.String(), "Failed to process 1 mails. The failures are listed below.\n  "+brokenPath)
+	assert.NotContains(t, stderr.String(), "| Number of failures")
+}
+
+func TestArchiveCmd_TargetSizeOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	oldMail := createMailByDays(t, temp, "", "cur", 30)
+	newMail := createMailByDays(t, temp, "", "cur", 20)
+	createMailByDays(t, temp, "Archived", "cur", 100) // アーカイブフォルダも(選ばれないが)サイズに含める
+
+	archiveRootPath := filepath.Join(t.TempDir(), "archive")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--target-size", "120",
+		"--archive-root", archiveRootPath,
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, oldMail.FullPath)
+	assert.FileExists(t, newMail.FullPath)
+	assert.FileExists(t, filepath.Join(archiveRootPath, ".Archived", "cur", oldMail.FileName))
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	assert.Equal(t, &targetSizeReport{
+		MailboxSize: 150,
+		TargetSize:  120,
+		FreedSize:   30,
+		Reached:     true,
+	}, output.Maildirs[0].TargetSize)
+	assert.Equal(t, 1, len(output.Maildirs[0].Archived))
+}
+
+func TestArchiveCmd_TargetSizeWithoutArchiveRoot(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"--target-size", "20",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// 同じmaildir内のアーカイブではサイズが減らない
+	require.EqualError(t, err, "--target-size can only be used with --archive-root")
+}
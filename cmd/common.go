@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-cleaner/action"
 	"github.com/onozaty/maildir-cleaner/collector"
 )
 
@@ -35,6 +39,405 @@ func renderTargetMails(writer io.Writer, mails *[]collector.Mail) {
 	table.Render()
 }
 
+func renderTargetThreads(writer io.Writer, mails *[]collector.Mail, threads *collector.Threads) {
+
+	aggregateResults := aggregateMails(mails)
+	folderThreads := aggregateThreads(mails, threads)
+	allMailCount := int64(0)
+	allMailSize := int64(0)
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"Name", "Number of threads", "Number of mails", "Total size(byte)"})
+
+	for _, result := range aggregateResults {
+		table.Append(
+			[]string{result.FolderName, humanize.Comma(int64(folderThreads[result.FolderName])), humanize.Comma(result.Count), humanize.Comma(result.TotalSize)})
+
+		allMailCount += result.Count
+		allMailSize += result.TotalSize
+	}
+
+	// フォルダをまたぐスレッドがあるので、合計はフォルダ毎の合計では無く全体から数える
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetFooter([]string{"Total", humanize.Comma(int64(threads.Count(mails))), humanize.Comma(allMailCount), humanize.Comma(allMailSize)})
+
+	table.Render()
+}
+
+// フォルダ名毎のスレッド数
+func aggregateThreads(mails *[]collector.Mail, threads *collector.Threads) map[string]int {
+
+	folderMails := map[string][]collector.Mail{}
+	for _, mail := range *mails {
+		folderMails[mail.FolderName] = append(folderMails[mail.FolderName], mail)
+	}
+
+	folderThreads := map[string]int{}
+	for folderName, mails := range folderMails {
+		folderThreads[folderName] = threads.Count(&mails)
+	}
+
+	return folderThreads
+}
+
+func renderArchiveFolders(writer io.Writer, mails *[]collector.Mail, archivedMails *[]collector.Mail) {
+
+	renderMoveFolders(writer, mails, archivedMails, "Archive folder")
+}
+
+func renderRestoreFolders(writer io.Writer, mails *[]collector.Mail, restoredMails *[]collector.Mail) {
+
+	renderMoveFolders(writer, mails, restoredMails, "Restore folder")
+}
+
+func renderMoveFolders(writer io.Writer, mails *[]collector.Mail, archivedMails *[]collector.Mail, archiveFolderHeader string) {
+
+	// 元のフォルダ毎に、移動先のフォルダを集計
+	aggregateResultsMap := map[[2]string]*archiveFolderResult{}
+
+	for i, mail := range *mails {
+		archiveFolderName := (*archivedMails)[i].FolderName
+		key := [2]string{mail.FolderName, archiveFolderName}
+
+		result := aggregateResultsMap[key]
+		if result == nil {
+			result = &archiveFolderResult{
+				FolderName:        mail.FolderName,
+				ArchiveFolderName: archiveFolderName,
+			}
+			aggregateResultsMap[key] = result
+		}
+
+		result.Count++
+		result.TotalSize += mail.Size
+	}
+
+	aggregateResults := []archiveFolderResult{}
+	for _, result := range aggregateResultsMap {
+		aggregateResults = append(aggregateResults, *result)
+	}
+
+	sort.Slice(aggregateResults, func(i, j int) bool {
+		if aggregateResults[i].FolderName == aggregateResults[j].FolderName {
+			return aggregateResults[i].ArchiveFolderName < aggregateResults[j].ArchiveFolderName
+		}
+		return aggregateResults[i].FolderName < aggregateResults[j].FolderName
+	})
+
+	allMailCount := int64(0)
+	allMailSize := int64(0)
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"Name", archiveFolderHeader, "Number of mails", "Total size(byte)"})
+
+	for _, result := range aggregateResults {
+		table.Append(
+			[]string{result.FolderName, result.ArchiveFolderName, humanize.Comma(result.Count), humanize.Comma(result.TotalSize)})
+
+		allMailCount += result.Count
+		allMailSize += result.TotalSize
+	}
+
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetFooter([]string{"", "Total", humanize.Comma(allMailCount), humanize.Comma(allMailSize)})
+
+	table.Render()
+}
+
+func renderExportFiles(writer io.Writer, exportedMails []action.ExportedMail) {
+
+	// 出力先のファイル毎に集計
+	aggregateResultsMap := map[string]*aggregateResult{}
+
+	for _, exportedMail := range exportedMails {
+		exportFileName := filepath.Base(exportedMail.ExportPath)
+
+		result := aggregateResultsMap[exportFileName]
+		if result == nil {
+			result = &aggregateResult{
+				FolderName: exportFileName,
+			}
+			aggregateResultsMap[exportFileName] = result
+		}
+
+		result.Count++
+		result.TotalSize += exportedMail.Mail.Size
+	}
+
+	aggregateResults := []aggregateResult{}
+	for _, result := range aggregateResultsMap {
+		aggregateResults = append(aggregateResults, *result)
+	}
+
+	sort.Slice(aggregateResults, func(i, j int) bool {
+		return aggregateResults[i].FolderName < aggregateResults[j].FolderName
+	})
+
+	allMailCount := int64(0)
+	allMailSize := int64(0)
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"Export file", "Number of mails", "Total size(byte)"})
+
+	for _, result := range aggregateResults {
+		table.Append(
+			[]string{result.FolderName, humanize.Comma(result.Count), humanize.Comma(result.TotalSize)})
+
+		allMailCount += result.Count
+		allMailSize += result.TotalSize
+	}
+
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetFooter([]string{"Total", humanize.Comma(allMailCount), humanize.Comma(allMailSize)})
+
+	table.Render()
+}
+
+func renderArchivePlan(writer io.Writer, mails *[]collector.Mail, plan *action.ArchivePlan) {
+
+	if plan.CreateRootPath != "" {
+		fmt.Fprintf(writer, "Archive root to be created:\n")
+		fmt.Fprintf(writer, "  %s\n", plan.CreateRootPath)
+	}
+
+	if len(plan.CreateFolderNames) != 0 {
+		fmt.Fprintf(writer, "Folders to be created:\n")
+		for _, folderName := range plan.CreateFolderNames {
+			fmt.Fprintf(writer, "  %s\n", folderName)
+		}
+	}
+
+	if len(plan.SubscribeFolderNames) != 0 {
+		fmt.Fprintf(writer, "Folders to be subscribed:\n")
+		for _, folderName := range plan.SubscribeFolderNames {
+			fmt.Fprintf(writer, "  %s\n", folderName)
+		}
+	}
+
+	resolutions := map[string]string{}
+	for _, conflict := range plan.Conflicts {
+		resolutions[conflict.Mail.FullPath] = conflict.Resolution
+	}
+
+	fmt.Fprintf(writer, "Mails to be moved:\n")
+	for i, mail := range *mails {
+		if resolution, found := resolutions[mail.FullPath]; found {
+			// 名前が重複するものは、どのように扱われるかも
+			fmt.Fprintf(writer, "  %s -> %s (conflict: %s)\n", mail.FullPath, (*plan.ArchivedMails)[i].FullPath, resolution)
+			continue
+		}
+		fmt.Fprintf(writer, "  %s -> %s\n", mail.FullPath, (*plan.ArchivedMails)[i].FullPath)
+	}
+}
+
+func renderConflicts(writer io.Writer, conflicts []action.Conflict) {
+
+	if len(conflicts) == 0 {
+		return
+	}
+
+	counts := map[string]int{}
+	for _, conflict := range conflicts {
+		counts[conflict.Resolution]++
+	}
+
+	details := []string{}
+	for _, resolution := range []string{action.ResolutionSkipped, action.ResolutionRenamed, action.ResolutionDeduplicated, action.ResolutionFailed} {
+		if counts[resolution] != 0 {
+			details = append(details, fmt.Sprintf("%s: %d", resolution, counts[resolution]))
+		}
+	}
+
+	fmt.Fprintf(writer, "Conflicts with existing files: %d (%s)\n", len(conflicts), strings.Join(details, ", "))
+	for _, conflict := range conflicts {
+		fmt.Fprintf(writer, "  %s -> %s (%s)\n", conflict.Mail.FullPath, conflict.ExistingPath, conflict.Resolution)
+	}
+}
+
+func renderFailures(writer io.Writer, failures []collector.MailError, renderTable bool) {
+
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "Failed to process %d mails. The failures are listed below.\n", len(failures))
+
+	if renderTable {
+		// フォルダ毎の件数
+		counts := map[string]int64{}
+		for _, failure := range failures {
+			counts[failure.FolderName]++
+		}
+
+		folderNames := []string{}
+		for folderName := range counts {
+			folderNames = append(folderNames, folderName)
+		}
+		sort.Strings(folderNames)
+
+		table := tablewriter.NewWriter(writer)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+		table.SetHeader([]string{"Name", "Number of failures"})
+
+		for _, folderName := range folderNames {
+			table.Append([]string{folderName, humanize.Comma(counts[folderName])})
+		}
+
+		table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+		table.SetFooter([]string{"Total", humanize.Comma(int64(len(failures)))})
+
+		table.Render()
+	}
+
+	for _, failure := range failures {
+		fmt.Fprintf(writer, "  %s (%s)\n", failure.Path, failure.Err)
+	}
+}
+
+func renderTrashPlan(writer io.Writer, plan *action.TrashPlan) {
+
+	if len(plan.CreateFolderNames) != 0 {
+		fmt.Fprintf(writer, "Folders to be created:\n")
+		for _, folderName := range plan.CreateFolderNames {
+			fmt.Fprintf(writer, "  %s\n", folderName)
+		}
+	}
+
+	if len(plan.SubscribeFolderNames) != 0 {
+		fmt.Fprintf(writer, "Folders to be subscribed:\n")
+		for _, folderName := range plan.SubscribeFolderNames {
+			fmt.Fprintf(writer, "  %s\n", folderName)
+		}
+	}
+
+	resolutions := map[string]string{}
+	for _, conflict := range plan.Conflicts {
+		resolutions[conflict.Mail.FullPath] = conflict.Resolution
+	}
+
+	if len(*plan.MovedMails) != 0 {
+		fmt.Fprintf(writer, "Mails to be moved:\n")
+		for i, mail := range *plan.MovedMails {
+			if resolution, found := resolutions[mail.FullPath]; found {
+				// 名前が重複するものは、どのように扱われるかも
+				fmt.Fprintf(writer, "  %s -> %s (conflict: %s)\n", mail.FullPath, (*plan.TrashedMails)[i].FullPath, resolution)
+				continue
+			}
+			fmt.Fprintf(writer, "  %s -> %s\n", mail.FullPath, (*plan.TrashedMails)[i].FullPath)
+		}
+	}
+
+	if len(*plan.DeletedMails) != 0 {
+		fmt.Fprintf(writer, "Mails to be deleted:\n")
+		for _, mail := range *plan.DeletedMails {
+			fmt.Fprintf(writer, "  %s\n", mail.FullPath)
+		}
+	}
+}
+
+func renderRuleMails(writer io.Writer, rules []*rule, ruleMails []*[]collector.Mail) {
+
+	allMailCount := int64(0)
+	allMailSize := int64(0)
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"Rule", "Action", "Name", "Number of mails", "Total size(byte)"})
+
+	for i, rule := range rules {
+		for _, result := range aggregateMails(ruleMails[i]) {
+			table.Append(
+				[]string{rule.Name, rule.Action, result.FolderName, humanize.Comma(result.Count), humanize.Comma(result.TotalSize)})
+
+			allMailCount += result.Count
+			allMailSize += result.TotalSize
+		}
+	}
+
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetFooter([]string{"", "", "Total", humanize.Comma(allMailCount), humanize.Comma(allMailSize)})
+
+	table.Render()
+}
+
+func renderUserResults(writer io.Writer, reports []*report) {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"User", "Status", "Number of mails", "Total size(byte)"})
+
+	for _, report := range reports {
+		if report.Status == "failed" {
+			table.Append([]string{report.User, "Failed", "", ""})
+			continue
+		}
+
+		status := "OK"
+		if report.Status == "partial" {
+			status = "Partial"
+		}
+
+		table.Append(
+			[]string{report.User, status, humanize.Comma(report.Total.Count), humanize.Comma(report.Total.Size)})
+	}
+
+	total := sumTotals(reports)
+
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetFooter([]string{"", "Total", humanize.Comma(total.Count), humanize.Comma(total.Size)})
+
+	table.Render()
+}
+
+func renderListedMails(writer io.Writer, mails []listedMail, showHeaders bool, showThreads bool) {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetAutoWrapText(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+
+	alignments := []int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_LEFT}
+	header := []string{"Name", "Sub", "File name", "Size(byte)", "Time"}
+	if showHeaders {
+		alignments = append(alignments, tablewriter.ALIGN_LEFT, tablewriter.ALIGN_LEFT)
+		header = append(header, "Subject", "From")
+	}
+	if showThreads {
+		alignments = append(alignments, tablewriter.ALIGN_RIGHT)
+		header = append(header, "Thread mails")
+	}
+	table.SetColumnAlignment(alignments)
+	table.SetHeader(header)
+
+	for _, mail := range mails {
+		row := []string{mail.FolderName, mail.SubDirName, mail.FileName, humanize.Comma(mail.Size), mail.Time.Format(listTimeLayout)}
+		if showHeaders {
+			row = append(row, mail.Subject, mail.From)
+		}
+		if showThreads {
+			row = append(row, humanize.Comma(int64(mail.ThreadMails)))
+		}
+		table.Append(row)
+	}
+
+	table.Render()
+}
+
 func aggregateMails(mails *[]collector.Mail) []aggregateResult {
 
 	// フォルダ名毎に集計
@@ -68,8 +471,18 @@ func aggregateMails(mails *[]collector.Mail) []aggregateResult {
 	return aggregateResults
 }
 
+// 一覧で表示する日時の形式
+const listTimeLayout = "2006-01-02 15:04:05"
+
 type aggregateResult struct {
 	FolderName string
 	Count      int64
 	TotalSize  int64
 }
+
+type archiveFolderResult struct {
+	FolderName        string
+	ArchiveFolderName string
+	Count             int64
+	TotalSize         int64
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/pflag"
+)
+
+// 対象メールの条件(コマンドライン、設定ファイル共通)
+type conditionValues struct {
+	ExcludeFolderNames []string `yaml:"exclude-folder"`
+	MinSize            string   `yaml:"min-size"`
+	MaxSize            string   `yaml:"max-size"`
+	KeepFlagged        bool     `yaml:"keep-flagged"`
+	KeepUnread         bool     `yaml:"keep-unread"`
+	OnlySeen           bool     `yaml:"only-seen"`
+	OnlyTrashed        bool     `yaml:"only-trashed"`
+	From               string   `yaml:"from"`
+	To                 string   `yaml:"to"`
+	Subject            string   `yaml:"subject"`
+	Headers            []string `yaml:"header"`
+	KeepLast           []string `yaml:"keep-last"`
+	ThreadAware        bool     `yaml:"thread-aware"`
+}
+
+func addConditionFlags(f *pflag.FlagSet) {
+
+	f.StringArrayP("exclude-folder", "", []string{}, "The name of the folder to exclude.")
+	f.StringP("min-size", "", "", "Minimum size of the mail. (e.g. 500KB, 5MB, 1GiB)")
+	f.StringP("max-size", "", "", "Maximum size of the mail. (e.g. 500KB, 5MB, 1GiB)")
+	f.BoolP("keep-flagged", "", false, "Exclude flagged mails.")
+	f.BoolP("keep-unread", "", false, "Exclude unread mails. (same as --only-seen)")
+	f.BoolP("only-seen", "", false, "Target only seen mails. (same as --keep-unread)")
+	f.BoolP("only-trashed", "", false, "Target only mails marked as trashed.")
+	f.StringP("from", "", "", "Target only mails whose From matches the pattern. (glob, e.g. *@example.com)")
+	f.StringP("to", "", "", "Target only mails whose To matches the pattern. (glob, e.g. *@example.com)")
+	f.StringP("subject", "", "", "Target only mails whose Subject matches the pattern. (glob, e.g. *newsletter*)")
+	f.StringArrayP("header", "", []string{}, "Target only mails whose header matches the pattern.\nSpecify as NAME=GLOB or NAME=~REGEXP. (e.g. List-Id=~example\\.com)")
+	f.StringArrayP("keep-last", "", []string{}, "Keep the newest N mails in each folder, regardless of the other conditions.\nSpecify as N for all folders, or FOLDER=N for a folder including subfolders. (e.g. 100, Sent=500)")
+	f.BoolP("thread-aware", "", false, "Target only mails whose whole thread is older than the age.\nThreads are built across folders from the Message-ID, In-Reply-To and References headers.")
+	addTimeSourceFlag(f)
+	addTimezoneFlag(f)
+}
+
+func addTimeSourceFlag(f *pflag.FlagSet) {
+
+	f.StringP("time-source", "", "filename", "Source of the mail time. can be specified: filename, mtime, date-header, received-header\nMultiple sources can be specified separated by commas, and are tried in order. (e.g. filename,mtime)")
+}
+
+func addTimezoneFlag(f *pflag.FlagSet) {
+
+	f.StringP("timezone", "", "", "Timezone for the age and the archive folder names. (e.g. Asia/Tokyo)\nIf specified, the age is counted in calendar days from midnight in the timezone.")
+}
+
+func newCondition(f *pflag.FlagSet) (*collector.Condition, error) {
+
+	age, _ := f.GetInt64("age")
+
+	timeSources, err := getTimeSources(f)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := getLocation(f)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeFolderNames, _ := f.GetStringArray("exclude-folder")
+	minSize, _ := f.GetString("min-size")
+	maxSize, _ := f.GetString("max-size")
+	keepFlagged, _ := f.GetBool("keep-flagged")
+	keepUnread, _ := f.GetBool("keep-unread")
+	onlySeen, _ := f.GetBool("only-seen")
+	onlyTrashed, _ := f.GetBool("only-trashed")
+	from, _ := f.GetString("from")
+	to, _ := f.GetString("to")
+	subject, _ := f.GetString("subject")
+	headers, _ := f.GetStringArray("header")
+	keepLast, _ := f.GetStringArray("keep-last")
+	threadAware, _ := f.GetBool("thread-aware")
+
+	values := conditionValues{
+		ExcludeFolderNames: excludeFolderNames,
+		MinSize:            minSize,
+		MaxSize:            maxSize,
+		KeepFlagged:        keepFlagged,
+		KeepUnread:         keepUnread,
+		OnlySeen:           onlySeen,
+		OnlyTrashed:        onlyTrashed,
+		From:               from,
+		To:                 to,
+		Subject:            subject,
+		Headers:            headers,
+		KeepLast:           keepLast,
+		ThreadAware:        threadAware,
+	}
+
+	return values.toCondition(age, timeSources, location)
+}
+
+func getTimeSources(f *pflag.FlagSet) ([]collector.TimeSource, error) {
+
+	timeSourcesValue, _ := f.GetString("time-source")
+	return collector.ParseTimeSources(timeSourcesValue)
+}
+
+func getLocation(f *pflag.FlagSet) (*time.Location, error) {
+
+	timezone, _ := f.GetString("timezone")
+	return parseLocation(timezone)
+}
+
+func parseLocation(timezone string) (*time.Location, error) {
+
+	if timezone == "" {
+		// 未指定の場合は従来通り(経過日は現在日時から、アーカイブフォルダはUTC)
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s'", timezone)
+	}
+
+	return location, nil
+}
+
+func (v conditionValues) toCondition(age int64, timeSources []collector.TimeSource, location *time.Location) (*collector.Condition, error) {
+
+	minSize, err := parseSize("min-size", v.MinSize)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := parseSize("max-size", v.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if minSize != 0 && maxSize != 0 && minSize > maxSize {
+		return nil, fmt.Errorf("min-size must be less than or equal to max-size")
+	}
+
+	headerFilters, err := v.toHeaderFilters()
+	if err != nil {
+		return nil, err
+	}
+
+	keepLast, err := v.toKeepLast()
+	if err != nil {
+		return nil, err
+	}
+
+	return &collector.Condition{
+		AgeOfDays:          age,
+		ExcludeFolderNames: v.ExcludeFolderNames,
+		MinSize:            minSize,
+		MaxSize:            maxSize,
+		KeepFlagged:        v.KeepFlagged,
+		KeepUnread:         v.KeepUnread,
+		OnlySeen:           v.OnlySeen,
+		OnlyTrashed:        v.OnlyTrashed,
+		TimeSources:        timeSources,
+		HeaderFilters:      headerFilters,
+		Location:           location,
+		KeepLast:           *keepLast,
+		ThreadAware:        v.ThreadAware,
+	}, nil
+}
+
+func (v conditionValues) toHeaderFilters() ([]*collector.HeaderFilter, error) {
+
+	headerFilters := []*collector.HeaderFilter{}
+
+	for _, glob := range []struct {
+		name    string
+		pattern string
+	}{
+		{"From", v.From},
+		{"To", v.To},
+		{"Subject", v.Subject},
+	} {
+		if glob.pattern == "" {
+			continue
+		}
+
+		headerFilter, err := collector.NewGlobHeaderFilter(glob.name, glob.pattern)
+		if err != nil {
+			return nil, err
+		}
+		headerFilters = append(headerFilters, headerFilter)
+	}
+
+	for _, headerFilterValue := range v.Headers {
+		headerFilter, err := collector.ParseHeaderFilter(headerFilterValue)
+		if err != nil {
+			return nil, err
+		}
+		headerFilters = append(headerFilters, headerFilter)
+	}
+
+	return headerFilters, nil
+}
+
+func (v conditionValues) toKeepLast() (*collector.KeepLast, error) {
+
+	keepLast := &collector.KeepLast{
+		FolderCounts: map[string]int{},
+	}
+
+	for _, value := range v.KeepLast {
+		// N または FOLDER=N (フォルダ名は空文字(INBOX)も)
+		folderName, countValue, hasFolder := cutLast(value, "=")
+
+		count, err := strconv.Atoi(countValue)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid keep-last '%s'", value)
+		}
+
+		if hasFolder {
+			keepLast.FolderCounts[folderName] = count
+		} else {
+			keepLast.Count = count
+		}
+	}
+
+	return keepLast, nil
+}
+
+func cutLast(value string, separator string) (string, string, bool) {
+
+	// フォルダ名に"="が含まれていても良いように最後で区切る
+	index := strings.LastIndex(value, separator)
+	if index == -1 {
+		return "", value, false
+	}
+	return value[:index], value[index+len(separator):], true
+}
+
+// 経過日の代わりに対象を絞る指定があれば、経過日は省略できるように
+func requireAgeOr(f *pflag.FlagSet, flagNames ...string) error {
+
+	if f.Changed("age") {
+		return nil
+	}
+	for _, flagName := range flagNames {
+		if f.Changed(flagName) {
+			return nil
+		}
+	}
+
+	names := append([]string{"--age"}, flagNames...)
+	for i := 1; i < len(names); i++ {
+		names[i] = "--" + names[i]
+	}
+
+	if len(names) == 2 {
+		return fmt.Errorf("either %s or %s must be specified", names[0], names[1])
+	}
+	return fmt.Errorf("one of %s or %s must be specified", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+func parseSize(name string, value string) (int64, error) {
+
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := humanize.ParseBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", name, value)
+	}
+
+	return int64(size), nil
+}
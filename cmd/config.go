@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"gopkg.in/yaml.v3"
+)
+
+type config struct {
+	TimeSource string       `yaml:"time-source"`
+	Timezone   string       `yaml:"timezone"`
+	Rules      []ruleConfig `yaml:"rules"`
+}
+
+type ruleConfig struct {
+	Name            string   `yaml:"name"`
+	FolderNames     []string `yaml:"folders"` // 未指定の場合は全てのフォルダ
+	Action          string   `yaml:"action"`
+	Age             *int64   `yaml:"age"`
+	ArchiveFolder   string   `yaml:"archive-folder"`
+	ArchivePattern  string   `yaml:"archive-pattern"`
+	ArchiveTemplate string   `yaml:"archive-template"`
+	OnConflict      string   `yaml:"on-conflict"`
+	conditionValues `yaml:",inline"`
+}
+
+type rule struct {
+	Name                       string
+	Action                     string
+	FolderNames                []string
+	ExcludeFolderNames         []string
+	Collector                  *collector.Collector
+	ArchiveFolderNameGenerator action.ArchiveFolderNameGenerator
+	OnConflict                 action.ConflictPolicy
+}
+
+func loadConfig(configPath string) (*config, error) {
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true) // 項目名の誤りに気付けるように
+
+	config := config{
+		TimeSource: string(collector.TimeSourceFileName),
+	}
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s is invalid config: %w", configPath, err)
+	}
+
+	if len(config.Rules) == 0 {
+		return nil, fmt.Errorf("%s is invalid config: no rules", configPath)
+	}
+
+	return &config, nil
+}
+
+func (c *config) timeSources() ([]collector.TimeSource, error) {
+	return collector.ParseTimeSources(c.TimeSource)
+}
+
+func (c *config) rules() ([]*rule, error) {
+
+	timeSources, err := c.timeSources()
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := parseLocation(c.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []*rule{}
+	for i, ruleConfig := range c.Rules {
+		rule, err := ruleConfig.toRule(i, timeSources, location)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", ruleConfig.displayName(i), err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (r ruleConfig) displayName(index int) string {
+
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+func (r ruleConfig) toRule(index int, timeSources []collector.TimeSource, location *time.Location) (*rule, error) {
+
+	age := int64(0)
+	switch {
+	case r.Age != nil:
+		age = *r.Age
+	case len(r.KeepLast) == 0:
+		// keep-lastのみで件数によって絞ることも
+		return nil, fmt.Errorf("age or keep-last is required")
+	}
+
+	excludeFolderNames := append([]string{}, r.ExcludeFolderNames...)
+	var archiveFolderNameGenerator action.ArchiveFolderNameGenerator
+	var onConflict action.ConflictPolicy
+
+	switch r.Action {
+	case "delete":
+	case "archive":
+		archiveFolder := r.ArchiveFolder
+		if archiveFolder == "" {
+			archiveFolder = "Archived"
+		}
+		archivePattern := r.ArchivePattern
+		if archivePattern == "" {
+			archivePattern = "keep"
+		}
+
+		generator, err := newArchiveFolderNameGeneratorByPattern(archiveFolder, archivePattern, r.ArchiveTemplate, location)
+		if err != nil {
+			return nil, err
+		}
+		archiveFolderNameGenerator = generator
+
+		onConflictValue := r.OnConflict
+		if onConflictValue == "" {
+			onConflictValue = string(action.ConflictRename)
+		}
+		onConflict, err = action.ParseConflictPolicy(onConflictValue)
+		if err != nil {
+			return nil, err
+		}
+
+		// アーカイブフォルダも対象外に
+		excludeFolderNames = append(excludeFolderNames, generator.BaseName())
+	default:
+		return nil, fmt.Errorf("invalid action '%s'", r.Action)
+	}
+
+	values := r.conditionValues
+	values.ExcludeFolderNames = excludeFolderNames
+
+	condition, err := values.toCondition(age, timeSources, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rule{
+		Name:                       r.displayName(index),
+		Action:                     r.Action,
+		FolderNames:                r.FolderNames,
+		ExcludeFolderNames:         excludeFolderNames,
+		Collector:                  collector.NewConditionCollector(*condition),
+		ArchiveFolderNameGenerator: archiveFolderNameGenerator,
+		OnConflict:                 onConflict,
+	}, nil
+}
+
+func (r *rule) applies(mail collector.Mail) bool {
+
+	if len(r.FolderNames) != 0 && !collector.MatchFolder(mail.FolderName, r.FolderNames) {
+		return false
+	}
+
+	return !collector.MatchFolder(mail.FolderName, r.ExcludeFolderNames)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/cobra"
+)
+
+const (
+	dedupeActionNone    = "none"
+	dedupeActionDelete  = "delete"
+	dedupeActionArchive = "archive"
+)
+
+func newDedupeCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Find duplicate mails and remove all but one copy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			dedupeAction, _ := cmd.Flags().GetString("action")
+			switch dedupeAction {
+			case dedupeActionNone, dedupeActionDelete, dedupeActionArchive:
+			default:
+				return fmt.Errorf("invalid action '%s'", dedupeAction)
+			}
+
+			var archiveFolderNameGenerator action.ArchiveFolderNameGenerator
+			if dedupeAction == dedupeActionArchive {
+				archiveFolderNameGenerator, err = newArchiveFolderNameGenerator(cmd.Flags())
+				if err != nil {
+					return err
+				}
+			}
+
+			onConflictValue, _ := cmd.Flags().GetString("on-conflict")
+			onConflict, err := action.ParseConflictPolicy(onConflictValue)
+			if err != nil {
+				return err
+			}
+
+			timeSources, err := getTimeSources(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			excludeFolderNames, _ := cmd.Flags().GetStringArray("exclude-folder")
+			keepGoing, _ := cmd.Flags().GetBool("keep-going")
+			condition := collector.Condition{
+				ExcludeFolderNames: excludeFolderNames,
+				TimeSources:        timeSources,
+				KeepGoing:          keepGoing,
+			}
+
+			preferredFolderNames, _ := cmd.Flags().GetStringArray("prefer-folder")
+			trashFolderName, _ := cmd.Flags().GetString("trash-folder")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			journal, err := openJournal(cmd.Flags(), output.Progress)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runDedupe(
+					maildirPath,
+					condition,
+					preferredFolderNames,
+					trashFolderName,
+					dedupeAction,
+					archiveFolderNameGenerator,
+					onConflict,
+					dryRun,
+					journal,
+					writer,
+					output.isTable())
+			})
+		},
+	}
+
+	addMaildirFlags(subCmd)
+	subCmd.Flags().StringArrayP("exclude-folder", "", []string{}, "The name of the folder to exclude.")
+	subCmd.Flags().StringArrayP("prefer-folder", "", []string{}, "The name of the folder whose copy is kept. (in order of priority if specified multiple times)\nIf no copy is in the preferred folders, the oldest one is kept.")
+	subCmd.Flags().StringP("trash-folder", "", "Trash", "Trash folder name. The copies in the trash folder are not kept unless all copies are in it.")
+	subCmd.Flags().StringP("action", "", dedupeActionNone, "What to do with the duplicate mails. can be specified: none, delete, archive")
+	subCmd.Flags().StringP("archive-folder", "", "Archived", "Archive folder name. (used with --action archive)")
+	subCmd.Flags().StringP("archive-pattern", "", "keep", "Archive pattern. can be specified: keep, year, month, template")
+	subCmd.Flags().StringP("archive-template", "", "", "Template of the archive folder name. (used with --archive-pattern template)\ne.g. '{{.Base}}.{{.Year}}.{{.Folder}}'")
+	subCmd.Flags().StringP("on-conflict", "", string(action.ConflictRename), "How to handle a mail with the same name already in the archive folder. can be specified: skip, rename, fail, dedupe\ndedupe deletes the mail if the contents are the same, otherwise renames it.")
+	addTimeSourceFlag(subCmd.Flags())
+	addTimezoneFlag(subCmd.Flags())
+	subCmd.Flags().BoolP("dry-run", "", false, "Show the mails to be deleted or archived without actually changing them.")
+	addJournalFlags(subCmd.Flags())
+	addKeepGoingFlag(subCmd.Flags())
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runDedupe(maildirPath string, condition collector.Condition, preferredFolderNames []string, trashFolderName string, dedupeAction string, archiveFolderNameGenerator action.ArchiveFolderNameGenerator, onConflict action.ConflictPolicy, dryRun bool, journal *action.Journal, writer io.Writer, renderTable bool) (*report, error) {
+
+	// 全てのメールを収集
+	fmt.Fprintf(writer, "Starts searching for the duplicate mails. maildir: %s\n", maildirPath)
+
+	if archiveFolderNameGenerator != nil {
+		// アーカイブフォルダも対象外に
+		// (複数のmaildirで並列に処理されるので、元のスライスは変更しないように)
+		condition.ExcludeFolderNames = append(
+			append([]string{}, condition.ExcludeFolderNames...),
+			archiveFolderNameGenerator.BaseName())
+	}
+	collector := collector.NewConditionCollector(condition)
+	allMails, err := collector.Collect(maildirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Message-IDと内容(Message-IDが無い場合は内容のみ)が同じものをまとめる
+	groups, err := collector.FindDuplicates(allMails, preferredFolderNames, trashFolderName)
+	if err != nil {
+		return nil, err
+	}
+	failures := collector.Failures() // --keep-going で読み込めなかったもの
+	mails := groups.DuplicateMails()
+
+	if len(*mails) == 0 {
+		// 重複無し
+		fmt.Fprintf(writer, "Completed search. There were no duplicate mails.\n")
+		renderFailures(writer, failures, renderTable)
+
+		report := &report{}
+		report.addFailures("", failures)
+		return report, nil
+	}
+
+	// 残すもの以外を一覧に
+	fmt.Fprintf(writer, "Completed search. Found %d duplicate mails in %d groups. The duplicate mails are listed below.\n", len(*mails), len(groups))
+	if renderTable {
+		renderTargetMails(writer, mails)
+	}
+
+	report := newReport("", "", mails)
+	report.DuplicateGroups = len(groups)
+
+	switch {
+	case dedupeAction == dedupeActionNone:
+		// 一覧を表示するのみ
+
+	case dedupeAction == dedupeActionDelete && dryRun:
+		// 削除されるメールを表示するのみ
+		fmt.Fprintf(writer, "Dry run. The following mails would be deleted.\n")
+		for _, mail := range *mails {
+			fmt.Fprintf(writer, "  %s\n", mail.FullPath)
+		}
+
+	case dedupeAction == dedupeActionDelete:
+		fmt.Fprintf(writer, "Starts deleting mails.\n")
+		deleteFailures, err := action.Delete(maildirPath, mails, condition.KeepGoing, journal)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(writer, "Completed deletion.\n")
+		failures = append(failures, deleteFailures...)
+
+		// 削除できたもののみ
+		report = newReport("", "", action.ExcludeFailures(mails, deleteFailures))
+		report.DuplicateGroups = len(groups)
+
+	case dedupeAction == dedupeActionArchive && dryRun:
+		// アーカイブした場合の内容を表示するのみ
+		plan, err := action.PlanArchive(maildirPath, mails, archiveFolderNameGenerator, onConflict)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be archived as listed below.\n")
+		if renderTable {
+			renderArchiveFolders(writer, mails, plan.ArchivedMails)
+		}
+		renderArchivePlan(writer, mails, plan)
+		renderConflicts(writer, plan.Conflicts)
+
+		report.addArchivedMails("", mails, plan.ArchivedMails)
+		report.addConflicts("", plan.Conflicts)
+
+	case dedupeAction == dedupeActionArchive:
+		fmt.Fprintf(writer, "Starts archiving mails.\n")
+		result, err := action.ArchiveWithConflictPolicy(maildirPath, mails, archiveFolderNameGenerator, onConflict, condition.KeepGoing, journal)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Completed archive. The archived mails are listed below.\n")
+		if renderTable {
+			renderTargetMails(writer, result.ArchivedMails)
+		}
+		renderConflicts(writer, result.Conflicts)
+		failures = append(failures, result.Failures...)
+
+		report.addArchivedMails("", result.SourceMails, result.ArchivedMails)
+		report.addConflicts("", result.Conflicts)
+	}
+
+	renderFailures(writer, failures, renderTable)
+	report.addFailures("", failures)
+	return report, nil
+}
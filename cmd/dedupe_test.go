@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/folder"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <1@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "A", "cur", 20, "Message-ID: <1@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "A", "cur", 10, "Message-ID: <1@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "", "cur", 10, "Message-ID: <2@example.com>\n\nbody"),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 一覧のみなので消えない
+	for _, mail := range mails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the duplicate mails. maildir: %s
+Completed search. Found 2 duplicate mails in 1 groups. The duplicate mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+| A     |               2 |               66 |
++-------+-----------------+------------------+
+| Total |               2 |               66 |
++-------+-----------------+------------------+
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDedupeCmd_Delete(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	keptMail := createMailByDaysAndContent(t, temp, "A", "cur", 20, "Message-ID: <1@example.com>\n\nbody")
+	duplicateMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 35, "Message-ID: <1@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "B", "cur", 40, "Message-ID: <1@example.com>\n\nbody"),
+	}
+	// Message-IDが無いものは内容で
+	noIDMail := createMailByDaysAndContent(t, temp, "", "cur", 30, "Subject: hello\n\nbody")
+	noIDDuplicate := createMailByDaysAndContent(t, temp, "", "cur", 25, "Subject: hello\r\n\r\nbody\r\n")
+	otherMail := createMailByDaysAndContent(t, temp, "", "cur", 15, "Subject: hello\n\nother")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--prefer-folder", "A",
+		"--action", "delete",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 優先するフォルダのもの、無ければ最も古いものを残す
+	assert.FileExists(t, keptMail.FullPath)
+	for _, mail := range duplicateMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	assert.FileExists(t, noIDMail.FullPath)
+	assert.NoFileExists(t, noIDDuplicate.FullPath)
+	assert.FileExists(t, otherMail.FullPath)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the duplicate mails. maildir: %s
+Completed search. Found 3 duplicate mails in 2 groups. The duplicate mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               57 |
+| B     |               1 |               33 |
++-------+-----------------+------------------+
+| Total |               3 |               90 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDedupeCmd_DeleteDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	keptMail := createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <1@example.com>\n\nbody")
+	duplicateMail := createMailByDaysAndContent(t, temp, "", "cur", 20, "Message-ID: <1@example.com>\n\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--action", "delete",
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.FileExists(t, keptMail.FullPath)
+	assert.FileExists(t, duplicateMail.FullPath)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the duplicate mails. maildir: %s
+Completed search. Found 1 duplicate mails in 1 groups. The duplicate mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               33 |
++-------+-----------------+------------------+
+| Total |               1 |               33 |
++-------+-----------------+------------------+
+Dry run. The following mails would be deleted.
+  %s
+`, temp, duplicateMail.FullPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestDedupeCmd_DeleteNotKeepTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	trashMail := createMailByDaysAndContent(t, temp, "Deleted", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+	keptMail := createMailByDaysAndContent(t, temp, "A", "cur", 20, "Message-ID: <1@example.com>\n\nbody")
+	// Message-IDが同じでも内容が異なるものは重複としない
+	otherMail := createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <1@example.com>\n\nother body")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--prefer-folder", "Deleted",
+		"--trash-folder", "Deleted",
+		"--action", "delete",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 優先するフォルダであっても、ゴミ箱のものは残さない
+	assert.NoFileExists(t, trashMail.FullPath)
+	assert.FileExists(t, keptMail.FullPath)
+	assert.FileExists(t, otherMail.FullPath)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the duplicate mails. maildir: %s
+Completed search. Found 1 duplicate mails in 1 groups. The duplicate mails are listed below.
++---------+-----------------+------------------+
+| Name    | Number of mails | Total size(byte) |
++---------+-----------------+------------------+
+| Deleted |               1 |               33 |
++---------+-----------------+------------------+
+|   Total |               1 |               33 |
++---------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDedupeCmd_Archive(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	keptMail := createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <1@example.com>\n\nbody")
+	duplicateMail := createMailByDaysAndContent(t, temp, "A", "cur", 20, "Message-ID: <1@example.com>\n\nbody")
+	// アーカイブフォルダにあるものは対象外
+	archivedMail := createMailByDaysAndContent(t, temp, "Archived", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--action", "archive",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.FileExists(t, keptMail.FullPath)
+	assert.NoFileExists(t, duplicateMail.FullPath)
+	assert.FileExists(t, archivedMail.FullPath)
+
+	archiveFolderName, _ := folder.EncodeMailFolderName("Archived.A")
+	archivedPath := filepath.Join(temp, "."+archiveFolderName, "cur", duplicateMail.FileName)
+	assert.FileExists(t, archivedPath)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	assert.Equal(t, 1, output.Maildirs[0].DuplicateGroups)
+	assert.Equal(t, []archivedReport{
+		{
+			Folder:        "A",
+			ArchiveFolder: "Archived.A",
+			Source:        duplicateMail.FullPath,
+			Destination:   archivedPath,
+			Size:          duplicateMail.Size,
+		},
+	}, output.Maildirs[0].Archived)
+}
+
+func TestDedupeCmd_NoDuplicates(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <1@example.com>\n\nbody")
+	// 対象外のフォルダは比較しない
+	createMailByDaysAndContent(t, temp, "A", "cur", 30, "Message-ID: <1@example.com>\n\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--exclude-folder", "A",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the duplicate mails. maildir: %s
+Completed search. There were no duplicate mails.
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDedupeCmd_InvalidAction(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"dedupe",
+		"-d", temp,
+		"--action", "move",
+	})
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	assert.EqualError(t, err, "invalid action 'move'")
+}
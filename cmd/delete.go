@@ -16,55 +16,186 @@ func newDeleteCmd() *cobra.Command {
 		Short: "Delete old mails",
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			maildirPath, _ := cmd.Flags().GetString("dir")
-			age, _ := cmd.Flags().GetInt64("age")
-			excludeFolderNames, _ := cmd.Flags().GetStringArray("exclude-folder")
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := requireAgeOr(cmd.Flags(), "target-size", "keep-last"); err != nil {
+				return err
+			}
+
+			condition, err := newCondition(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			condition.KeepGoing, _ = cmd.Flags().GetBool("keep-going")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			targetSizeOption, err := newTargetSizeOption(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			// ゴミ箱に移動する場合のみゴミ箱のフォルダ名を指定
+			trashFolderName := ""
+			if toTrash, _ := cmd.Flags().GetBool("to-trash"); toTrash {
+				trashFolderName, _ = cmd.Flags().GetString("trash-folder")
+			}
+			if trashFolderName != "" && targetSizeOption != nil {
+				// ゴミ箱もメールボックス内なのでサイズが減らない
+				return fmt.Errorf("--target-size cannot be used with --to-trash")
+			}
+
+			journal, err := openJournal(cmd.Flags(), output.Progress)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
 
 			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
 			cmd.SilenceUsage = true
 
-			return runDelete(
-				maildirPath,
-				age,
-				excludeFolderNames,
-				cmd.OutOrStdout())
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runDelete(
+					maildirPath,
+					*condition,
+					targetSizeOption,
+					trashFolderName,
+					dryRun,
+					journal,
+					writer,
+					output.isTable())
+			})
 		},
 	}
 
-	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
-	subCmd.MarkFlagRequired("dir")
+	addMaildirFlags(subCmd)
 	subCmd.Flags().Int64P("age", "a", 0, "The number of age days to be deleted.\nIf you specify 10, mail that has been in the mailbox for more than 10 days since its arrival will be deleted.")
-	subCmd.MarkFlagRequired("age")
-	subCmd.Flags().StringArrayP("exclude-folder", "", []string{}, "The name of the folder to exclude.")
+	addTargetSizeFlags(subCmd.Flags())
+	addConditionFlags(subCmd.Flags())
+	subCmd.Flags().BoolP("to-trash", "", false, "Move the mails to the trash folder instead of deleting them.\nThe mails already in the trash folder are deleted.")
+	subCmd.Flags().StringP("trash-folder", "", "Trash", "Trash folder name. (used with --to-trash)")
+	subCmd.Flags().BoolP("dry-run", "", false, "Show the mails to be deleted without actually deleting them.")
+	addJournalFlags(subCmd.Flags())
+	addKeepGoingFlag(subCmd.Flags())
+	addOutputFlag(subCmd.Flags())
 	return subCmd
 }
 
-func runDelete(maildirPath string, age int64, excludeFolderNames []string, writer io.Writer) error {
+func runDelete(maildirPath string, condition collector.Condition, targetSizeOption *targetSizeOption, trashFolderName string, dryRun bool, journal *action.Journal, writer io.Writer, renderTable bool) (*report, error) {
 
 	// 対象のメールを収集
-	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d\n", maildirPath, age)
-	collector := collector.NewCollector(age, excludeFolderNames...)
+	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d%s\n", maildirPath, condition.AgeOfDays, targetSizeOption)
+	collector := collector.NewConditionCollector(condition)
 	mails, err := collector.Collect(maildirPath)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+	failures := collector.Failures() // --keep-going で読み込めなかったもの
+
+	var targetSize *targetSizeReport
+	if targetSizeOption != nil {
+		// 目標サイズになるまでのメールに絞る
+		mails, targetSize, err = selectByTargetSize(maildirPath, mails, condition, targetSizeOption, writer)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if len(*mails) == 0 {
 		// 削除対象無し
 		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
-		return nil
+		renderFreedSize(writer, targetSize, mails, failures, dryRun)
+		renderFailures(writer, failures, renderTable)
+
+		report := &report{TargetSize: targetSize}
+		report.addFailures("", failures)
+		return report, nil
 	}
 
 	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
-	renderTargetMails(writer, mails)
+	if renderTable {
+		renderTargetMails(writer, mails)
+	}
+
+	if trashFolderName != "" {
+		return runMoveToTrash(maildirPath, mails, failures, trashFolderName, condition.KeepGoing, dryRun, journal, writer, renderTable)
+	}
+
+	if dryRun {
+		// 削除されるメールを表示するのみ
+		fmt.Fprintf(writer, "Dry run. The following mails would be deleted.\n")
+		for _, mail := range *mails {
+			fmt.Fprintf(writer, "  %s\n", mail.FullPath)
+		}
+		renderFreedSize(writer, targetSize, mails, failures, dryRun)
+		renderFailures(writer, failures, renderTable)
+
+		report := newReport("", "", mails)
+		report.TargetSize = targetSize
+		report.addFailures("", failures)
+		return report, nil
+	}
 
 	// 削除実施
 	fmt.Fprintf(writer, "Starts deleting mails.\n")
-	if err := action.Delete(maildirPath, mails); err != nil {
-		return err
+	deleteFailures, err := action.Delete(maildirPath, mails, condition.KeepGoing, journal)
+	if err != nil {
+		return nil, err
 	}
 	fmt.Fprintf(writer, "Completed deletion.\n")
+	deletedMails := action.ExcludeFailures(mails, deleteFailures)
+	failures = append(failures, deleteFailures...)
+	renderFreedSize(writer, targetSize, deletedMails, nil, dryRun) // エラーとなったものは含まれない
+	renderFailures(writer, failures, renderTable)
+
+	report := newReport("", "", deletedMails)
+	report.TargetSize = targetSize
+	report.addFailures("", failures)
+	return report, nil
+}
+
+func runMoveToTrash(maildirPath string, mails *[]collector.Mail, failures []collector.MailError, trashFolderName string, keepGoing bool, dryRun bool, journal *action.Journal, writer io.Writer, renderTable bool) (*report, error) {
+
+	if dryRun {
+		// ゴミ箱に移動した場合の内容を表示するのみ
+		plan, err := action.PlanMoveToTrash(maildirPath, mails, trashFolderName)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be moved to the trash folder as listed below.\n")
+		renderTrashPlan(writer, plan)
+		renderFailures(writer, failures, renderTable)
+
+		report := newReport("", "", mails)
+		report.addConflicts("", plan.Conflicts)
+		report.addFailures("", failures)
+		return report, nil
+	}
+
+	// ゴミ箱に移動
+	fmt.Fprintf(writer, "Starts moving mails to the trash folder. trash folder: %s\n", trashFolderName)
+	plan, err := action.MoveToTrash(maildirPath, mails, trashFolderName, keepGoing, journal)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(writer, "Completed moving to the trash folder. moved: %d deleted: %d\n", len(*plan.MovedMails), len(*plan.DeletedMails))
+	renderConflicts(writer, plan.Conflicts)
+	failures = append(failures, plan.Failures...)
+	renderFailures(writer, failures, renderTable)
 
-	return nil
+	// 移動や削除ができたもの (エラーとなったものは含まれない)
+	processedMails := append(append([]collector.Mail{}, *plan.MovedMails...), *plan.DeletedMails...)
+	report := newReport("", "", &processedMails)
+	report.addConflicts("", plan.Conflicts)
+	report.addFailures("", failures)
+	return report, nil
 }
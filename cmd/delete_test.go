@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -177,31 +180,736 @@ Completed deletion.
 	assert.Equal(t, expected, result)
 }
 
+func TestDeleteCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 削除対象(10日以上経過) ※収集される順に
+	targetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "cur", 12),
+		createMailByDays(t, temp, "", "new", 10),
+		// A
+		createMailByDays(t, temp, "A", "new", 1000),
+	}
+
+	// 削除対象外(10日未満)
+	nonTargetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "new", 9),
+		// A
+		createMailByDays(t, temp, "A", "new", 9),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象/対象外のメールが削除されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               22 |
+| A     |               1 |            1,000 |
++-------+-----------------+------------------+
+| Total |               3 |            1,022 |
++-------+-----------------+------------------+
+Dry run. The following mails would be deleted.
+  %s
+  %s
+  %s
+`, temp, 10, targetMails[0].FullPath, targetMails[1].FullPath, targetMails[2].FullPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_KeepFlaggedAndUnread(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 削除対象(10日以上経過、既読、フラグ無し)
+	targetMails := []collector.Mail{
+		// INBOX
+		createMailByDaysAndFlags(t, temp, "", "cur", 10, "S"),
+		createMailByDaysAndFlags(t, temp, "", "cur", 11, "RS"),
+		// A
+		createMailByDaysAndFlags(t, temp, "A", "cur", 12, "ST"),
+	}
+
+	// 削除対象外(フラグ付き or 未読)
+	nonTargetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "new", 12),
+		createMailByDaysAndFlags(t, temp, "", "cur", 13, "FS"),
+		createMailByDaysAndFlags(t, temp, "", "cur", 14, ""),
+		// A
+		createMailByDaysAndFlags(t, temp, "A", "cur", 15, "F"),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--keep-flagged",
+		"--keep-unread",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象のメールが削除されていること
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+
+	// 対象外のメールが削除されていないこと
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               21 |
+| A     |               1 |               12 |
++-------+-----------------+------------------+
+| Total |               3 |               33 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, temp, 10)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_HeaderFilters(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 削除対象(10日以上経過、かつ、ヘッダが一致)
+	targetMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 10, "From: noreply@example.com\nList-Id: <news.example.com>\nSubject: =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\n\nbody"),
+		createMailByDaysAndContent(t, temp, "A", "cur", 11, "From: Info <NoReply@example.com>\nList-Id: <news.example.com>\nSubject: [news] =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\n\nbody"),
+	}
+
+	// 削除対象外
+	nonTargetMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 12, "From: info@example.com\nList-Id: <news.example.com>\nSubject: =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\n\nbody"),
+		createMailByDaysAndContent(t, temp, "", "cur", 13, "From: noreply@example.com\nList-Id: <other.example.com>\nSubject: =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\n\nbody"),
+		createMailByDaysAndContent(t, temp, "", "cur", 14, "From: noreply@example.com\nList-Id: <news.example.com>\nSubject: Hello\n\nbody"),
+		createMailByDaysAndContent(t, temp, "", "cur", 9, "From: noreply@example.com\nList-Id: <news.example.com>\nSubject: =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\n\nbody"),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--from", "noreply@*",
+		"--subject", "*テスト",
+		"--header", "List-Id=~<news\\.",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象のメールが削除されていること
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+
+	// 対象外のメールが削除されていないこと
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |              103 |
+| A     |               1 |              117 |
++-------+-----------------+------------------+
+| Total |               2 |              220 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, temp, 10)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_InvalidHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--header", "List-Id",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid header filter 'List-Id'")
+}
+
 func TestDeleteCmd_Empty(t *testing.T) {
 
 	// ARRANGE
 	temp := t.TempDir()
 
-	// 削除対象外のみ
-	nonTargetMails := []collector.Mail{
-		// INBOX
-		createMailByDays(t, temp, "", "new", 1),
-		createMailByDays(t, temp, "", "new", 9),
-		createMailByDays(t, temp, "", "cur", 10),
-		createMailByDays(t, temp, "", "tmp", 11),
-		// A
-		createMailByDays(t, temp, "A", "new", 9),
-		// A.B
-		createMailByDays(t, temp, "A.B", "cur", 1),
-		// テスト1
-		createMailByDays(t, temp, "テスト1", "cur", 9),
+	// 削除対象外のみ
+	nonTargetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "new", 1),
+		createMailByDays(t, temp, "", "new", 9),
+		createMailByDays(t, temp, "", "cur", 10),
+		createMailByDays(t, temp, "", "tmp", 11),
+		// A
+		createMailByDays(t, temp, "A", "new", 9),
+		// A.B
+		createMailByDays(t, temp, "A.B", "cur", 1),
+		// テスト1
+		createMailByDays(t, temp, "テスト1", "cur", 9),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "11",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象外のメールが削除されていないこと
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. There were no target mails.
+`, temp, 11)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_ToTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+
+	// ゴミ箱に移動(10日以上経過)
+	movedMails := []collector.Mail{
+		createMailByDaysAndFlags(t, temp, "", "cur", 12, "S"),
+		createMailByDays(t, temp, "A", "new", 10),
+	}
+
+	// 削除(ゴミ箱にあり10日以上経過)
+	deletedMails := []collector.Mail{
+		createMailByDaysAndFlags(t, temp, "Trash", "cur", 11, "ST"),
+	}
+
+	// 対象外(10日未満)
+	nonTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "new", 9),
+		createMailByDaysAndFlags(t, temp, "Trash", "cur", 9, "ST"),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--to-trash",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// Tフラグを付けてゴミ箱に移動されていること
+	for _, mail := range movedMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	assert.FileExists(t, filepath.Join(temp, ".Trash", "cur", movedMails[0].FileName[:len(movedMails[0].FileName)-1]+"ST"))
+	assert.FileExists(t, filepath.Join(temp, ".Trash", "cur", movedMails[1].FileName+":2,T"))
+
+	for _, mail := range deletedMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	assert.Equal(t, "A\nTrash\n", test.ReadFile(t, subscriptionsPath))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               12 |
+| A     |               1 |               10 |
+| Trash |               1 |               11 |
++-------+-----------------+------------------+
+| Total |               3 |               33 |
++-------+-----------------+------------------+
+Starts moving mails to the trash folder. trash folder: Trash
+Completed moving to the trash folder. moved: 2 deleted: 1
+`, temp, 10)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_ToTrashDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "A", "new", 10),
+		createMailByDaysAndFlags(t, temp, "Junk.Trash", "cur", 11, "S"),
+		createMailByDaysAndFlags(t, temp, "Junk", "cur", 12, "S"),
+	}
+	test.CreateMailFolder(t, temp, "")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--to-trash",
+		"--trash-folder", "Junk.Trash",
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 移動/削除されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	assert.Equal(t, "A\n", test.ReadFile(t, subscriptionsPath))
+
+	// 標準出力の内容確認
+	trashFolderPath := filepath.Join(temp, ".Junk.Trash", "cur")
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++------------+-----------------+------------------+
+| Name       | Number of mails | Total size(byte) |
++------------+-----------------+------------------+
+| A          |               1 |               10 |
+| Junk       |               1 |               12 |
+| Junk.Trash |               1 |               11 |
++------------+-----------------+------------------+
+|      Total |               3 |               33 |
++------------+-----------------+------------------+
+Dry run. The mails would be moved to the trash folder as listed below.
+Folders to be subscribed:
+  Junk
+  Junk.Trash
+Mails to be moved:
+  %s -> %s
+  %s -> %s
+Mails to be deleted:
+  %s
+`, temp, 10,
+		targetMails[0].FullPath, filepath.Join(trashFolderPath, targetMails[0].FileName+":2,T"),
+		targetMails[2].FullPath, filepath.Join(trashFolderPath, targetMails[2].FileName+"T"),
+		targetMails[1].FullPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_ToTrashConflict(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Trash\n")
+
+	movedMail := createMailByDaysAndFlags(t, temp, "", "cur", 12, "S")
+	test.CreateFile(t, movedMail.FullPath, "moved")
+
+	// ゴミ箱に移動後と同じ名前のものが既にある
+	existingPath := filepath.Join(test.CreateMailFolder(t, temp, ".Trash"), "cur", movedMail.FileName+"T")
+	test.CreateFile(t, existingPath, "existing")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--exclude-folder", "Trash",
+		"--to-trash",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 既にあるものは置き換えずに、新たな名前で移動されていること
+	assert.NoFileExists(t, movedMail.FullPath)
+	assert.Equal(t, "existing", test.ReadFile(t, existingPath))
+
+	trashedPaths, err := filepath.Glob(filepath.Join(temp, ".Trash", "cur", "*"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(trashedPaths))
+	for _, trashedPath := range trashedPaths {
+		if trashedPath != existingPath {
+			assert.Equal(t, "moved", test.ReadFile(t, trashedPath))
+		}
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |                5 |
++-------+-----------------+------------------+
+| Total |               1 |                5 |
++-------+-----------------+------------------+
+Starts moving mails to the trash folder. trash folder: Trash
+Completed moving to the trash folder. moved: 1 deleted: 0
+Conflicts with existing files: 1 (renamed: 1)
+  %s -> %s (renamed)
+`, temp, 10, movedMail.FullPath, existingPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_OutputNDJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 10),
+		createMailByDays(t, temp, "A", "cur", 11),
+	}
+	nonTargetMail := createMailByDays(t, temp, "A", "cur", 1)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--output", "ndjson",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	assert.FileExists(t, nonTargetMail.FullPath)
+
+	// 1行に1レコード
+	expected := fmt.Sprintf(`{"record":"folder","user":"%s","maildir":"%s","status":"","error":"","rule":"","action":"","folder":"","archiveFolder":"","source":"","destination":"","count":1,"size":10,"path":"","subDir":"","fileName":"","time":"","subject":"","from":""}
+{"record":"folder","user":"%s","maildir":"%s","status":"","error":"","rule":"","action":"","folder":"A","archiveFolder":"","source":"","destination":"","count":1,"size":11,"path":"","subDir":"","fileName":"","time":"","subject":"","from":""}
+{"record":"maildir","user":"%s","maildir":"%s","status":"ok","error":"","rule":"","action":"","folder":"","archiveFolder":"","source":"","destination":"","count":2,"size":21,"path":"","subDir":"","fileName":"","time":"","subject":"","from":""}
+{"record":"total","user":"","maildir":"","status":"","error":"","rule":"","action":"","folder":"","archiveFolder":"","source":"","destination":"","count":2,"size":21,"path":"","subDir":"","fileName":"","time":"","subject":"","from":""}
+`, temp, temp, temp, temp, temp, temp)
+	assert.Equal(t, expected, stdout.String())
+
+	expectedProgress := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
+Starts deleting mails.
+Completed deletion.
+`, temp, 10)
+	assert.Equal(t, expectedProgress, stderr.String())
+}
+
+func TestDeleteCmd_MaildirNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootMailFolderPath := filepath.Join(temp, "xx") // 存在しないフォルダ
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", rootMailFolderPath,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + rootMailFolderPath
+	assert.Contains(t, err.Error(), expect)
+}
+
+func TestDeleteCmd_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 10),
+		createMailByDays(t, temp, "B", "cur", 11),
+	}
+
+	// 読み込めないフォルダ(curがファイル)
+	brokenPath := createBrokenFolder(t, temp, "A")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--keep-going",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// 最後まで処理した上で、失敗があったことが分かるように
+	require.EqualError(t, err, "failed to process 1 mails")
+	var failedErr *failedMailsError
+	assert.ErrorAs(t, err, &failedErr)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               10 |
+| B     |               1 |               11 |
++-------+-----------------+------------------+
+| Total |               2 |               21 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+Failed to process 1 mails. The failures are listed below.
++-------+--------------------+
+| Name  | Number of failures |
++-------+--------------------+
+| A     |                  1 |
++-------+--------------------+
+| Total |                  1 |
++-------+--------------------+
+  %s (%s)
+`, temp, 10, brokenPath, readDirError(t, brokenPath))
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_WithoutKeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMail := createMailByDays(t, temp, "", "cur", 10)
+	brokenPath := createBrokenFolder(t, temp, "A")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// 指定しない場合はこれまで通り中断
+	require.EqualError(t, err, readDirError(t, brokenPath))
+	assert.FileExists(t, targetMail.FullPath)
+}
+
+func TestDeleteCmd_ToTrashKeepGoingOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	movedMail := createMailByDays(t, temp, "", "cur", 10)
+	deletedMail := createMailByDays(t, temp, "Trash", "cur", 12)
+
+	// フラグを付けるとファイル名が長すぎて移動できない
+	failedPath, _ := test.CreateMailByName(
+		t, test.CreateMailFolder(t, temp, ".A"), "cur",
+		fmt.Sprintf("%d.%s", test.AgoDays(t, 11).Unix(), strings.Repeat("x", 242)), 11)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--to-trash",
+		"--keep-going",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 mails")
+
+	assert.NoFileExists(t, movedMail.FullPath)
+	assert.FileExists(t, failedPath)
+	assert.NoFileExists(t, deletedMail.FullPath)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	// 移動や削除ができたもののみ
+	assert.Equal(t, []folderReport{
+		{Name: "", Count: 1, Size: 10},
+		{Name: "Trash", Count: 1, Size: 12},
+	}, output.Maildirs[0].Folders)
+	assert.Equal(t, 1, len(output.Maildirs[0].Failures))
+	assert.Equal(t, failedPath, output.Maildirs[0].Failures[0].Path)
+}
+
+func TestDeleteCmd_TargetSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 40),
+		createMailByDays(t, temp, "A", "cur", 30),
+	}
+	otherMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 20),
+		createMailByDays(t, temp, "A", "cur", 10),
+		createMailByDays(t, temp, "B", "cur", 50), // 対象外のフォルダ
 	}
 
 	rootCmd := newRootCmd()
 	rootCmd.SetArgs([]string{
 		"delete",
 		"-d", temp,
-		"-a", "11",
+		"--target-size", "90",
+		"--exclude-folder", "B",
 	})
 
 	buf := new(bytes.Buffer)
@@ -213,31 +921,103 @@ func TestDeleteCmd_Empty(t *testing.T) {
 	// ASSERT
 	require.NoError(t, err)
 
-	// 対象外のメールが削除されていないこと
-	for _, mail := range nonTargetMails {
+	// 150 -> 90 以下になるまで古いものから (対象外のフォルダもサイズに含める)
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range otherMails {
 		assert.FileExists(t, mail.FullPath)
 	}
 
 	// 標準出力の内容確認
 	result := buf.String()
-	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
-Completed search. There were no target mails.
-`, temp, 11)
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 0 target size: 90 order: oldest
+Mailbox size: 150 target size: 90 selected: 70
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               40 |
+| A     |               1 |               30 |
++-------+-----------------+------------------+
+| Total |               2 |               70 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+Freed 70 of the 60 needed. mailbox size: 150 -> 80
+`, temp)
 	assert.Equal(t, expected, result)
 }
 
-func TestDeleteCmd_MaildirNotFound(t *testing.T) {
+func TestDeleteCmd_TargetSizeLargeExcludedFolder(t *testing.T) {
 
 	// ARRANGE
 	temp := t.TempDir()
 
-	rootMailFolderPath := filepath.Join(temp, "xx") // 存在しないフォルダ
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 20),
+		createMailByDays(t, temp, "A", "cur", 10),
+	}
+	excludedMail := createMailByDaysAndContent(t, temp, "B", "cur", 30, strings.Repeat("x", 500))
 
 	rootCmd := newRootCmd()
 	rootCmd.SetArgs([]string{
 		"delete",
-		"-d", rootMailFolderPath,
+		"-d", temp,
+		"--target-size", "100",
+		"--exclude-folder", "B",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象外のフォルダは選ばれないので、全て削除しても目標サイズに届かない
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	assert.FileExists(t, excludedMail.FullPath)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	assert.Equal(t, &targetSizeReport{
+		MailboxSize: 530,
+		TargetSize:  100,
+		FreedSize:   30,
+		Reached:     false,
+	}, output.Maildirs[0].TargetSize)
+	assert.Contains(t, stderr.String(), "Freed 30 of the 430 needed. mailbox size: 530 -> 500\nThe mailbox size is still over the target size.\n")
+}
+
+func TestDeleteCmd_TargetSizeLargestWithAge(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	largeMail := createMailByDaysAndContent(t, temp, "", "cur", 20, "0123456789")
+	smallMail := createMailByDaysAndContent(t, temp, "", "cur", 30, "01234")
+	newMail := createMailByDaysAndContent(t, temp, "", "cur", 1, "01234567890123456789") // 経過日数未満
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
 		"-a", "10",
+		"--target-size", "5",
+		"--target-order", "largest",
+		"--dry-run",
 	})
 
 	buf := new(bytes.Buffer)
@@ -247,10 +1027,253 @@ func TestDeleteCmd_MaildirNotFound(t *testing.T) {
 	err := rootCmd.Execute()
 
 	// ASSERT
-	require.Error(t, err)
-	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
-	expect := "open " + rootMailFolderPath
-	assert.Contains(t, err.Error(), expect)
+	require.NoError(t, err)
+
+	// dry-runなので消えない
+	assert.FileExists(t, largeMail.FullPath)
+	assert.FileExists(t, smallMail.FullPath)
+	assert.FileExists(t, newMail.FullPath)
+
+	// 経過日数を満たすものを全て選んでも届かない
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 10 target size: 5 order: largest
+Mailbox size: 35 target size: 5 selected: 15
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               15 |
++-------+-----------------+------------------+
+| Total |               2 |               15 |
++-------+-----------------+------------------+
+Dry run. The following mails would be deleted.
+  %s
+  %s
+Would free 15 of the 30 needed. mailbox size: 35 -> 20
+The mailbox size is still over the target size.
+`, temp, smallMail.FullPath, largeMail.FullPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_TargetSizeAlreadyUnderTarget(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mail := createMailByDays(t, temp, "", "cur", 10)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"--target-size", "1KB",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.FileExists(t, mail.FullPath)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 0 target size: 1,000 order: oldest
+Mailbox size: 10 target size: 1,000 selected: 0
+Completed search. There were no target mails.
+Freed 0 of the 0 needed. mailbox size: 10 -> 10
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_AgeRequired(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+	})
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	assert.EqualError(t, err, "one of --age, --target-size or --keep-last must be specified")
+}
+
+func TestDeleteCmd_TargetSizeWithToTrash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"--target-size", "1GB",
+		"--to-trash",
+	})
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	assert.EqualError(t, err, "--target-size cannot be used with --to-trash")
+}
+
+func TestDeleteCmd_InvalidTargetSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	for _, args := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--target-size", "abc"}, "invalid target-size 'abc'"},
+		{[]string{"--target-size", "1GB", "--target-order", "newest"}, "invalid target-order 'newest'"},
+		{[]string{"-a", "10", "--target-order", "largest"}, "--target-order can only be used with --target-size"},
+	} {
+		rootCmd := newRootCmd()
+		rootCmd.SetArgs(append([]string{"delete", "-d", temp}, args.args...))
+		rootCmd.SetOutput(new(bytes.Buffer))
+
+		// ACT
+		err := rootCmd.Execute()
+
+		// ASSERT
+		assert.EqualError(t, err, args.expected)
+	}
+}
+
+func TestDeleteCmd_KeepLast(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 40),
+		createMailByDays(t, temp, "Sent", "cur", 30),
+		createMailByDays(t, temp, "Sent", "cur", 20),
+	}
+	otherMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 30),
+		createMailByDays(t, temp, "", "cur", 20),
+		createMailByDays(t, temp, "", "cur", 5), // 経過日数未満
+		createMailByDays(t, temp, "Sent", "cur", 10),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "15",
+		"--keep-last", "3",
+		"--keep-last", "Sent=1",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range otherMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 15
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               40 |
+| Sent  |               2 |               50 |
++-------+-----------------+------------------+
+| Total |               3 |               90 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_InvalidKeepLast(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	for _, value := range []string{"abc", "-1", "Sent=", "Sent=x"} {
+		rootCmd := newRootCmd()
+		rootCmd.SetArgs([]string{
+			"delete",
+			"-d", temp,
+			"--keep-last", value,
+		})
+		rootCmd.SetOutput(new(bytes.Buffer))
+
+		// ACT
+		err := rootCmd.Execute()
+
+		// ASSERT
+		assert.EqualError(t, err, fmt.Sprintf("invalid keep-last '%s'", value))
+	}
+}
+
+func TestDeleteCmd_ThreadAware(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 40, "Message-ID: <1@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <2@example.com>\nIn-Reply-To: <1@example.com>\n\nbody"),
+	}
+	otherMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 50, "Message-ID: <3@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "Sent", "cur", 5, "Message-ID: <4@example.com>\nIn-Reply-To: <3@example.com>\n\nbody"),
+		// 対象外のフォルダにある新しい返信も考慮
+		createMailByDaysAndContent(t, temp, "", "cur", 60, "Message-ID: <5@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "Archived", "cur", 1, "Message-ID: <6@example.com>\nReferences: <5@example.com>\n\nbody"),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--exclude-folder", "Archived",
+		"--thread-aware",
+	})
+
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range otherMails {
+		assert.FileExists(t, mail.FullPath)
+	}
 }
 
 func createMailByDays(t *testing.T, rootDir string, folderName string, sub string, days int) collector.Mail {
@@ -279,6 +1302,43 @@ func createMailByDays(t *testing.T, rootDir string, folderName string, sub strin
 	}
 }
 
+func createMailByDaysAndFlags(t *testing.T, rootDir string, folderName string, sub string, days int, flags string) collector.Mail {
+
+	encodedFolderName, _ := folder.EncodeMailFolderName(folderName)
+	var physicalFolderName string
+	if encodedFolderName == "" {
+		physicalFolderName = encodedFolderName
+	} else {
+		physicalFolderName = "." + encodedFolderName
+	}
+	folderDir := test.CreateMailFolder(t, rootDir, physicalFolderName)
+
+	size := days // サイズは経過日と同じにしておく
+	time := test.AgoDays(t, days)
+
+	mailPath, fileName := test.CreateMailByName(t, folderDir, sub, fmt.Sprintf("%d.localhost:2,%s", time.Unix(), flags), size)
+
+	return collector.Mail{
+		FullPath:   mailPath,
+		FolderName: folderName,
+		SubDirName: sub,
+		FileName:   fileName,
+		Size:       int64(size),
+		Time:       time,
+		Flags:      collector.MailFlags(fileName),
+	}
+}
+
+func createMailByDaysAndContent(t *testing.T, rootDir string, folderName string, sub string, days int, content string) collector.Mail {
+
+	mail := createMailByDays(t, rootDir, folderName, sub, days)
+
+	info := test.CreateFile(t, mail.FullPath, content)
+	mail.Size = info.Size()
+
+	return mail
+}
+
 func createMailByYearMonth(t *testing.T, rootDir string, folderName string, sub string, year int, month time.Month) collector.Mail {
 
 	encodedFolderName, _ := folder.EncodeMailFolderName(folderName)
@@ -304,3 +1364,22 @@ func createMailByYearMonth(t *testing.T, rootDir string, folderName string, sub
 		Time:       time,
 	}
 }
+
+func createBrokenFolder(t *testing.T, rootDir string, folderName string) string {
+
+	// curがファイルとなっていて読み込めないフォルダ
+	folderDir := test.CreateDir(t, rootDir, "."+folderName)
+	brokenPath := filepath.Join(folderDir, "cur")
+	test.CreateFile(t, brokenPath, "")
+
+	return brokenPath
+}
+
+func readDirError(t *testing.T, path string) string {
+
+	// OSによってエラーメッセージが異なるので、実際のエラーから
+	_, err := os.ReadDir(path)
+	require.Error(t, err)
+
+	return err.Error()
+}
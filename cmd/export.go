@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newExportCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export old mails to files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirTargets := newDirTarget(cmd.Flags())
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			exportNameGenerator, err := newExportNameGenerator(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			if err := requireAgeOr(cmd.Flags(), "keep-last"); err != nil {
+				return err
+			}
+
+			condition, err := newCondition(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			formatValue, _ := cmd.Flags().GetString("format")
+			format, err := action.ParseExportFormat(formatValue)
+			if err != nil {
+				return err
+			}
+
+			exportDirPath, _ := cmd.Flags().GetString("export-dir")
+			removeAfterExport, _ := cmd.Flags().GetBool("remove-after-export")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			// mboxは従来通り常に元のメールを削除、tarは指定された場合のみ削除
+			removeSources := !format.IsTar() || removeAfterExport
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runExport(
+					maildirPath,
+					*condition,
+					exportDirPath,
+					exportNameGenerator,
+					format,
+					removeSources,
+					dryRun,
+					writer,
+					output.isTable())
+			})
+		},
+	}
+
+	// ユーザ毎に別の出力先となるべきなので、複数のmaildirは指定できない
+	addDirFlag(subCmd)
+	subCmd.Flags().Int64P("age", "a", 0, "The number of age days to be exported.\nIf you specify 10, mail that has been in the mailbox for more than 10 days since its arrival will be exported.")
+
+	subCmd.Flags().StringP("export-dir", "", "", "Directory to write the export files.")
+	subCmd.MarkFlagRequired("export-dir")
+	subCmd.Flags().StringP("export-name", "", "Archived", "Base name of the export files.")
+	subCmd.Flags().StringP("export-pattern", "", "keep", "Export pattern. can be specified: keep, year, month, template\nThe export files are divided in the same way as the archive folders.")
+	subCmd.Flags().StringP("export-template", "", "", "Template of the export file name. (used with --export-pattern template)")
+	subCmd.Flags().StringP("format", "", string(action.ExportMbox), "Format of the export files. can be specified: mbox, mbox.gz, tar.gz, tar.zst")
+	subCmd.Flags().BoolP("remove-after-export", "", false, "Remove the source mails after the archive is fully written. (used with --format tar.gz, tar.zst)\nWith mbox and mbox.gz, the source mails are always removed.")
+	addConditionFlags(subCmd.Flags())
+	subCmd.Flags().BoolP("dry-run", "", false, "Show how the mails would be exported without actually exporting them.")
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runExport(maildirPath string, condition collector.Condition, exportDirPath string, exportNameGenerator action.ArchiveFolderNameGenerator, format action.ExportFormat, removeSources bool, dryRun bool, writer io.Writer, renderTable bool) (*report, error) {
+
+	// 対象のメールを収集
+	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d\n", maildirPath, condition.AgeOfDays)
+	collector := collector.NewConditionCollector(condition)
+	mails, err := collector.Collect(maildirPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*mails) == 0 {
+		// エクスポート対象無し
+		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
+		return &report{}, nil
+	}
+
+	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
+	if renderTable {
+		renderTargetMails(writer, mails)
+	}
+
+	if dryRun {
+		// エクスポートした場合の内容を表示するのみ
+		exportedMails, err := action.PlanExport(exportDirPath, mails, exportNameGenerator, format)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be exported as listed below.\n")
+		if renderTable {
+			renderExportFiles(writer, exportedMails)
+		}
+		fmt.Fprintf(writer, "Mails to be exported:\n")
+		for _, exportedMail := range exportedMails {
+			fmt.Fprintf(writer, "  %s -> %s\n", exportedMail.Mail.FullPath, exportedMail.ExportPath)
+		}
+
+		report := newReport("", "", mails)
+		report.addExportedMails(exportedMails)
+		return report, nil
+	}
+
+	// エクスポート実施
+	fmt.Fprintf(writer, "Starts exporting mails. export dir: %s format: %s\n", exportDirPath, format)
+	exportedMails, err := action.Export(exportDirPath, mails, exportNameGenerator, format, removeSources)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(writer, "Completed export. The export files are listed below.\n")
+	if renderTable {
+		renderExportFiles(writer, exportedMails)
+	}
+
+	report := newReport("", "", mails)
+	report.addExportedMails(exportedMails)
+	return report, nil
+}
+
+func newExportNameGenerator(f *pflag.FlagSet) (action.ArchiveFolderNameGenerator, error) {
+
+	exportName, _ := f.GetString("export-name")
+	exportPattern, _ := f.GetString("export-pattern")
+	exportTemplate, _ := f.GetString("export-template")
+
+	location, err := getLocation(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// アーカイブフォルダ名と同じ規則で出力先を分ける
+	return newFolderNameGenerator("export", exportName, exportPattern, exportTemplate, location)
+}
@@ -0,0 +1,415 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	exportDirPath := filepath.Join(temp, "export")
+
+	// エクスポート対象
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "", "cur", 2020, 12),
+		createMailByYearMonth(t, maildirPath, "", "new", 2021, 1),
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2021, 2),
+	}
+
+	// エクスポート対象外
+	nonTargetMails := []collector.Mail{
+		createMailByDays(t, maildirPath, "", "new", 1),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", maildirPath,
+		"-a", "10",
+		"--export-dir", exportDirPath,
+		"--export-pattern", "year",
+		"--format", "mbox.gz",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.2020.mbox.gz"))
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.2021.mbox.gz"))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |            4,054 |
+| A     |               1 |            2,023 |
++-------+-----------------+------------------+
+| Total |               3 |            6,077 |
++-------+-----------------+------------------+
+Starts exporting mails. export dir: %s format: mbox.gz
+Completed export. The export files are listed below.
++-----------------------+-----------------+------------------+
+| Export file           | Number of mails | Total size(byte) |
++-----------------------+-----------------+------------------+
+| Archived.2020.mbox.gz |               1 |            2,032 |
+| Archived.2021.mbox.gz |               2 |            4,045 |
++-----------------------+-----------------+------------------+
+|                 Total |               3 |            6,077 |
++-----------------------+-----------------+------------------+
+`, maildirPath, 10, exportDirPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestExportCmd_TarZst(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	exportDirPath := filepath.Join(temp, "export")
+
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "", "cur", 2020, 12),
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2021, 1),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", maildirPath,
+		"-a", "10",
+		"--export-dir", exportDirPath,
+		"--format", "tar.zst",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// --remove-after-export が無いので元のメールは残ること
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.tar.zst"))
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.manifest.json"))
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.A.tar.zst"))
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.A.manifest.json"))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |            2,032 |
+| A     |               1 |            2,022 |
++-------+-----------------+------------------+
+| Total |               2 |            4,054 |
++-------+-----------------+------------------+
+Starts exporting mails. export dir: %s format: tar.zst
+Completed export. The export files are listed below.
++--------------------+-----------------+------------------+
+| Export file        | Number of mails | Total size(byte) |
++--------------------+-----------------+------------------+
+| Archived.A.tar.zst |               1 |            2,022 |
+| Archived.tar.zst   |               1 |            2,032 |
++--------------------+-----------------+------------------+
+|              Total |               2 |            4,054 |
++--------------------+-----------------+------------------+
+`, maildirPath, 10, exportDirPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestExportCmd_TarGzRemoveAfterExport(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	exportDirPath := filepath.Join(temp, "export")
+
+	targetMail := createMailByYearMonth(t, maildirPath, "", "cur", 2020, 12)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", maildirPath,
+		"-a", "10",
+		"--export-dir", exportDirPath,
+		"--format", "tar.gz",
+		"--remove-after-export",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMail.FullPath)
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.tar.gz"))
+	assert.FileExists(t, filepath.Join(exportDirPath, "Archived.manifest.json"))
+}
+
+func TestExportCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	exportDirPath := filepath.Join(temp, "export")
+
+	test.CreateMailFolder(t, maildirPath, "")
+	targetMails := []collector.Mail{
+		createMailByYearMonth(t, maildirPath, "A", "cur", 2020, 12),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", maildirPath,
+		"-a", "10",
+		"--export-dir", exportDirPath,
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 出力されていないこと
+	assert.FileExists(t, targetMails[0].FullPath)
+	assert.NoDirExists(t, exportDirPath)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+| A     |               1 |            2,032 |
++-------+-----------------+------------------+
+| Total |               1 |            2,032 |
++-------+-----------------+------------------+
+Dry run. The mails would be exported as listed below.
++-----------------+-----------------+------------------+
+| Export file     | Number of mails | Total size(byte) |
++-----------------+-----------------+------------------+
+| Archived.A.mbox |               1 |            2,032 |
++-----------------+-----------------+------------------+
+|           Total |               1 |            2,032 |
++-----------------+-----------------+------------------+
+Mails to be exported:
+  %s -> %s
+`, maildirPath, 10,
+		targetMails[0].FullPath, filepath.Join(exportDirPath, "Archived.A.mbox"))
+	assert.Equal(t, expected, result)
+}
+
+func TestExportCmd_OutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	maildirPath := test.CreateDir(t, temp, "Maildir")
+	exportDirPath := filepath.Join(temp, "export")
+
+	targetMail := createMailByYearMonth(t, maildirPath, "", "cur", 2020, 12)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", maildirPath,
+		"-a", "10",
+		"--export-dir", exportDirPath,
+		"-o", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expected := fmt.Sprintf(`{
+  "command": "export",
+  "dryRun": false,
+  "maildirs": [
+    {
+      "user": "%[1]s",
+      "maildir": "%[1]s",
+      "status": "ok",
+      "folders": [
+        {
+          "name": "",
+          "count": 1,
+          "size": 2032
+        }
+      ],
+      "total": {
+        "count": 1,
+        "size": 2032
+      },
+      "archived": [],
+      "exported": [
+        {
+          "folder": "",
+          "source": "%[2]s",
+          "destination": "%[3]s",
+          "size": 2032
+        }
+      ]
+    }
+  ],
+  "total": {
+    "count": 1,
+    "size": 2032
+  }
+}
+`, maildirPath, targetMail.FullPath, filepath.Join(exportDirPath, "Archived.mbox"))
+	assert.Equal(t, expected, stdout.String())
+}
+
+func TestExportCmd_InvalidFormat(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", temp,
+		"-a", "10",
+		"--export-dir", filepath.Join(temp, "export"),
+		"--format", "zip",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid format 'zip'")
+}
+
+func TestExportCmd_InvalidExportPattern(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-d", temp,
+		"-a", "10",
+		"--export-dir", filepath.Join(temp, "export"),
+		"--export-pattern", "xxx",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid export-pattern 'xxx'")
+}
+
+func TestExportCmd_MultipleMaildirs(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user1"), "")
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user2"), "")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"--dir-glob", filepath.Join(temp, "*"),
+		"-a", "10",
+		"--export-dir", filepath.Join(temp, "export"),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "unknown flag: --dir-glob")
+}
+
+func TestExportCmd_DirRequired(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"export",
+		"-a", "10",
+		"--export-dir", filepath.Join(temp, "export"),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, `required flag(s) "dir" not set`)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/spf13/pflag"
+)
+
+func addJournalFlags(f *pflag.FlagSet) {
+	f.StringP("journal", "", "", "Journal file path to record each file operation. (appended if it exists)\nThe recorded operations can be undone with the undo command.")
+	f.StringP("resume", "", "", "Journal file path of the interrupted run to resume.\nThe interrupted operations are completed first, and the rest is recorded in the same journal.")
+}
+
+// --resume は中断した操作を完了させる(メールボックスを変更する)ので、他の引数の確認が全て終わってから呼び出すこと
+func openJournal(f *pflag.FlagSet, writer io.Writer) (*action.Journal, error) {
+
+	journalPath, _ := f.GetString("journal")
+	resumePath, _ := f.GetString("resume")
+	dryRun, _ := f.GetBool("dry-run")
+
+	if journalPath != "" && resumePath != "" {
+		return nil, fmt.Errorf("--journal and --resume cannot be used together")
+	}
+	if dryRun && (journalPath != "" || resumePath != "") {
+		// 実際には操作しないので記録するものが無い
+		return nil, fmt.Errorf("--journal and --resume cannot be used with --dry-run")
+	}
+
+	if journalPath != "" {
+		return action.OpenJournal(journalPath)
+	}
+
+	if resumePath != "" {
+		journal, result, err := action.ResumeJournal(resumePath)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(writer, "Resumed the journal. journal: %s completed: %d retried: %d\n", resumePath, len(result.Completed), len(result.Retried))
+		return journal, nil
+	}
+
+	// ジャーナル無し
+	return nil, nil
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteCmd_Resume(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal")
+
+	deletedMail := createMailByDays(t, temp, "", "cur", 20)
+	remainingMail := createMailByDays(t, temp, "", "cur", 30)
+
+	// 1件目の削除後、完了を記録する前に中断されたもの
+	test.CreateFile(t, journalPath, fmt.Sprintf(`{"time":"2024-01-01T00:00:00Z","operation":"delete","status":"started","folder":"","source":%q,"size":20}
+`, deletedMail.FullPath))
+	require.NoError(t, os.Remove(deletedMail.FullPath))
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--resume", journalPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, remainingMail.FullPath)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Resumed the journal. journal: %s completed: 1 retried: 0
+Starts searching for the target mails. maildir: %s age: 10
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               30 |
++-------+-----------------+------------------+
+| Total |               1 |               30 |
++-------+-----------------+------------------+
+Starts deleting mails.
+Completed deletion.
+`, journalPath, temp)
+	assert.Equal(t, expected, result)
+
+	// 続きも同じジャーナルに記録されること
+	assert.Equal(t, 4, len(bytes.Split(bytes.TrimSpace([]byte(test.ReadFile(t, journalPath))), []byte("\n"))))
+}
+
+func TestDeleteCmd_JournalAndResume(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"-a", "10",
+		"--journal", filepath.Join(temp, "journal"),
+		"--resume", filepath.Join(temp, "journal"),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--journal and --resume cannot be used together")
+}
+
+func TestDeleteCmd_ResumeInvalidArgs(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "journal")
+
+	interruptedMail := createMailByDays(t, temp, "", "cur", 20)
+
+	// ゴミ箱へのコピー後、移動元の削除前に中断されたもの (再開すると移動元が削除される)
+	trashedPath := filepath.Join(test.CreateMailFolder(t, temp, ".Trash"), "cur", interruptedMail.FileName+":2,T")
+	test.CreateFile(t, trashedPath, test.ReadFile(t, interruptedMail.FullPath))
+	journal := fmt.Sprintf(`{"time":"2024-01-01T00:00:00Z","operation":"trash","status":"started","folder":"","source":%q,"destination":%q,"size":20}
+`, interruptedMail.FullPath, trashedPath)
+	test.CreateFile(t, journalPath, journal)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"-d", temp,
+		"--target-size", "10",
+		"--to-trash",
+		"--resume", journalPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--target-size cannot be used with --to-trash")
+
+	// 引数が誤っている場合は、中断された操作も再開しないこと
+	assert.FileExists(t, interruptedMail.FullPath)
+	assert.Equal(t, journal, test.ReadFile(t, journalPath))
+}
+
+func TestArchiveCmd_JournalDryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"archive",
+		"-d", temp,
+		"-a", "10",
+		"--journal", filepath.Join(temp, "journal"),
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--journal and --resume cannot be used with --dry-run")
+}
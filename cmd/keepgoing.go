@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// --keep-going で一部のメールを処理できなかった場合の終了ステータス (エラーで中断した場合の1と区別)
+const exitCodeFailedMails = 2
+
+type failedMailsError struct {
+	count int
+}
+
+func (e *failedMailsError) Error() string {
+	return fmt.Sprintf("failed to process %d mails", e.count)
+}
+
+func addKeepGoingFlag(f *pflag.FlagSet) {
+	f.BoolP("keep-going", "", false, "Continue even if some mails or folders cannot be processed, and list them at the end.\nExits with status 2 if there were any failures.")
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type maildir struct {
+	User string
+	Path string
+}
+
+type maildirTargets struct {
+	Maildirs    []maildir
+	Multiple    bool // 複数ユーザを対象とするか(ユーザ毎の集計を表示)
+	Concurrency int
+}
+
+func addMaildirFlags(cmd *cobra.Command) {
+
+	f := cmd.Flags()
+	f.StringP("dir", "d", "", "User maildir path.")
+	f.StringP("dir-glob", "", "", "Glob pattern of user maildir paths. (e.g. /var/vmail/*/*)")
+	f.StringP("dir-list", "", "", "File containing user maildir paths, one per line.")
+	f.BoolP("all-users", "", false, "Target the maildirs of all users in the passwd file.")
+	f.StringP("maildir-subpath", "", "Maildir", "Path of the maildir under the home directory. (used with --all-users)")
+	f.StringP("passwd-file", "", "/etc/passwd", "Path of the passwd file. (used with --all-users)")
+	f.IntP("concurrency", "", 1, "The number of maildirs to be processed concurrently.")
+	cmd.MarkFlagsMutuallyExclusive("dir", "dir-glob", "dir-list", "all-users")
+}
+
+// 1つのmaildirのみを対象とするコマンド用
+func addDirFlag(cmd *cobra.Command) {
+
+	cmd.Flags().StringP("dir", "d", "", "User maildir path.")
+	cmd.MarkFlagRequired("dir")
+}
+
+func newDirTarget(f *pflag.FlagSet) *maildirTargets {
+
+	dir, _ := f.GetString("dir")
+	return &maildirTargets{
+		Maildirs:    []maildir{{User: dir, Path: dir}},
+		Multiple:    false,
+		Concurrency: 1,
+	}
+}
+
+func newMaildirTargets(f *pflag.FlagSet) (*maildirTargets, error) {
+
+	dir, _ := f.GetString("dir")
+	dirGlob, _ := f.GetString("dir-glob")
+	dirList, _ := f.GetString("dir-list")
+	allUsers, _ := f.GetBool("all-users")
+	concurrency, _ := f.GetInt("concurrency")
+
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be 1 or more")
+	}
+
+	var maildirs []maildir
+	var err error
+
+	switch {
+	case dir != "":
+		return &maildirTargets{
+			Maildirs:    []maildir{{User: dir, Path: dir}},
+			Multiple:    false,
+			Concurrency: 1,
+		}, nil
+	case dirGlob != "":
+		maildirs, err = globMaildirs(dirGlob)
+	case dirList != "":
+		maildirs, err = readMaildirList(dirList)
+	case allUsers:
+		maildirSubpath, _ := f.GetString("maildir-subpath")
+		passwdPath, _ := f.GetString("passwd-file")
+		maildirs, err = passwdMaildirs(passwdPath, maildirSubpath)
+	default:
+		return nil, fmt.Errorf("one of --dir, --dir-glob, --dir-list or --all-users must be specified")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &maildirTargets{
+		Maildirs:    maildirs,
+		Multiple:    true,
+		Concurrency: concurrency,
+	}, nil
+}
+
+func globMaildirs(pattern string) ([]maildir, error) {
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dir-glob '%s': %w", pattern, err)
+	}
+
+	maildirs := []maildir{}
+	for _, path := range paths {
+		if isDir(path) {
+			maildirs = append(maildirs, maildir{User: path, Path: path})
+		}
+	}
+
+	if len(maildirs) == 0 {
+		return nil, fmt.Errorf("no maildir matched: %s", pattern)
+	}
+
+	sort.Slice(maildirs, func(i, j int) bool {
+		return maildirs[i].Path < maildirs[j].Path
+	})
+
+	return maildirs, nil
+}
+
+func readMaildirList(listPath string) ([]maildir, error) {
+
+	file, err := os.Open(listPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	maildirs := []maildir{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" || strings.HasPrefix(path, "#") {
+			// 空行とコメントは無視
+			continue
+		}
+		maildirs = append(maildirs, maildir{User: path, Path: path})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(maildirs) == 0 {
+		return nil, fmt.Errorf("no maildir in %s", listPath)
+	}
+
+	return maildirs, nil
+}
+
+func passwdMaildirs(passwdPath string, maildirSubpath string) ([]maildir, error) {
+
+	file, err := os.Open(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	maildirs := []maildir{}
+	foundPaths := map[string]bool{}
+
+	// name:password:uid:gid:gecos:home:shell
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || fields[5] == "" {
+			continue
+		}
+
+		// maildirが存在するユーザのみ
+		path := filepath.Join(fields[5], maildirSubpath)
+		if foundPaths[path] || !isDir(path) {
+			continue
+		}
+
+		maildirs = append(maildirs, maildir{User: fields[0], Path: path})
+		foundPaths[path] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(maildirs) == 0 {
+		return nil, fmt.Errorf("no user has %s in %s", maildirSubpath, passwdPath)
+	}
+
+	return maildirs, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+type maildirResult struct {
+	Output *bytes.Buffer
+	Report *report
+	Err    error
+}
+
+func (t *maildirTargets) run(output *output, run func(maildirPath string, writer io.Writer) (*report, error)) error {
+
+	if !t.Multiple {
+		maildirReport, err := run(t.Maildirs[0].Path, output.Progress)
+		if err != nil {
+			return err
+		}
+		if err := output.write([]*report{completeReport(t.Maildirs[0], maildirReport, nil)}); err != nil {
+			return err
+		}
+		return failedMails([]*report{maildirReport})
+	}
+
+	// 並列で処理し、出力はmaildirの順に
+	results := make([]chan maildirResult, len(t.Maildirs))
+	semaphore := make(chan struct{}, t.Concurrency)
+
+	for i, maildir := range t.Maildirs {
+		results[i] = make(chan maildirResult, 1)
+
+		go func(maildirPath string, result chan<- maildirResult) {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			buf := new(bytes.Buffer)
+			maildirReport, err := run(maildirPath, buf)
+			result <- maildirResult{Output: buf, Report: maildirReport, Err: err}
+		}(maildir.Path, results[i])
+	}
+
+	reports := make([]*report, len(t.Maildirs))
+	failedCount := 0
+
+	for i, maildir := range t.Maildirs {
+		result := <-results[i]
+
+		io.Copy(output.Progress, result.Output)
+		if result.Err != nil {
+			fmt.Fprintf(output.Progress, "Failed. maildir: %s error: %s\n", maildir.Path, result.Err)
+			failedCount++
+		}
+
+		reports[i] = completeReport(maildir, result.Report, result.Err)
+	}
+
+	fmt.Fprintf(output.Progress, "Completed all maildirs. The results for each user are listed below.\n")
+	if output.isTable() {
+		renderUserResults(output.Progress, reports)
+	}
+
+	if err := output.write(reports); err != nil {
+		return err
+	}
+
+	if failedCount != 0 {
+		return fmt.Errorf("failed to process %d of %d maildirs", failedCount, len(t.Maildirs))
+	}
+	return failedMails(reports)
+}
+
+func failedMails(reports []*report) error {
+
+	count := 0
+	for _, report := range reports {
+		count += len(report.Failures)
+	}
+
+	if count != 0 {
+		return &failedMailsError{count: count}
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCmd_DirGlob(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	createMailByDays(t, user1, "", "cur", 10)
+	createMailByDays(t, user1, "A", "cur", 11)
+
+	user2 := test.CreateDir(t, temp, "user2")
+	createMailByDays(t, user2, "", "cur", 1)
+
+	test.CreateFile(t, filepath.Join(temp, "file"), "") // ディレクトリ以外は対象外
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"--dir-glob", filepath.Join(temp, "*"),
+		"-a", "10",
+		"--concurrency", "2",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |               10 |
+| A     |               1 |               11 |
++-------+-----------------+------------------+
+| Total |               2 |               21 |
++-------+-----------------+------------------+
+Starts searching for the target mails. maildir: %s age: %d
+Completed search. There were no target mails.
+Completed all maildirs. The results for each user are listed below.
++%s+--------+-----------------+------------------+
+| User%s | Status | Number of mails | Total size(byte) |
++%s+--------+-----------------+------------------+
+| %s | OK     |               2 |               21 |
+| %s | OK     |               0 |                0 |
++%s+--------+-----------------+------------------+
+|%s    Total |               2 |               21 |
++%s+--------+-----------------+------------------+
+`, user1, 10, user2, 10,
+		dashes(len(user1)+2), spaces(len(user1)-4), dashes(len(user1)+2),
+		user1, user2,
+		dashes(len(user1)+2), spaces(len(user1)+1), dashes(len(user1)+2))
+	assert.Equal(t, expected, result)
+}
+
+func TestDeleteCmd_DirList(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	targetMails := []collector.Mail{
+		createMailByDays(t, user1, "", "cur", 10),
+	}
+
+	user2 := test.CreateDir(t, temp, "user2")
+	targetMails = append(targetMails, createMailByDays(t, user2, "", "cur", 20))
+	nonTargetMail := createMailByDays(t, user2, "", "cur", 1)
+
+	// user3は対象外
+	user3 := test.CreateDir(t, temp, "user3")
+	user3Mail := createMailByDays(t, user3, "", "cur", 20)
+
+	listPath := filepath.Join(temp, "list.txt")
+	test.CreateFile(t, listPath, "# maildirs\n"+user1+"\n\n"+user2+"\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"delete",
+		"--dir-list", listPath,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	assert.FileExists(t, nonTargetMail.FullPath)
+	assert.FileExists(t, user3Mail.FullPath)
+
+	result := buf.String()
+	assert.Contains(t, result, fmt.Sprintf("| %s | OK     |               1 |               10 |\n", user1))
+	assert.Contains(t, result, fmt.Sprintf("| %s | OK     |               1 |               20 |\n", user2))
+	assert.NotContains(t, result, user3)
+}
+
+func TestSearchCmd_AllUsers(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	home1 := test.CreateDir(t, temp, "home1")
+	maildir1 := test.CreateDir(t, home1, "Maildir")
+	createMailByDays(t, maildir1, "", "cur", 10)
+
+	home2 := test.CreateDir(t, temp, "home2")
+	maildir2 := test.CreateDir(t, home2, "Maildir")
+	createMailByDays(t, maildir2, "", "cur", 20)
+	createMailByDays(t, maildir2, "", "cur", 30)
+
+	// maildirが無いユーザ
+	home3 := test.CreateDir(t, temp, "home3")
+
+	passwdPath := filepath.Join(temp, "passwd")
+	test.CreateFile(t, passwdPath,
+		"root:x:0:0:root:/root-not-found:/bin/bash\n"+
+			"user1:x:1000:1000::"+home1+":/bin/bash\n"+
+			"user2:x:1001:1001::"+home2+":/bin/bash\n"+
+			"user3:x:1002:1002::"+home3+":/bin/bash\n"+
+			"invalid line\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"--all-users",
+		"--passwd-file", passwdPath,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	assert.Contains(t, result, `Completed all maildirs. The results for each user are listed below.
++-------+--------+-----------------+------------------+
+| User  | Status | Number of mails | Total size(byte) |
++-------+--------+-----------------+------------------+
+| user1 | OK     |               1 |               10 |
+| user2 | OK     |               2 |               50 |
++-------+--------+-----------------+------------------+
+|          Total |               3 |               60 |
++-------+--------+-----------------+------------------+
+`)
+}
+
+func TestSearchCmd_MultipleMaildirsFailed(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	createMailByDays(t, user1, "", "cur", 10)
+
+	user2 := filepath.Join(temp, "user2") // 存在しないフォルダ
+
+	listPath := filepath.Join(temp, "list.txt")
+	test.CreateFile(t, listPath, user1+"\n"+user2+"\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"--dir-list", listPath,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 of 2 maildirs")
+
+	result := buf.String()
+	assert.Contains(t, result, fmt.Sprintf("Failed. maildir: %s error: open %s", user2, user2))
+	assert.Contains(t, result, fmt.Sprintf("| %s | OK     |               1 |               10 |\n", user1))
+	assert.Contains(t, result, fmt.Sprintf("| %s | Failed |                 |                  |\n", user2))
+}
+
+func TestSearchCmd_MultipleMaildirsOutputCSV(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	createMailByDays(t, user1, "", "cur", 10)
+
+	user2 := filepath.Join(temp, "user2") // 存在しないフォルダ
+
+	listPath := filepath.Join(temp, "list.txt")
+	test.CreateFile(t, listPath, user1+"\n"+user2+"\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"--dir-list", listPath,
+		"-a", "10",
+		"--output", "csv",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 of 2 maildirs")
+
+	// 失敗したmaildirもレコードとして出力
+	result := stdout.String()
+	assert.Contains(t, result, fmt.Sprintf("folder,%s,%s,,,,,,,,,1,10,,,,,,\n", user1, user1))
+	assert.Contains(t, result, fmt.Sprintf("maildir,%s,%s,ok,,,,,,,,1,10,,,,,,\n", user1, user1))
+	assert.Contains(t, result, fmt.Sprintf("maildir,%s,%s,failed,open %s", user2, user2, user2))
+	assert.True(t, strings.HasSuffix(result, "total,,,,,,,,,,,1,10,,,,,,\n"))
+
+	// ユーザ毎の集計テーブルは出力しない
+	assert.Contains(t, stderr.String(), "Completed all maildirs. The results for each user are listed below.\n")
+	assert.NotContains(t, stderr.String(), "| User")
+}
+
+func TestSearchCmd_MaildirNotSpecified(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "one of --dir, --dir-glob, --dir-list or --all-users must be specified")
+}
+
+func TestSearchCmd_DirGlobNotMatched(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	pattern := filepath.Join(temp, "*")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"--dir-glob", pattern,
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "no maildir matched: "+pattern)
+}
+
+func TestSearchCmd_DirAndDirGlob(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"--dir-glob", filepath.Join(temp, "*"),
+		"-a", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "if any flags in the group [dir dir-glob dir-list all-users] are set none of the others can be")
+}
+
+func dashes(n int) string {
+	return string(bytes.Repeat([]byte("-"), n))
+}
+
+func spaces(n int) string {
+	return string(bytes.Repeat([]byte(" "), n))
+}
@@ -0,0 +1,597 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputCSV    = "csv"
+	outputNDJSON = "ndjson"
+)
+
+type output struct {
+	Command  string
+	DryRun   bool
+	Format   string
+	Writer   io.Writer // 結果の出力先
+	Progress io.Writer // 進捗の出力先
+}
+
+// 1つのmaildirに対する処理結果
+type report struct {
+	User            string            `json:"user"`
+	Maildir         string            `json:"maildir"`
+	Status          string            `json:"status"`
+	Error           string            `json:"error,omitempty"`
+	Folders         []folderReport    `json:"folders"`
+	Total           totalReport       `json:"total"`
+	Archived        []archivedReport  `json:"archived"`
+	Mails           []mailReport      `json:"mails,omitempty"`           // search --list の場合のみ
+	Conflicts       []conflictReport  `json:"conflicts,omitempty"`       // archive、delete --to-trashで名前が重複した場合のみ
+	Exported        []exportedReport  `json:"exported,omitempty"`        // exportの場合のみ
+	Restored        []archivedReport  `json:"restored,omitempty"`        // restoreの場合のみ (folderが戻し先)
+	Undone          []undoneReport    `json:"undone,omitempty"`          // undoの場合のみ
+	Skipped         []undoneReport    `json:"skipped,omitempty"`         // undoで戻せなかったもののみ
+	Failures        []failureReport   `json:"failures,omitempty"`        // --keep-going でエラーとなったもののみ
+	TargetSize      *targetSizeReport `json:"targetSize,omitempty"`      // --target-size の場合のみ
+	Quota           *quotaReport      `json:"quota,omitempty"`           // quotaでmaildirsizeがある場合のみ
+	Threads         int               `json:"threads,omitempty"`         // --thread-aware の場合のみ (対象メールのスレッド数)
+	DuplicateGroups int               `json:"duplicateGroups,omitempty"` // dedupeの場合のみ (重複しているメールのまとまりの数)
+}
+
+type folderReport struct {
+	Rule    string `json:"rule,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Name    string `json:"name"`
+	Count   int64  `json:"count"`
+	Size    int64  `json:"size"`
+	Threads int    `json:"threads,omitempty"` // --thread-aware の場合のみ
+}
+
+type totalReport struct {
+	Count int64 `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+type mailReport struct {
+	Folder      string `json:"folder"`
+	SubDir      string `json:"subDir"`
+	FileName    string `json:"fileName"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Time        string `json:"time"`
+	Subject     string `json:"subject,omitempty"`
+	From        string `json:"from,omitempty"`
+	ThreadMails int    `json:"threadMails,omitempty"` // --thread-aware の場合のみ (スレッド全体のメール数)
+}
+
+type conflictReport struct {
+	Rule         string `json:"rule,omitempty"`
+	Folder       string `json:"folder"`
+	Source       string `json:"source"`
+	ExistingPath string `json:"existingPath"`
+	Resolution   string `json:"resolution"`
+}
+
+type archivedReport struct {
+	Rule          string `json:"rule,omitempty"`
+	Folder        string `json:"folder"`
+	ArchiveFolder string `json:"archiveFolder"`
+	Source        string `json:"source"`
+	Destination   string `json:"destination"`
+	Size          int64  `json:"size"`
+}
+
+// source、destinationはジャーナルの記録のまま (移動先から移動元に戻す)
+type undoneReport struct {
+	Operation   string `json:"operation"`
+	Folder      string `json:"folder"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	Reason      string `json:"reason,omitempty"` // 戻せなかった理由
+}
+
+type failureReport struct {
+	Rule   string `json:"rule,omitempty"`
+	Folder string `json:"folder"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+type exportedReport struct {
+	Folder      string `json:"folder"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+}
+
+// csvとndjsonの1行分
+type outputRecord struct {
+	Record        string `json:"record"`
+	User          string `json:"user"`
+	Maildir       string `json:"maildir"`
+	Status        string `json:"status"`
+	Error         string `json:"error"`
+	Rule          string `json:"rule"`
+	Action        string `json:"action"`
+	Folder        string `json:"folder"`
+	ArchiveFolder string `json:"archiveFolder"`
+	Source        string `json:"source"`
+	Destination   string `json:"destination"`
+	Count         int64  `json:"count"`
+	Size          int64  `json:"size"`
+	Path          string `json:"path"`
+	SubDir        string `json:"subDir"`
+	FileName      string `json:"fileName"`
+	Time          string `json:"time"`
+	Subject       string `json:"subject"`
+	From          string `json:"from"`
+}
+
+var outputRecordColumns = []string{
+	"record", "user", "maildir", "status", "error", "rule", "action", "folder", "archiveFolder", "source", "destination", "count", "size",
+	"path", "subDir", "fileName", "time", "subject", "from",
+}
+
+func addOutputFlag(f *pflag.FlagSet) {
+	f.StringP("output", "o", outputTable, "Output format. can be specified: table, json, csv, ndjson\nExcept for table, progress messages are written to stderr.")
+}
+
+func newOutput(cmd *cobra.Command) (*output, error) {
+
+	format, _ := cmd.Flags().GetString("output")
+	dryRun, _ := cmd.Flags().GetBool("dry-run") // dry-runが無いサブコマンドではfalse
+
+	output := &output{
+		Command: cmd.Name(),
+		DryRun:  dryRun,
+		Format:  format,
+		Writer:  cmd.OutOrStdout(),
+	}
+
+	switch format {
+	case outputTable:
+		output.Progress = cmd.OutOrStdout()
+	case outputJSON, outputCSV, outputNDJSON:
+		// 結果をパースしやすいように、進捗は標準エラーに
+		output.Progress = cmd.ErrOrStderr()
+	default:
+		return nil, fmt.Errorf("invalid output '%s'", format)
+	}
+
+	return output, nil
+}
+
+func (o *output) isTable() bool {
+	return o.Format == outputTable
+}
+
+func (o *output) write(reports []*report) error {
+
+	switch o.Format {
+	case outputJSON:
+		return o.writeJSON(reports)
+	case outputCSV:
+		return o.writeCSV(reports)
+	case outputNDJSON:
+		return o.writeNDJSON(reports)
+	default:
+		// tableは処理中に出力済み
+		return nil
+	}
+}
+
+func (o *output) writeJSON(reports []*report) error {
+
+	encoder := json.NewEncoder(o.Writer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(struct {
+		Command  string      `json:"command"`
+		DryRun   bool        `json:"dryRun"`
+		Maildirs []*report   `json:"maildirs"`
+		Total    totalReport `json:"total"`
+	}{
+		Command:  o.Command,
+		DryRun:   o.DryRun,
+		Maildirs: reports,
+		Total:    sumTotals(reports),
+	})
+}
+
+func (o *output) writeCSV(reports []*report) error {
+
+	writer := csv.NewWriter(o.Writer)
+	if err := writer.Write(outputRecordColumns); err != nil {
+		return err
+	}
+
+	for _, record := range toOutputRecords(reports) {
+		if err := writer.Write(record.values()); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (o *output) writeNDJSON(reports []*report) error {
+
+	encoder := json.NewEncoder(o.Writer)
+	encoder.SetEscapeHTML(false)
+
+	for _, record := range toOutputRecords(reports) {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toOutputRecords(reports []*report) []outputRecord {
+
+	records := []outputRecord{}
+
+	for _, report := range reports {
+		for _, folder := range report.Folders {
+			records = append(records, outputRecord{
+				Record:  "folder",
+				User:    report.User,
+				Maildir: report.Maildir,
+				Rule:    folder.Rule,
+				Action:  folder.Action,
+				Folder:  folder.Name,
+				Count:   folder.Count,
+				Size:    folder.Size,
+			})
+		}
+
+		for _, archived := range report.Archived {
+			records = append(records, outputRecord{
+				Record:        "archived",
+				User:          report.User,
+				Maildir:       report.Maildir,
+				Rule:          archived.Rule,
+				Folder:        archived.Folder,
+				ArchiveFolder: archived.ArchiveFolder,
+				Source:        archived.Source,
+				Destination:   archived.Destination,
+				Count:         1,
+				Size:          archived.Size,
+			})
+		}
+
+		for _, conflict := range report.Conflicts {
+			records = append(records, outputRecord{
+				Record:      "conflict",
+				User:        report.User,
+				Maildir:     report.Maildir,
+				Status:      conflict.Resolution,
+				Rule:        conflict.Rule,
+				Folder:      conflict.Folder,
+				Source:      conflict.Source,
+				Destination: conflict.ExistingPath,
+				Count:       1,
+			})
+		}
+
+		for _, exported := range report.Exported {
+			records = append(records, outputRecord{
+				Record:      "exported",
+				User:        report.User,
+				Maildir:     report.Maildir,
+				Folder:      exported.Folder,
+				Source:      exported.Source,
+				Destination: exported.Destination,
+				Count:       1,
+				Size:        exported.Size,
+			})
+		}
+
+		for _, restored := range report.Restored {
+			records = append(records, outputRecord{
+				Record:        "restored",
+				User:          report.User,
+				Maildir:       report.Maildir,
+				Folder:        restored.Folder,
+				ArchiveFolder: restored.ArchiveFolder,
+				Source:        restored.Source,
+				Destination:   restored.Destination,
+				Count:         1,
+				Size:          restored.Size,
+			})
+		}
+
+		for _, undone := range report.Undone {
+			records = append(records, outputRecord{
+				Record:      "undone",
+				User:        report.User,
+				Maildir:     report.Maildir,
+				Action:      undone.Operation,
+				Folder:      undone.Folder,
+				Source:      undone.Source,
+				Destination: undone.Destination,
+				Count:       1,
+				Size:        undone.Size,
+			})
+		}
+
+		for _, skipped := range report.Skipped {
+			records = append(records, outputRecord{
+				Record:      "skipped",
+				User:        report.User,
+				Maildir:     report.Maildir,
+				Status:      "skipped",
+				Error:       skipped.Reason,
+				Action:      skipped.Operation,
+				Folder:      skipped.Folder,
+				Source:      skipped.Source,
+				Destination: skipped.Destination,
+				Count:       1,
+				Size:        skipped.Size,
+			})
+		}
+
+		for _, failure := range report.Failures {
+			records = append(records, outputRecord{
+				Record:  "failure",
+				User:    report.User,
+				Maildir: report.Maildir,
+				Status:  "failed",
+				Error:   failure.Error,
+				Rule:    failure.Rule,
+				Folder:  failure.Folder,
+				Path:    failure.Path,
+				Count:   1,
+			})
+		}
+
+		for _, mail := range report.Mails {
+			records = append(records, outputRecord{
+				Record:   "mail",
+				User:     report.User,
+				Maildir:  report.Maildir,
+				Folder:   mail.Folder,
+				Count:    1,
+				Size:     mail.Size,
+				Path:     mail.Path,
+				SubDir:   mail.SubDir,
+				FileName: mail.FileName,
+				Time:     mail.Time,
+				Subject:  mail.Subject,
+				From:     mail.From,
+			})
+		}
+
+		records = append(records, outputRecord{
+			Record:  "maildir",
+			User:    report.User,
+			Maildir: report.Maildir,
+			Status:  report.Status,
+			Error:   report.Error,
+			Count:   report.Total.Count,
+			Size:    report.Total.Size,
+		})
+	}
+
+	total := sumTotals(reports)
+	records = append(records, outputRecord{
+		Record: "total",
+		Count:  total.Count,
+		Size:   total.Size,
+	})
+
+	return records
+}
+
+func (r outputRecord) values() []string {
+
+	return []string{
+		r.Record, r.User, r.Maildir, r.Status, r.Error, r.Rule, r.Action, r.Folder, r.ArchiveFolder, r.Source, r.Destination,
+		strconv.FormatInt(r.Count, 10), strconv.FormatInt(r.Size, 10),
+		r.Path, r.SubDir, r.FileName, r.Time, r.Subject, r.From,
+	}
+}
+
+func newReport(ruleName string, actionName string, mails *[]collector.Mail) *report {
+
+	report := &report{}
+	report.addMails(ruleName, actionName, mails)
+
+	return report
+}
+
+func (r *report) addMails(ruleName string, actionName string, mails *[]collector.Mail) {
+
+	for _, result := range aggregateMails(mails) {
+		r.Folders = append(r.Folders, folderReport{
+			Rule:   ruleName,
+			Action: actionName,
+			Name:   result.FolderName,
+			Count:  result.Count,
+			Size:   result.TotalSize,
+		})
+	}
+}
+
+func (r *report) addThreads(mails *[]collector.Mail, threads *collector.Threads) {
+
+	folderThreads := aggregateThreads(mails, threads)
+	for i := range r.Folders {
+		r.Folders[i].Threads = folderThreads[r.Folders[i].Name]
+	}
+	r.Threads = threads.Count(mails)
+}
+
+func (r *report) addArchivedMails(ruleName string, mails *[]collector.Mail, archivedMails *[]collector.Mail) {
+
+	for i, mail := range *mails {
+		archivedMail := (*archivedMails)[i]
+		r.Archived = append(r.Archived, archivedReport{
+			Rule:          ruleName,
+			Folder:        mail.FolderName,
+			ArchiveFolder: archivedMail.FolderName,
+			Source:        mail.FullPath,
+			Destination:   archivedMail.FullPath,
+			Size:          mail.Size,
+		})
+	}
+}
+
+func (r *report) addConflicts(ruleName string, conflicts []action.Conflict) {
+
+	for _, conflict := range conflicts {
+		r.Conflicts = append(r.Conflicts, conflictReport{
+			Rule:         ruleName,
+			Folder:       conflict.Mail.FolderName,
+			Source:       conflict.Mail.FullPath,
+			ExistingPath: conflict.ExistingPath,
+			Resolution:   conflict.Resolution,
+		})
+	}
+}
+
+func (r *report) addExportedMails(exportedMails []action.ExportedMail) {
+
+	for _, exportedMail := range exportedMails {
+		r.Exported = append(r.Exported, exportedReport{
+			Folder:      exportedMail.Mail.FolderName,
+			Source:      exportedMail.Mail.FullPath,
+			Destination: exportedMail.ExportPath,
+			Size:        exportedMail.Mail.Size,
+		})
+	}
+}
+
+func (r *report) addRestoredMails(mails *[]collector.Mail, restoredMails *[]collector.Mail) {
+
+	for i, mail := range *mails {
+		restoredMail := (*restoredMails)[i]
+		r.Restored = append(r.Restored, archivedReport{
+			Folder:        restoredMail.FolderName,
+			ArchiveFolder: mail.FolderName,
+			Source:        mail.FullPath,
+			Destination:   restoredMail.FullPath,
+			Size:          mail.Size,
+		})
+	}
+}
+
+func (r *report) addUndoneEntries(entries []action.JournalEntry, skipped []action.UndoSkipped) {
+
+	for _, entry := range entries {
+		r.Undone = append(r.Undone, newUndoneReport(entry, ""))
+	}
+	for _, s := range skipped {
+		r.Skipped = append(r.Skipped, newUndoneReport(s.Entry, s.Reason))
+	}
+}
+
+func newUndoneReport(entry action.JournalEntry, reason string) undoneReport {
+
+	return undoneReport{
+		Operation:   entry.Operation,
+		Folder:      entry.Folder,
+		Source:      entry.Source,
+		Destination: entry.Destination,
+		Size:        entry.Size,
+		Reason:      reason,
+	}
+}
+
+func (r *report) addFailures(ruleName string, failures []collector.MailError) {
+
+	for _, failure := range failures {
+		r.Failures = append(r.Failures, failureReport{
+			Rule:   ruleName,
+			Folder: failure.FolderName,
+			Path:   failure.Path,
+			Error:  failure.Err.Error(),
+		})
+	}
+}
+
+func (r *report) addListedMails(mails []listedMail) {
+
+	r.Mails = []mailReport{}
+	for _, mail := range mails {
+		r.Mails = append(r.Mails, mailReport{
+			Folder:      mail.FolderName,
+			SubDir:      mail.SubDirName,
+			FileName:    mail.FileName,
+			Path:        mail.FullPath,
+			Size:        mail.Size,
+			Time:        mail.Time.Format(time.RFC3339),
+			Subject:     mail.Subject,
+			From:        mail.From,
+			ThreadMails: mail.ThreadMails,
+		})
+	}
+}
+
+// maildirの情報と処理結果を設定し、合計を算出
+func completeReport(maildir maildir, r *report, err error) *report {
+
+	if err != nil {
+		// 失敗した場合は途中までの結果は含めない
+		r = &report{
+			Status: "failed",
+			Error:  err.Error(),
+		}
+	} else if len(r.Failures) != 0 {
+		// --keep-going で一部のメールが処理できなかった
+		r.Status = "partial"
+	} else {
+		r.Status = "ok"
+	}
+
+	r.User = maildir.User
+	r.Maildir = maildir.Path
+
+	// 出力時にnullとならないように
+	if r.Folders == nil {
+		r.Folders = []folderReport{}
+	}
+	if r.Archived == nil {
+		r.Archived = []archivedReport{}
+	}
+
+	r.Total = totalReport{}
+	for _, folder := range r.Folders {
+		r.Total.Count += folder.Count
+		r.Total.Size += folder.Size
+	}
+	if r.Quota != nil {
+		// quotaはmaildirsizeでの使用量
+		r.Total = totalReport{Count: r.Quota.Count, Size: r.Quota.Size}
+	}
+
+	return r
+}
+
+func sumTotals(reports []*report) totalReport {
+
+	total := totalReport{}
+	for _, report := range reports {
+		total.Count += report.Total.Count
+		total.Size += report.Total.Size
+	}
+
+	return total
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/onozaty/maildir-cleaner/quota"
+	"github.com/spf13/cobra"
+)
+
+type quotaReport struct {
+	Size       int64 `json:"size"`
+	Count      int64 `json:"count"`
+	LimitSize  int64 `json:"limitSize"`  // 0の場合は無制限
+	LimitCount int64 `json:"limitCount"` // 0の場合は無制限
+}
+
+func newQuotaCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "quota",
+		Short: "Show the quota usage in maildirsize",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			recalculate, _ := cmd.Flags().GetBool("recalculate")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runQuota(
+					maildirPath,
+					recalculate,
+					writer,
+					output.isTable())
+			})
+		},
+	}
+
+	addMaildirFlags(subCmd)
+	subCmd.Flags().BoolP("recalculate", "", false, "Recalculate the usage from the mails and rewrite maildirsize.")
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runQuota(maildirPath string, recalculate bool, writer io.Writer, renderTable bool) (*report, error) {
+
+	var usage *quota.Usage
+	var err error
+
+	if recalculate {
+		fmt.Fprintf(writer, "Starts recalculating the quota usage. maildir: %s\n", maildirPath)
+		usage, err = quota.Recalculate(maildirPath)
+	} else {
+		fmt.Fprintf(writer, "Starts reading the quota usage. maildir: %s\n", maildirPath)
+		usage, err = quota.Read(maildirPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if usage == nil {
+		// クォータが使われていない
+		fmt.Fprintf(writer, "There is no %s in the maildir.\n", quota.FileName)
+		return &report{}, nil
+	}
+
+	fmt.Fprintf(writer, "The quota usage is listed below.\n")
+	if renderTable {
+		renderQuotaUsage(writer, usage)
+	}
+
+	return &report{
+		Quota: &quotaReport{
+			Size:       usage.Size,
+			Count:      usage.Count,
+			LimitSize:  usage.LimitSize,
+			LimitCount: usage.LimitCount,
+		},
+	}, nil
+}
+
+func renderQuotaUsage(writer io.Writer, usage *quota.Usage) {
+
+	table := tablewriter.NewWriter(writer)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	table.SetHeader([]string{"Name", "Usage", "Limit", "Use%"})
+
+	table.Append(quotaRow("Size(byte)", usage.Size, usage.LimitSize))
+	table.Append(quotaRow("Number of mails", usage.Count, usage.LimitCount))
+
+	table.Render()
+}
+
+func quotaRow(name string, value int64, limit int64) []string {
+
+	if limit == 0 {
+		// 無制限
+		return []string{name, humanize.Comma(value), "-", "-"}
+	}
+
+	return []string{name, humanize.Comma(value), humanize.Comma(limit), fmt.Sprintf("%.1f%%", float64(value)*100/float64(limit))}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/quota"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, quota.FileName), "10000S,100C\n1234 10\n-234 -2\n")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"quota",
+		"-d", temp,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts reading the quota usage. maildir: %s
+The quota usage is listed below.
++-----------------+-------+--------+-------+
+| Name            | Usage | Limit  | Use%%  |
++-----------------+-------+--------+-------+
+| Size(byte)      | 1,000 | 10,000 | 10.0%% |
+| Number of mails |     8 |    100 |  8.0%% |
++-----------------+-------+--------+-------+
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestQuotaCmd_Recalculate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	quotaPath := filepath.Join(temp, quota.FileName)
+	test.CreateFile(t, quotaPath, "10000S\n1234 10\n")
+
+	createMailByDays(t, temp, "", "cur", 10)
+	createMailByDays(t, temp, "A", "new", 20)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"quota",
+		"-d", temp,
+		"--recalculate",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "10000S\n30 2\n", test.ReadFile(t, quotaPath))
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts recalculating the quota usage. maildir: %s
+The quota usage is listed below.
++-----------------+-------+--------+------+
+| Name            | Usage | Limit  | Use%% |
++-----------------+-------+--------+------+
+| Size(byte)      |    30 | 10,000 | 0.3%% |
+| Number of mails |     2 |      - |    - |
++-----------------+-------+--------+------+
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestQuotaCmd_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"quota",
+		"-d", temp,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts reading the quota usage. maildir: %s
+There is no maildirsize in the maildir.
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestQuotaCmd_OutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	test.CreateFile(t, filepath.Join(user1, quota.FileName), "10000S,100C\n1000 8\n")
+	test.CreateDir(t, temp, "user2")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"quota",
+		"--dir-glob", filepath.Join(temp, "user*"),
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	var output struct {
+		Maildirs []report    `json:"maildirs"`
+		Total    totalReport `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 2, len(output.Maildirs))
+
+	assert.Equal(t, &quotaReport{Size: 1000, Count: 8, LimitSize: 10000, LimitCount: 100}, output.Maildirs[0].Quota)
+	assert.Equal(t, totalReport{Count: 8, Size: 1000}, output.Maildirs[0].Total)
+	assert.Nil(t, output.Maildirs[1].Quota)
+	assert.Equal(t, totalReport{Count: 8, Size: 1000}, output.Total)
+}
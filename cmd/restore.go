@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/cobra"
+)
+
+func newRestoreCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore archived mails to the original folders",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			condition, err := newCondition(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			maxAge, _ := cmd.Flags().GetInt64("max-age")
+			if maxAge != 0 && maxAge < condition.AgeOfDays {
+				return fmt.Errorf("age must be less than or equal to max-age")
+			}
+			condition.MaxAgeOfDays = maxAge
+
+			archiveFolderName, _ := cmd.Flags().GetString("archive-folder")
+			folderNames, _ := cmd.Flags().GetStringArray("folder")
+			if len(folderNames) == 0 {
+				// 未指定の場合はアーカイブフォルダ全体
+				folderNames = []string{archiveFolderName}
+			}
+			condition.FolderNames = folderNames
+
+			var restoreFolderName *string
+			if cmd.Flags().Changed("restore-folder") {
+				// 空文字(INBOX)も指定できるように
+				name, _ := cmd.Flags().GetString("restore-folder")
+				restoreFolderName = &name
+			}
+
+			onConflictValue, _ := cmd.Flags().GetString("on-conflict")
+			onConflict, err := action.ParseConflictPolicy(onConflictValue)
+			if err != nil {
+				return err
+			}
+
+			archiveRootPath, _ := cmd.Flags().GetString("archive-root")
+			if archiveRootPath != "" && maildirTargets.Multiple {
+				// ユーザ毎に別のアーカイブ先となっているはずなので
+				return fmt.Errorf("--archive-root can only be used with --dir")
+			}
+
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runRestore(
+					maildirPath,
+					*condition,
+					archiveFolderName,
+					restoreFolderName,
+					archiveRootPath,
+					onConflict,
+					dryRun,
+					writer,
+					output.isTable())
+			})
+		},
+	}
+
+	addMaildirFlags(subCmd)
+	subCmd.Flags().Int64P("age", "a", 0, "The number of age days to be restored.\nIf you specify 10, mail that has been in the mailbox for more than 10 days since its arrival will be restored.")
+	subCmd.Flags().Int64P("max-age", "", 0, "The maximum number of age days to be restored. (0 is unlimited)\nIf you specify 30, mail that has been in the mailbox for more than 30 days since its arrival will not be restored.")
+
+	subCmd.Flags().StringP("archive-folder", "", "Archived", "Archive folder name. (same as archive)")
+	subCmd.Flags().StringArrayP("folder", "", []string{}, "The name of the archive folder to restore, including subfolders. (e.g. Archived.2023)\nIf not specified, all the mails in --archive-folder are restored.")
+	subCmd.Flags().StringP("restore-folder", "", "", "Folder name to restore all the mails into. (empty is INBOX)\nIf not specified, the mails are restored to the original folders.")
+	subCmd.Flags().StringP("archive-root", "", "", "Path of another maildir archived into. (same as archive)\nIf not specified, restore from the target maildir.")
+	addConditionFlags(subCmd.Flags())
+	subCmd.Flags().StringP("on-conflict", "", string(action.ConflictRename), "How to handle a mail with the same name already in the original folder. can be specified: skip, rename, fail, dedupe\ndedupe deletes the mail if the contents are the same, otherwise renames it.")
+	subCmd.Flags().BoolP("dry-run", "", false, "Show how the mails would be restored without actually restoring them.")
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runRestore(maildirPath string, condition collector.Condition, archiveFolderName string, restoreFolderName *string, archiveRootPath string, onConflict action.ConflictPolicy, dryRun bool, writer io.Writer, renderTable bool) (*report, error) {
+
+	// アーカイブされたメールを収集
+	archivedPath := maildirPath
+	if archiveRootPath == "" {
+		fmt.Fprintf(writer, "Starts searching for the archived mails. maildir: %s age: %d\n", maildirPath, condition.AgeOfDays)
+	} else {
+		archivedPath = archiveRootPath
+		fmt.Fprintf(writer, "Starts searching for the archived mails. archive root: %s age: %d\n", archiveRootPath, condition.AgeOfDays)
+	}
+
+	collector := collector.NewConditionCollector(condition)
+	mails, err := collector.Collect(archivedPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*mails) == 0 {
+		// 戻す対象無し
+		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
+		return &report{}, nil
+	}
+
+	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
+	if renderTable {
+		renderTargetMails(writer, mails)
+	}
+
+	// 戻し先のフォルダ
+	var restoreFolderNameGenerator action.ArchiveFolderNameGenerator
+	if restoreFolderName != nil {
+		restoreFolderNameGenerator = &action.FixedFolderNameGenerator{
+			FolderName: *restoreFolderName,
+		}
+	} else {
+		restoreFolderNameGenerator, err = action.NewRestoreFolderNameGenerator(mails, archiveFolderName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		// 戻した場合の内容を表示するのみ
+		plan, err := action.PlanRestore(maildirPath, mails, restoreFolderNameGenerator, onConflict)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be restored as listed below.\n")
+		if renderTable {
+			renderRestoreFolders(writer, mails, plan.ArchivedMails)
+		}
+		renderArchivePlan(writer, mails, plan)
+		renderConflicts(writer, plan.Conflicts)
+
+		report := newReport("", "", mails)
+		report.addRestoredMails(mails, plan.ArchivedMails)
+		report.addConflicts("", plan.Conflicts)
+		return report, nil
+	}
+
+	// 元のフォルダに戻す
+	fmt.Fprintf(writer, "Starts restoring mails.\n")
+	result, err := action.Restore(maildirPath, mails, restoreFolderNameGenerator, onConflict)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(writer, "Completed restore. The restored mails are listed below.\n")
+	if renderTable {
+		renderTargetMails(writer, result.ArchivedMails)
+	}
+	renderConflicts(writer, result.Conflicts)
+
+	report := newReport("", "", mails)
+	report.addRestoredMails(result.SourceMails, result.ArchivedMails)
+	report.addConflicts("", result.Conflicts)
+	return report, nil
+}
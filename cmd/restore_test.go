@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "A\n")
+
+	sourceMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "A", "cur", 2021, 1),
+		createMailByYearMonth(t, temp, "A", "new", 2022, 2),
+	}
+
+	// 年毎にアーカイブしておく
+	{
+		archiveCmd := newRootCmd()
+		archiveCmd.SetArgs([]string{
+			"archive",
+			"-d", temp,
+			"-a", "10",
+			"--archive-pattern", "year",
+		})
+		archiveCmd.SetOutput(new(bytes.Buffer))
+		require.NoError(t, archiveCmd.Execute())
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"--folder", "Archived.2020",
+		"--folder", "Archived.2021",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 指定したアーカイブフォルダのものだけ元のフォルダに
+	assert.FileExists(t, sourceMails[0].FullPath)
+	assert.FileExists(t, sourceMails[1].FullPath)
+	assert.NoFileExists(t, sourceMails[2].FullPath)
+	assert.FileExists(t, filepath.Join(temp, ".Archived.2022", "new", sourceMails[2].FileName))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the archived mails. maildir: %s age: 0
+Completed search. The target mails are listed below.
++---------------+-----------------+------------------+
+| Name          | Number of mails | Total size(byte) |
++---------------+-----------------+------------------+
+| Archived.2020 |               1 |            2,032 |
+| Archived.2021 |               1 |            2,022 |
++---------------+-----------------+------------------+
+|         Total |               2 |            4,054 |
++---------------+-----------------+------------------+
+Starts restoring mails.
+Completed restore. The restored mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |            2,032 |
+| A     |               1 |            2,022 |
++-------+-----------------+------------------+
+| Total |               2 |            4,054 |
++-------+-----------------+------------------+
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestRestoreCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Archived\nArchived.A\n")
+	test.CreateMailFolder(t, temp, "")
+
+	// keepパターンでアーカイブされたもの
+	archivedMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "Archived", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "Archived.A", "cur", 2021, 1),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 移動されていないこと
+	for _, mail := range archivedMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the archived mails. maildir: %s age: 0
+Completed search. The target mails are listed below.
++------------+-----------------+------------------+
+| Name       | Number of mails | Total size(byte) |
++------------+-----------------+------------------+
+| Archived   |               1 |            2,032 |
+| Archived.A |               1 |            2,022 |
++------------+-----------------+------------------+
+|      Total |               2 |            4,054 |
++------------+-----------------+------------------+
+Dry run. The mails would be restored as listed below.
++------------+----------------+-----------------+------------------+
+| Name       | Restore folder | Number of mails | Total size(byte) |
++------------+----------------+-----------------+------------------+
+| Archived   |                |               1 |            2,032 |
+| Archived.A | A              |               1 |            2,022 |
++------------+----------------+-----------------+------------------+
+|                       Total |               2 |            4,054 |
++------------+----------------+-----------------+------------------+
+Folders to be created:
+  A
+Folders to be subscribed:
+  A
+Mails to be moved:
+  %s -> %s
+  %s -> %s
+`, temp,
+		archivedMails[0].FullPath, filepath.Join(temp, "cur", archivedMails[0].FileName),
+		archivedMails[1].FullPath, filepath.Join(temp, ".A", "cur", archivedMails[1].FileName))
+	assert.Equal(t, expected, result)
+}
+
+func TestRestoreCmd_RestoreFolder(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Archived.2020\n")
+	test.CreateMailFolder(t, temp, "")
+
+	// 記録が無く、元のフォルダが分からないもの
+	archivedMail := createMailByYearMonth(t, temp, "Archived.2020", "cur", 2020, 12)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"--restore-folder", "",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// INBOXに戻ること
+	assert.NoFileExists(t, archivedMail.FullPath)
+	assert.FileExists(t, filepath.Join(temp, "cur", archivedMail.FileName))
+}
+
+func TestRestoreCmd_Age(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Archived\n")
+	test.CreateMailFolder(t, temp, "")
+
+	// 対象(10日以上20日以下経過)
+	targetMail := createMailByDays(t, temp, "Archived", "cur", 15)
+
+	// 対象外
+	nonTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "Archived", "cur", 5),
+		createMailByDays(t, temp, "Archived", "cur", 25),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"-a", "10",
+		"--max-age", "20",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMail.FullPath)
+	assert.FileExists(t, filepath.Join(temp, "cur", targetMail.FileName))
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestRestoreCmd_OriginUnknown(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "Old\n")
+	test.CreateMailFolder(t, temp, "")
+
+	archivedMail := createMailByYearMonth(t, temp, "Old", "cur", 2020, 12)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"--folder", "Old",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "original folder of "+archivedMail.FullPath+" is unknown")
+	assert.FileExists(t, archivedMail.FullPath)
+}
+
+func TestRestoreCmd_InvalidMaxAge(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"-d", temp,
+		"-a", "20",
+		"--max-age", "10",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "age must be less than or equal to max-age")
+}
+
+func TestRestoreCmd_ArchiveRootMultipleMaildirs(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user1"), "")
+	test.CreateMailFolder(t, test.CreateDir(t, temp, "user2"), "")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"restore",
+		"--dir-glob", filepath.Join(temp, "*"),
+		"--archive-root", filepath.Join(temp, "archive"),
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "--archive-root can only be used with --dir")
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -21,18 +23,26 @@ func newRootCmd() *cobra.Command {
 	}
 	rootCmd.AddCommand(newDeleteCmd())
 	rootCmd.AddCommand(newArchiveCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newRestoreCmd())
+	rootCmd.AddCommand(newUndoCmd())
 	rootCmd.AddCommand(newSearchCmd())
+	rootCmd.AddCommand(newQuotaCmd())
+	rootCmd.AddCommand(newDedupeCmd())
+	rootCmd.AddCommand(newRunCmd())
 	rootCmd.AddCommand(newVersionCmd())
 
 	cobra.EnableCommandSorting = false // サブコマンドを設定順で表示
 
 	for _, c := range rootCmd.Commands() {
-		// フラグ以外は受け付けないように
-		c.Args = func(cmd *cobra.Command, args []string) error {
-			if len(args) > 0 {
-				return fmt.Errorf("only flags can be specified")
+		if c.Args == nil {
+			// 引数を受け付けるもの以外は、フラグ以外は受け付けないように
+			c.Args = func(cmd *cobra.Command, args []string) error {
+				if len(args) > 0 {
+					return fmt.Errorf("only flags can be specified")
+				}
+				return nil
 			}
-			return nil
 		}
 		c.Flags().SortFlags = false
 		c.InheritedFlags().SortFlags = false
@@ -44,5 +54,13 @@ func newRootCmd() *cobra.Command {
 func Execute() {
 
 	rootCmd := newRootCmd()
-	cobra.CheckErr(rootCmd.Execute())
+	err := rootCmd.Execute()
+
+	var failedErr *failedMailsError
+	if errors.As(err, &failedErr) {
+		// 処理自体は最後まで行えているので、終了ステータスで区別できるように
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCodeFailedMails)
+	}
+	cobra.CheckErr(err)
 }
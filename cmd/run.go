@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/cobra"
+)
+
+func newRunCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run the rules in the config file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+			configPath, _ := cmd.Flags().GetString("config")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			keepGoing, _ := cmd.Flags().GetBool("keep-going")
+
+			config, err := loadConfig(configPath)
+			if err != nil {
+				return err
+			}
+
+			rules, err := config.rules()
+			if err != nil {
+				return err
+			}
+
+			timeSources, err := config.timeSources()
+			if err != nil {
+				return err
+			}
+
+			journal, err := openJournal(cmd.Flags(), output.Progress)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runRules(
+					maildirPath,
+					configPath,
+					rules,
+					timeSources,
+					dryRun,
+					keepGoing,
+					journal,
+					writer,
+					output.isTable())
+			})
+		},
+	}
+
+	addMaildirFlags(subCmd)
+	subCmd.Flags().StringP("config", "c", "", "Config file path.")
+	subCmd.MarkFlagRequired("config")
+	subCmd.Flags().BoolP("dry-run", "", false, "Show the mails to be deleted or archived without actually changing them.")
+	addJournalFlags(subCmd.Flags())
+	addKeepGoingFlag(subCmd.Flags())
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runRules(maildirPath string, configPath string, rules []*rule, timeSources []collector.TimeSource, dryRun bool, keepGoing bool, journal *action.Journal, writer io.Writer, renderTable bool) (*report, error) {
+
+	// 全てのメールを一度だけ収集し、フォルダ毎に最初に該当したルールで判定
+	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s config: %s\n", maildirPath, configPath)
+	mailCollector := collector.NewConditionCollector(collector.Condition{TimeSources: timeSources, KeepGoing: keepGoing})
+	allMails, err := mailCollector.Collect(maildirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// thread-awareのルールがある場合は、スレッドを全てのメールから組み立てる
+	var threads *collector.Threads
+	for _, rule := range rules {
+		if rule.Collector.ThreadAware() {
+			threads = collector.BuildThreads(allMails)
+			break
+		}
+	}
+
+	// --keep-going で処理できなかったもの (収集時のものはルール無し)
+	report := &report{}
+	failures := mailCollector.Failures()
+	report.addFailures("", failures)
+
+	ruleMails := make([]*[]collector.Mail, len(rules))
+	for i := range rules {
+		ruleMails[i] = &[]collector.Mail{}
+	}
+
+	// keep-lastで残すメールは、ルール毎にフォルダ全体から
+	ruleKeptMails := make([]map[string]bool, len(rules))
+	for i, rule := range rules {
+		ruleKeptMails[i] = rule.Collector.KeptMails(allMails)
+	}
+
+	targetMails := []collector.Mail{}
+	for _, mail := range *allMails {
+		for i, rule := range rules {
+			if !rule.applies(mail) {
+				continue
+			}
+
+			if ruleKeptMails[i][mail.FullPath] {
+				// 残すものは、後続のルールでも対象外
+				break
+			}
+
+			isTarget, err := rule.Collector.Match(mail)
+			if err == nil && isTarget {
+				isTarget, err = rule.Collector.MatchThread(mail, threads)
+			}
+			if err != nil {
+				if !keepGoing {
+					return nil, err
+				}
+				failure := collector.MailError{FolderName: mail.FolderName, Path: mail.FullPath, Err: err}
+				failures = append(failures, failure)
+				report.addFailures(rule.Name, []collector.MailError{failure})
+				break
+			}
+
+			if isTarget {
+				*ruleMails[i] = append(*ruleMails[i], mail)
+				targetMails = append(targetMails, mail)
+			}
+			break
+		}
+	}
+
+	if len(targetMails) == 0 {
+		// 対象無し
+		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
+		renderFailures(writer, failures, renderTable)
+		return report, nil
+	}
+
+	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
+	if renderTable {
+		renderRuleMails(writer, rules, ruleMails)
+	}
+
+	if dryRun {
+		// ルール毎に、実施した場合の内容を表示するのみ
+		for i, rule := range rules {
+			mails := ruleMails[i]
+			report.addMails(rule.Name, rule.Action, mails)
+			if len(*mails) == 0 {
+				continue
+			}
+
+			switch rule.Action {
+			case "delete":
+				fmt.Fprintf(writer, "Dry run. rule: %s The following mails would be deleted.\n", rule.Name)
+				for _, mail := range *mails {
+					fmt.Fprintf(writer, "  %s\n", mail.FullPath)
+				}
+			case "archive":
+				plan, err := action.PlanArchive(maildirPath, mails, rule.ArchiveFolderNameGenerator, rule.OnConflict)
+				if err != nil {
+					return nil, err
+				}
+
+				fmt.Fprintf(writer, "Dry run. rule: %s The mails would be archived as listed below.\n", rule.Name)
+				if renderTable {
+					renderArchiveFolders(writer, mails, plan.ArchivedMails)
+				}
+				renderArchivePlan(writer, mails, plan)
+				renderConflicts(writer, plan.Conflicts)
+				report.addArchivedMails(rule.Name, mails, plan.ArchivedMails)
+				report.addConflicts(rule.Name, plan.Conflicts)
+			}
+		}
+		renderFailures(writer, failures, renderTable)
+		return report, nil
+	}
+
+	// ルールの順に実施
+	resultMails := make([]*[]collector.Mail, len(rules))
+	for i, rule := range rules {
+		mails := ruleMails[i]
+		resultMails[i] = &[]collector.Mail{}
+		if len(*mails) == 0 {
+			continue
+		}
+
+		switch rule.Action {
+		case "delete":
+			fmt.Fprintf(writer, "Starts deleting mails. rule: %s\n", rule.Name)
+			deleteFailures, err := action.Delete(maildirPath, mails, keepGoing, journal)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(writer, "Completed deletion.\n")
+			resultMails[i] = action.ExcludeFailures(mails, deleteFailures)
+			report.addMails(rule.Name, rule.Action, resultMails[i]) // 削除できたもののみ
+			failures = append(failures, deleteFailures...)
+			report.addFailures(rule.Name, deleteFailures)
+		case "archive":
+			fmt.Fprintf(writer, "Starts archiving mails. rule: %s\n", rule.Name)
+			result, err := action.ArchiveWithConflictPolicy(maildirPath, mails, rule.ArchiveFolderNameGenerator, rule.OnConflict, keepGoing, journal)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(writer, "Completed archive.\n")
+			renderConflicts(writer, result.Conflicts)
+			resultMails[i] = result.ArchivedMails
+			report.addMails(rule.Name, rule.Action, result.SourceMails) // アーカイブできたもののみ (移動前のフォルダで)
+			report.addArchivedMails(rule.Name, result.SourceMails, result.ArchivedMails)
+			report.addConflicts(rule.Name, result.Conflicts)
+			failures = append(failures, result.Failures...)
+			report.addFailures(rule.Name, result.Failures)
+		}
+	}
+
+	fmt.Fprintf(writer, "Completed all rules. The results are listed below.\n")
+	if renderTable {
+		renderRuleMails(writer, rules, resultMails)
+	}
+	renderFailures(writer, failures, renderTable)
+
+	return report, nil
+}
@@ -0,0 +1,641 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRunConfig = `
+rules:
+  - name: trash
+    folders: [Trash]
+    action: delete
+    age: 7
+  - name: sent
+    folders: [Sent]
+    action: archive
+    age: 365
+    archive-pattern: year
+  - action: archive
+    age: 180
+    exclude-folder: [Keep]
+`
+
+func TestRunCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 削除対象(Trash: 7日以上経過)
+	deleteTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "Trash", "cur", 7),
+		createMailByDays(t, temp, "Trash.Sub", "cur", 200),
+	}
+
+	// アーカイブ対象(Sent: 365日以上経過)
+	yearArchiveTargetMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "Sent", "cur", 2020, 1),
+	}
+
+	// アーカイブ対象(その他: 180日以上経過)
+	keepArchiveTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "", "cur", 180),
+		createMailByDays(t, temp, "A", "new", 181),
+	}
+
+	// 対象外
+	nonTargetMails := []collector.Mail{
+		createMailByDays(t, temp, "Trash", "cur", 6),
+		createMailByDays(t, temp, "Sent", "cur", 364), // 最初に該当したルールで判定されるので、180日ルールは使われない
+		createMailByDays(t, temp, "", "cur", 179),
+		createMailByDays(t, temp, "Keep", "cur", 1000),     // 除外フォルダ
+		createMailByDays(t, temp, "Archived", "cur", 1000), // アーカイブフォルダ
+	}
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Trash\nSent\nA\nKeep\nArchived\n")
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, testRunConfig)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range deleteTargetMails {
+		assert.NoFileExists(t, mail.FullPath)
+	}
+	for _, mail := range yearArchiveTargetMails {
+		assert.NoFileExists(t, mail.FullPath)
+		assert.FileExists(t, filepath.Join(temp, ".Archived.2020", mail.SubDirName, mail.FileName))
+	}
+	for _, mail := range keepArchiveTargetMails {
+		assert.NoFileExists(t, mail.FullPath)
+
+		archivedFolderName := "Archived"
+		if mail.FolderName != "" {
+			archivedFolderName += "." + mail.FolderName
+		}
+		assert.FileExists(t, filepath.Join(temp, "."+archivedFolderName, mail.SubDirName, mail.FileName))
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s config: %s
+Completed search. The target mails are listed below.
++-------+---------+-----------+-----------------+------------------+
+| Rule  | Action  | Name      | Number of mails | Total size(byte) |
++-------+---------+-----------+-----------------+------------------+
+| trash | delete  | Trash     |               1 |                7 |
+| trash | delete  | Trash.Sub |               1 |              200 |
+| sent  | archive | Sent      |               1 |            2,021 |
+| #3    | archive |           |               1 |              180 |
+| #3    | archive | A         |               1 |              181 |
++-------+---------+-----------+-----------------+------------------+
+|                       Total |               5 |            2,589 |
++-------+---------+-----------+-----------------+------------------+
+Starts deleting mails. rule: trash
+Completed deletion.
+Starts archiving mails. rule: sent
+Completed archive.
+Starts archiving mails. rule: #3
+Completed archive.
+Completed all rules. The results are listed below.
++-------+---------+---------------+-----------------+------------------+
+| Rule  | Action  | Name          | Number of mails | Total size(byte) |
++-------+---------+---------------+-----------------+------------------+
+| trash | delete  | Trash         |               1 |                7 |
+| trash | delete  | Trash.Sub     |               1 |              200 |
+| sent  | archive | Archived.2020 |               1 |            2,021 |
+| #3    | archive | Archived      |               1 |              180 |
+| #3    | archive | Archived.A    |               1 |              181 |
++-------+---------+---------------+-----------------+------------------+
+|                           Total |               5 |            2,589 |
++-------+---------+---------------+-----------------+------------------+
+`, temp, configPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestRunCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	test.CreateMailFolder(t, temp, "") // INBOX
+
+	targetMails := []collector.Mail{
+		createMailByDays(t, temp, "Trash", "cur", 7),
+		createMailByYearMonth(t, temp, "Sent", "cur", 2020, 1),
+	}
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "Trash\nSent\n")
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, testRunConfig)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	assert.Equal(t, "Trash\nSent\n", test.ReadFile(t, subscriptionsPath))
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s config: %s
+Completed search. The target mails are listed below.
++-------+---------+-------+-----------------+------------------+
+| Rule  | Action  | Name  | Number of mails | Total size(byte) |
++-------+---------+-------+-----------------+------------------+
+| trash | delete  | Trash |               1 |                7 |
+| sent  | archive | Sent  |               1 |            2,021 |
++-------+---------+-------+-----------------+------------------+
+|                   Total |               2 |            2,028 |
++-------+---------+-------+-----------------+------------------+
+Dry run. rule: trash The following mails would be deleted.
+  %s
+Dry run. rule: sent The mails would be archived as listed below.
++------+----------------+-----------------+------------------+
+| Name | Archive folder | Number of mails | Total size(byte) |
++------+----------------+-----------------+------------------+
+| Sent | Archived.2020  |               1 |            2,021 |
++------+----------------+-----------------+------------------+
+|                 Total |               1 |            2,021 |
++------+----------------+-----------------+------------------+
+Folders to be created:
+  Archived
+  Archived.2020
+Folders to be subscribed:
+  Archived
+  Archived.2020
+Mails to be moved:
+  %s -> %s
+`, temp, configPath,
+		targetMails[0].FullPath,
+		targetMails[1].FullPath, filepath.Join(temp, ".Archived.2020", "cur", targetMails[1].FileName))
+	assert.Equal(t, expected, result)
+}
+
+func TestRunCmd_Empty(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	test.CreateMailFolder(t, temp, "") // INBOX
+	createMailByDays(t, temp, "Trash", "cur", 6)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, testRunConfig)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s config: %s
+Completed search. There were no target mails.
+`, temp, configPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestRunCmd_InvalidAction(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: trash
+    action: remove
+    age: 7
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "rule trash: invalid action 'remove'")
+}
+
+func TestRunCmd_AgeRequired(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - action: delete
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "rule #1: age or keep-last is required")
+}
+
+func TestRunCmd_InvalidTimezone(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+timezone: Asia/Xxx
+rules:
+  - action: delete
+    age: 1
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid timezone 'Asia/Xxx'")
+}
+
+func TestRunCmd_UnknownField(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - action: delete
+    age: 1
+    keep-flaged: true
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, configPath+" is invalid config: yaml: unmarshal errors:\n  line 5: field keep-flaged not found in type cmd.ruleConfig")
+}
+
+func TestRunCmd_ConfigNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	configPath := filepath.Join(temp, "config.yaml") // 存在しないファイル
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.Error(t, err)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + configPath
+	assert.Contains(t, err.Error(), expect)
+}
+
+func TestRunCmd_KeepGoingMultipleMaildirs(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	user1 := test.CreateDir(t, temp, "user1")
+	createMailByDays(t, user1, "", "cur", 10)
+	createBrokenFolder(t, user1, "A")
+
+	user2 := test.CreateDir(t, temp, "user2")
+	createMailByDays(t, user2, "", "cur", 20)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: old
+    action: delete
+    age: 5
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"--dir-glob", filepath.Join(temp, "user*"),
+		"-c", configPath,
+		"--keep-going",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 mails")
+
+	result := buf.String()
+	assert.Contains(t, result, fmt.Sprintf("| %s | Partial |               1 |               10 |\n", user1))
+	assert.Contains(t, result, fmt.Sprintf("| %s | OK      |               1 |               20 |\n", user2))
+}
+
+func TestRunCmd_KeepGoingOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateMailFolder(t, temp, "")
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+
+	deletedMail := createMailByDays(t, temp, "B", "cur", 30)
+	archivedMail := createMailByDays(t, temp, "A", "cur", 10)
+	failedMail := createMailByDays(t, temp, "A", "cur", 20)
+
+	// アーカイブ先に同じ名前のものがあって移動できない
+	createMailByDays(t, temp, "Archived.A", "cur", 20)
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: old
+    folders: [B]
+    action: delete
+    age: 5
+  - name: archive
+    folders: [A]
+    action: archive
+    age: 5
+    on-conflict: fail
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+		"--keep-going",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "failed to process 1 mails")
+
+	assert.NoFileExists(t, deletedMail.FullPath)
+	assert.NoFileExists(t, archivedMail.FullPath)
+	assert.FileExists(t, failedMail.FullPath)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	// 削除やアーカイブができたもののみ
+	assert.Equal(t, "partial", output.Maildirs[0].Status)
+	assert.Equal(t, []folderReport{
+		{Rule: "old", Action: "delete", Name: "B", Count: 1, Size: 30},
+		{Rule: "archive", Action: "archive", Name: "A", Count: 1, Size: 10},
+	}, output.Maildirs[0].Folders)
+	assert.Equal(t, totalReport{Count: 2, Size: 40}, output.Maildirs[0].Total)
+	assert.Equal(t, 1, len(output.Maildirs[0].Archived))
+	require.Equal(t, 1, len(output.Maildirs[0].Failures))
+	assert.Equal(t, failedMail.FullPath, output.Maildirs[0].Failures[0].Path)
+}
+
+func TestRunCmd_KeepLast(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMail := createMailByDays(t, temp, "Sent", "cur", 3)
+	otherMails := []collector.Mail{
+		createMailByDays(t, temp, "Sent", "cur", 2),
+		createMailByDays(t, temp, "Sent", "cur", 1),
+		createMailByDays(t, temp, "", "cur", 100), // 残すものは後続のルールでも対象外
+	}
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: sent
+    folders: [Sent]
+    action: delete
+    keep-last: [2]
+  - name: others
+    action: delete
+    age: 10
+    keep-last: ["=1"]
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMail.FullPath)
+	for _, mail := range otherMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestRunCmd_ThreadAware(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMail := createMailByDaysAndContent(t, temp, "", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+	otherMails := []collector.Mail{
+		createMailByDaysAndContent(t, temp, "", "cur", 50, "Message-ID: <2@example.com>\n\nbody"),
+		createMailByDaysAndContent(t, temp, "Sent", "cur", 5, "Message-ID: <3@example.com>\nIn-Reply-To: <2@example.com>\n\nbody"),
+	}
+	// thread-awareで無いルールは、スレッドに関わらず対象
+	otherRuleMail := createMailByDaysAndContent(t, temp, "Sent", "cur", 30, "Message-ID: <5@example.com>\nIn-Reply-To: <2@example.com>\n\nbody")
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: sent
+    folders: [Sent]
+    action: delete
+    age: 10
+  - name: inbox
+    action: delete
+    age: 10
+    thread-aware: true
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, targetMail.FullPath)
+	assert.NoFileExists(t, otherRuleMail.FullPath)
+	for _, mail := range otherMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+}
+
+func TestRunCmd_ThreadAwareReadError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	targetMail := createMailByDaysAndContent(t, temp, "", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+
+	// 対象外のフォルダにある読み込めないメール (リンク先が無い)
+	otherMail := createMailByDays(t, temp, "Sent", "cur", 30)
+	require.NoError(t, os.Remove(otherMail.FullPath))
+	require.NoError(t, os.Symlink(filepath.Join(temp, "not_found"), otherMail.FullPath))
+
+	configPath := filepath.Join(temp, "config.yaml")
+	test.CreateFile(t, configPath, `
+rules:
+  - name: inbox
+    folders: [""]
+    action: delete
+    age: 10
+    thread-aware: true
+`)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"run",
+		"-d", temp,
+		"-c", configPath,
+	})
+
+	rootCmd.SetOutput(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	// 対象とならないメールは単独のスレッドとして扱い、中断しない
+	require.NoError(t, err)
+	assert.NoFileExists(t, targetMail.FullPath)
+}
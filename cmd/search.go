@@ -3,9 +3,12 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
 	"github.com/onozaty/maildir-cleaner/collector"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func newSearchCmd() *cobra.Command {
@@ -15,49 +18,206 @@ func newSearchCmd() *cobra.Command {
 		Short: "Search old mails",
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			maildirPath, _ := cmd.Flags().GetString("dir")
-			age, _ := cmd.Flags().GetInt64("age")
-			excludeFolderNames, _ := cmd.Flags().GetStringArray("exclude-folder")
+			maildirTargets, err := newMaildirTargets(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := requireAgeOr(cmd.Flags(), "keep-last"); err != nil {
+				return err
+			}
+
+			condition, err := newCondition(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			listOption, err := newListOption(cmd.Flags())
+			if err != nil {
+				return err
+			}
 
 			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
 			cmd.SilenceUsage = true
 
-			return runSearch(
-				maildirPath,
-				age,
-				excludeFolderNames,
-				cmd.OutOrStdout())
+			return maildirTargets.run(output, func(maildirPath string, writer io.Writer) (*report, error) {
+				return runSearch(
+					maildirPath,
+					*condition,
+					listOption,
+					writer,
+					output.isTable())
+			})
 		},
 	}
 
-	subCmd.Flags().StringP("dir", "d", "", "User maildir path.")
-	subCmd.MarkFlagRequired("dir")
+	addMaildirFlags(subCmd)
 	subCmd.Flags().Int64P("age", "a", 0, "The number of age days to be displayed.\nIf you specify 10, mail that has been in the mailbox for more than 10 days since its arrival will be displayed.")
-	subCmd.MarkFlagRequired("age")
-	subCmd.Flags().StringArrayP("exclude-folder", "", []string{}, "The name of the folder to exclude.")
+	addConditionFlags(subCmd.Flags())
+	subCmd.Flags().BoolP("list", "", false, "Show each target mail.")
+	subCmd.Flags().StringP("sort", "", sortByFolder, "Sort order of the mails shown by --list. can be specified: folder, time (oldest first), size (largest first)")
+	subCmd.Flags().IntP("limit", "", 0, "The maximum number of the mails shown by --list. (0 is unlimited)")
+	subCmd.Flags().BoolP("show-headers", "", false, "Show the Subject and From headers of the mails shown by --list.")
+	addOutputFlag(subCmd.Flags())
 
 	return subCmd
 }
 
-func runSearch(maildirPath string, age int64, excludeFolderNames []string, writer io.Writer) error {
+func runSearch(maildirPath string, condition collector.Condition, listOption *listOption, writer io.Writer, renderTable bool) (*report, error) {
 
 	// 対象のメールを収集
-	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d\n", maildirPath, age)
-	collector := collector.NewCollector(age, excludeFolderNames...)
+	fmt.Fprintf(writer, "Starts searching for the target mails. maildir: %s age: %d\n", maildirPath, condition.AgeOfDays)
+	collector := collector.NewConditionCollector(condition)
 	mails, err := collector.Collect(maildirPath)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(*mails) == 0 {
 		// 対象無し
 		fmt.Fprintf(writer, "Completed search. There were no target mails.\n")
-		return nil
+		return &report{}, nil
 	}
 
 	fmt.Fprintf(writer, "Completed search. The target mails are listed below.\n")
-	renderTargetMails(writer, mails)
 
-	return nil
+	// --thread-aware の場合は、スレッドの数も合わせて
+	threads := collector.Threads()
+	if renderTable {
+		if threads != nil {
+			renderTargetThreads(writer, mails, threads)
+		} else {
+			renderTargetMails(writer, mails)
+		}
+	}
+
+	report := newReport("", "", mails)
+	if threads != nil {
+		report.addThreads(mails, threads)
+	}
+
+	if listOption != nil {
+		// メール毎の一覧
+		listedMails, err := listMails(mails, listOption, threads)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Listing %d of %d target mails sorted by %s.\n", len(listedMails), len(*mails), listOption.Sort)
+		if renderTable {
+			renderListedMails(writer, listedMails, listOption.ShowHeaders, threads != nil)
+		}
+		report.addListedMails(listedMails)
+	}
+
+	return report, nil
+}
+
+const (
+	sortByFolder = "folder"
+	sortByTime   = "time"
+	sortBySize   = "size"
+)
+
+type listOption struct {
+	Sort        string
+	Limit       int
+	ShowHeaders bool
+	Location    *time.Location // 日時を表示するタイムゾーン
+}
+
+type listedMail struct {
+	collector.Mail
+	Subject     string
+	From        string
+	ThreadMails int // --thread-aware の場合のみ (スレッド全体のメール数)
+}
+
+func newListOption(f *pflag.FlagSet) (*listOption, error) {
+
+	list, _ := f.GetBool("list")
+	if !list {
+		return nil, nil
+	}
+
+	sort, _ := f.GetString("sort")
+	limit, _ := f.GetInt("limit")
+	showHeaders, _ := f.GetBool("show-headers")
+
+	switch sort {
+	case sortByFolder, sortByTime, sortBySize:
+	default:
+		return nil, fmt.Errorf("invalid sort '%s'", sort)
+	}
+
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must be 0 or more")
+	}
+
+	location, err := getLocation(f)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		location = time.Local
+	}
+
+	return &listOption{
+		Sort:        sort,
+		Limit:       limit,
+		ShowHeaders: showHeaders,
+		Location:    location,
+	}, nil
+}
+
+func listMails(mails *[]collector.Mail, listOption *listOption, threads *collector.Threads) ([]listedMail, error) {
+
+	// 元の並び(フォルダ名+ファイル名)は崩さないようにコピーしてソート
+	sortedMails := append([]collector.Mail{}, *mails...)
+
+	switch listOption.Sort {
+	case sortByTime:
+		sort.SliceStable(sortedMails, func(i, j int) bool {
+			return sortedMails[i].Time.Before(sortedMails[j].Time)
+		})
+	case sortBySize:
+		sort.SliceStable(sortedMails, func(i, j int) bool {
+			return sortedMails[i].Size > sortedMails[j].Size
+		})
+	}
+
+	if listOption.Limit != 0 && len(sortedMails) > listOption.Limit {
+		sortedMails = sortedMails[:listOption.Limit]
+	}
+
+	listedMails := []listedMail{}
+	for _, mail := range sortedMails {
+		listed := listedMail{Mail: mail}
+		// 経過日の判定と同じタイムゾーンで表示
+		listed.Time = mail.Time.In(listOption.Location)
+
+		if threads != nil {
+			listed.ThreadMails = threads.MailCount(mail)
+		}
+
+		if listOption.ShowHeaders {
+			// 表示するメールのヘッダのみ読み込む
+			header, err := collector.ReadHeader(mail.FullPath)
+			if err != nil {
+				return nil, err
+			}
+			listed.Subject = collector.DecodeHeaderValue(header.Get("Subject"))
+			listed.From = collector.DecodeHeaderValue(header.Get("From"))
+		}
+
+		listedMails = append(listedMails, listed)
+	}
+
+	return listedMails, nil
 }
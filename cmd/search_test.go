@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -215,6 +219,560 @@ Completed search. There were no target mails.
 	assert.Equal(t, expected, result)
 }
 
+func TestSearchCmd_Size(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 対象(1日以上経過、かつ、1KB以上2KB以下)
+	targetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "new", 1000),
+		createMailByDays(t, temp, "", "cur", 2000),
+		// A
+		createMailByDays(t, temp, "A", "new", 1500),
+	}
+
+	// 対象外(サイズが範囲外)
+	nonTargetMails := []collector.Mail{
+		// INBOX
+		createMailByDays(t, temp, "", "new", 999),
+		createMailByDays(t, temp, "", "cur", 2001),
+		// A
+		createMailByDays(t, temp, "A", "new", 10),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "1",
+		"--min-size", "1KB",
+		"--max-size", "2KB",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 対象/対象外のメールが削除されていないこと
+	for _, mail := range targetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+	for _, mail := range nonTargetMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |            3,000 |
+| A     |               1 |            1,500 |
++-------+-----------------+------------------+
+| Total |               3 |            4,500 |
++-------+-----------------+------------------+
+`, temp, 1)
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_InvalidSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "1",
+		"--min-size", "1XB",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid min-size '1XB'")
+}
+
+func TestSearchCmd_MinSizeGreaterThanMaxSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "1",
+		"--min-size", "2MB",
+		"--max-size", "1MB",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "min-size must be less than or equal to max-size")
+}
+
+func TestSearchCmd_TimeSource(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+
+	// 対象(ヘッダ or 更新日時で10日以上経過)
+	targetMailPaths := []string{}
+	{
+		mailPath := filepath.Join(inbox, "cur", "imported-1")
+		test.CreateFile(t, mailPath, "Date: "+test.AgoDays(t, 10).Format(time.RFC1123Z)+"\n\nbody")
+		targetMailPaths = append(targetMailPaths, mailPath)
+	}
+	{
+		mailPath := filepath.Join(inbox, "cur", "imported-2")
+		test.CreateFile(t, mailPath, "Subject: no date\n\nbody")
+		modTime := test.AgoDays(t, 11)
+		require.NoError(t, os.Chtimes(mailPath, modTime, modTime))
+		targetMailPaths = append(targetMailPaths, mailPath)
+	}
+
+	// 対象外
+	{
+		mailPath := filepath.Join(inbox, "cur", "imported-3")
+		test.CreateFile(t, mailPath, "Date: "+test.AgoDays(t, 9).Format(time.RFC1123Z)+"\n\nbody")
+		// ヘッダが優先されるので、更新日時は使われない
+		modTime := test.AgoDays(t, 100)
+		require.NoError(t, os.Chtimes(mailPath, modTime, modTime))
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--time-source", "date-header,mtime",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |               65 |
++-------+-----------------+------------------+
+| Total |               2 |               65 |
++-------+-----------------+------------------+
+`, temp, 10)
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_InvalidTimeSource(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "1",
+		"--time-source", "filename,ctime",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid time-source 'ctime'")
+}
+
+func TestSearchCmd_OutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByDays(t, temp, "", "cur", 10)
+	createMailByDays(t, temp, "", "new", 11)
+	createMailByDays(t, temp, "A", "cur", 12)
+	createMailByDays(t, temp, "A", "cur", 1) // 対象外
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 標準出力には結果のみ
+	expected := fmt.Sprintf(`{
+  "command": "search",
+  "dryRun": false,
+  "maildirs": [
+    {
+      "user": "%s",
+      "maildir": "%s",
+      "status": "ok",
+      "folders": [
+        {
+          "name": "",
+          "count": 2,
+          "size": 21
+        },
+        {
+          "name": "A",
+          "count": 1,
+          "size": 12
+        }
+      ],
+      "total": {
+        "count": 3,
+        "size": 33
+      },
+      "archived": []
+    }
+  ],
+  "total": {
+    "count": 3,
+    "size": 33
+  }
+}
+`, temp, temp)
+	assert.Equal(t, expected, stdout.String())
+
+	// 進捗は標準エラーに
+	expectedProgress := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
+`, temp, 10)
+	assert.Equal(t, expectedProgress, stderr.String())
+}
+
+func TestSearchCmd_OutputCSV(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByDays(t, temp, "", "cur", 10)
+	createMailByDays(t, temp, "テスト,1", "cur", 11)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"-o", "csv",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expected := fmt.Sprintf(`record,user,maildir,status,error,rule,action,folder,archiveFolder,source,destination,count,size,path,subDir,fileName,time,subject,from
+folder,%s,%s,,,,,,,,,1,10,,,,,,
+folder,%s,%s,,,,,"テスト,1",,,,1,11,,,,,,
+maildir,%s,%s,ok,,,,,,,,2,21,,,,,,
+total,,,,,,,,,,,2,21,,,,,,
+`, temp, temp, temp, temp, temp, temp)
+	assert.Equal(t, expected, stdout.String())
+}
+
+func TestSearchCmd_InvalidOutput(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--output", "xml",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid output 'xml'")
+}
+
+func TestSearchCmd_List(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2021, 3),
+		createMailByYearMonth(t, temp, "", "new", 2020, 1),
+		createMailByYearMonth(t, temp, "A", "cur", 2022, 12),
+		createMailByYearMonth(t, temp, "A", "cur", 2021, 1),
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--list",
+		"--sort", "size",
+		"--limit", "3",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// サイズの大きい順に3件
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |            4,045 |
+| A     |               2 |            4,056 |
++-------+-----------------+------------------+
+| Total |               4 |            8,101 |
++-------+-----------------+------------------+
+Listing 3 of 4 target mails sorted by size.
++------+-----+------------+------------+---------------------+
+| Name | Sub | File name  | Size(byte) | Time                |
++------+-----+------------+------------+---------------------+
+| A    | cur | %s |      2,034 | %s |
+|      | cur | %s |      2,024 | %s |
+| A    | cur | %s |      2,022 | %s |
++------+-----+------------+------------+---------------------+
+`, temp, 10,
+		mails[2].FileName, mails[2].Time.Local().Format(listTimeLayout),
+		mails[0].FileName, mails[0].Time.Local().Format(listTimeLayout),
+		mails[3].FileName, mails[3].Time.Local().Format(listTimeLayout))
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_ListTimezone(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 2021/1/1 0:00(UTC) は America/New_York では 2020/12/31 19:00
+	mail := createMailByYearMonth(t, temp, "", "cur", 2021, 1)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--list",
+		"--timezone", "America/New_York",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: %d
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |            2,022 |
++-------+-----------------+------------------+
+| Total |               1 |            2,022 |
++-------+-----------------+------------------+
+Listing 1 of 1 target mails sorted by folder.
++------+-----+------------+------------+---------------------+
+| Name | Sub | File name  | Size(byte) | Time                |
++------+-----+------------+------------+---------------------+
+|      | cur | %s |      2,022 | 2020-12-31 19:00:00 |
++------+-----+------------+------------+---------------------+
+`, temp, 10, mail.FileName)
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_ListTimezoneOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByYearMonth(t, temp, "", "cur", 2021, 1)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--list",
+		"--timezone", "America/New_York",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+	require.Equal(t, 1, len(output.Maildirs[0].Mails))
+
+	assert.Equal(t, "2020-12-31T19:00:00-05:00", output.Maildirs[0].Mails[0].Time)
+}
+
+func TestSearchCmd_ListWithHeaders(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mail1 := createMailByDaysAndContent(t, temp, "", "cur", 20, "From: =?UTF-8?B?44OG44K544OI?= <a@example.com>\r\nSubject: =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?=\r\n\r\nbody")
+	mail2 := createMailByDaysAndContent(t, temp, "", "cur", 30, "From: b@example.com\r\nSubject: Hello\r\n\r\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--list",
+		"--sort", "time",
+		"--show-headers",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(stderr)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 古い順に、デコードされたヘッダが含まれること
+	expected := fmt.Sprintf(`      "mails": [
+        {
+          "folder": "",
+          "subDir": "cur",
+          "fileName": "%s",
+          "path": "%s",
+          "size": %d,
+          "time": "%s",
+          "subject": "Hello",
+          "from": "b@example.com"
+        },
+        {
+          "folder": "",
+          "subDir": "cur",
+          "fileName": "%s",
+          "path": "%s",
+          "size": %d,
+          "time": "%s",
+          "subject": "テスト",
+          "from": "テスト <a@example.com>"
+        }
+      ]
+`,
+		mail2.FileName, mail2.FullPath, mail2.Size, mail2.Time.Local().Format(time.RFC3339),
+		mail1.FileName, mail1.FullPath, mail1.Size, mail1.Time.Local().Format(time.RFC3339))
+	assert.Contains(t, stdout.String(), expected)
+	assert.Contains(t, stderr.String(), "Listing 2 of 2 target mails sorted by time.\n")
+}
+
+func TestSearchCmd_InvalidSort(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--list",
+		"--sort", "name",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "invalid sort 'name'")
+}
+
 func TestSearch_MaildirNotFound(t *testing.T) {
 
 	// ARRANGE
@@ -241,3 +799,142 @@ func TestSearch_MaildirNotFound(t *testing.T) {
 	expect := "open " + rootMailFolderPath
 	assert.Contains(t, err.Error(), expect)
 }
+
+func TestSearchCmd_KeepLastWithoutAge(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByDays(t, temp, "", "cur", 3)
+	createMailByDays(t, temp, "", "cur", 2)
+	createMailByDays(t, temp, "", "cur", 1)
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"--keep-last", "1",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 経過日数を指定しなければ、件数のみで
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 0
+Completed search. The target mails are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               2 |                5 |
++-------+-----------------+------------------+
+| Total |               2 |                5 |
++-------+-----------------+------------------+
+`, temp)
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_ThreadAware(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// スレッド1: 全て経過日数を過ぎている (フォルダをまたぐ)
+	thread1Mail := createMailByDaysAndContent(t, temp, "", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+	thread1Reply := createMailByDaysAndContent(t, temp, "Sent", "cur", 30, "Message-ID: <2@example.com>\nIn-Reply-To: <1@example.com>\n\nbody")
+	// スレッド2: 返信が経過日数未満
+	createMailByDaysAndContent(t, temp, "", "cur", 50, "Message-ID: <3@example.com>\n\nbody")
+	createMailByDaysAndContent(t, temp, "Sent", "cur", 5, "Message-ID: <4@example.com>\nReferences: <3@example.com>\n\nbody")
+	// スレッド3: 単独
+	singleMail := createMailByDaysAndContent(t, temp, "", "cur", 20, "Message-ID: <5@example.com>\n\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--thread-aware",
+		"--list",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// フォルダをまたぐスレッドは、合計では1つとして数える
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts searching for the target mails. maildir: %s age: 10
+Completed search. The target mails are listed below.
++-------+-------------------+-----------------+------------------+
+| Name  | Number of threads | Number of mails | Total size(byte) |
++-------+-------------------+-----------------+------------------+
+|       |                 2 |               2 |               66 |
+| Sent  |                 1 |               1 |               62 |
++-------+-------------------+-----------------+------------------+
+| Total |                 2 |               3 |              128 |
++-------+-------------------+-----------------+------------------+
+Listing 3 of 3 target mails sorted by folder.
++------+-----+------------+------------+---------------------+--------------+
+| Name | Sub | File name  | Size(byte) | Time                | Thread mails |
++------+-----+------------+------------+---------------------+--------------+
+|      | cur | %s |         33 | %s |            2 |
+|      | cur | %s |         33 | %s |            1 |
+| Sent | cur | %s |         62 | %s |            2 |
++------+-----+------------+------------+---------------------+--------------+
+`, temp,
+		thread1Mail.FileName, thread1Mail.Time.Local().Format(listTimeLayout),
+		singleMail.FileName, singleMail.Time.Local().Format(listTimeLayout),
+		thread1Reply.FileName, thread1Reply.Time.Local().Format(listTimeLayout))
+	assert.Equal(t, expected, result)
+}
+
+func TestSearchCmd_ThreadAwareOutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	createMailByDaysAndContent(t, temp, "", "cur", 40, "Message-ID: <1@example.com>\n\nbody")
+	createMailByDaysAndContent(t, temp, "", "cur", 30, "Message-ID: <2@example.com>\nIn-Reply-To: <1@example.com>\n\nbody")
+	createMailByDaysAndContent(t, temp, "", "cur", 20, "Message-ID: <3@example.com>\n\nbody")
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"search",
+		"-d", temp,
+		"-a", "10",
+		"--thread-aware",
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	var output struct {
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	require.Equal(t, 1, len(output.Maildirs))
+
+	assert.Equal(t, 2, output.Maildirs[0].Threads)
+	assert.Equal(t, []folderReport{
+		{Name: "", Count: 3, Size: 128, Threads: 2},
+	}, output.Maildirs[0].Folders)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/spf13/pflag"
+)
+
+type targetSizeOption struct {
+	Size  int64
+	Order collector.TargetSizeOrder
+}
+
+type targetSizeReport struct {
+	MailboxSize int64 `json:"mailboxSize"`
+	TargetSize  int64 `json:"targetSize"`
+	FreedSize   int64 `json:"freedSize"`
+	Reached     bool  `json:"reached"`
+}
+
+func addTargetSizeFlags(f *pflag.FlagSet) {
+
+	f.StringP("target-size", "", "", "Target size of the mailbox. (e.g. 500MB, 2GB, 1GiB)\nInstead of the age, the mails are selected until the mailbox size is under the target size.\nIf --age is also specified, only the mails older than the age are selected.")
+	f.StringP("target-order", "", string(collector.TargetSizeOrderOldest), "Order in which the mails are selected with --target-size. can be specified: oldest, largest")
+}
+
+func newTargetSizeOption(f *pflag.FlagSet) (*targetSizeOption, error) {
+
+	targetSizeValue, _ := f.GetString("target-size")
+	if targetSizeValue == "" {
+		if f.Changed("target-order") {
+			return nil, fmt.Errorf("--target-order can only be used with --target-size")
+		}
+		return nil, nil
+	}
+
+	targetSize, err := parseSize("target-size", targetSizeValue)
+	if err != nil {
+		return nil, err
+	}
+
+	targetOrderValue, _ := f.GetString("target-order")
+	targetOrder, err := collector.ParseTargetSizeOrder(targetOrderValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &targetSizeOption{
+		Size:  targetSize,
+		Order: targetOrder,
+	}, nil
+}
+
+func (o *targetSizeOption) String() string {
+
+	if o == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(" target size: %s order: %s", humanize.Comma(o.Size), o.Order)
+}
+
+func selectByTargetSize(maildirPath string, mails *[]collector.Mail, condition collector.Condition, option *targetSizeOption, writer io.Writer) (*[]collector.Mail, *targetSizeReport, error) {
+
+	// 対象外のフォルダもメールボックスのサイズには含める (対象外のフォルダのメールは選ばれないだけ)
+	mailboxSize, err := collector.MailboxSize(maildirPath, condition.KeepGoing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selectedMails := collector.SelectByTargetSize(mails, mailboxSize, option.Size, option.Order)
+	fmt.Fprintf(writer, "Mailbox size: %s target size: %s selected: %s\n",
+		humanize.Comma(mailboxSize), humanize.Comma(option.Size), humanize.Comma(collector.TotalSize(selectedMails)))
+
+	return selectedMails, &targetSizeReport{
+		MailboxSize: mailboxSize,
+		TargetSize:  option.Size,
+	}, nil
+}
+
+// 減らしたサイズを集計して、目標と比べて表示
+func renderFreedSize(writer io.Writer, targetSize *targetSizeReport, mails *[]collector.Mail, failures []collector.MailError, dryRun bool) {
+
+	if targetSize == nil {
+		return
+	}
+
+	// 処理できなかったものは減っていない
+	failedPaths := map[string]bool{}
+	for _, failure := range failures {
+		failedPaths[failure.Path] = true
+	}
+	for _, mail := range *mails {
+		if !failedPaths[mail.FullPath] {
+			targetSize.FreedSize += mail.Size
+		}
+	}
+
+	remainingSize := targetSize.MailboxSize - targetSize.FreedSize
+	targetSize.Reached = remainingSize <= targetSize.TargetSize
+
+	neededSize := targetSize.MailboxSize - targetSize.TargetSize
+	if neededSize < 0 {
+		neededSize = 0
+	}
+
+	if dryRun {
+		fmt.Fprintf(writer, "Would free %s of the %s needed. mailbox size: %s -> %s\n",
+			humanize.Comma(targetSize.FreedSize), humanize.Comma(neededSize), humanize.Comma(targetSize.MailboxSize), humanize.Comma(remainingSize))
+	} else {
+		fmt.Fprintf(writer, "Freed %s of the %s needed. mailbox size: %s -> %s\n",
+			humanize.Comma(targetSize.FreedSize), humanize.Comma(neededSize), humanize.Comma(targetSize.MailboxSize), humanize.Comma(remainingSize))
+	}
+
+	if !targetSize.Reached {
+		fmt.Fprintf(writer, "The mailbox size is still over the target size.\n")
+	}
+}
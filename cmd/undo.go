@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/onozaty/maildir-cleaner/action"
+	"github.com/spf13/cobra"
+)
+
+func newUndoCmd() *cobra.Command {
+
+	subCmd := &cobra.Command{
+		Use:   "undo <journal>",
+		Short: "Undo the operations recorded in a journal",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			output, err := newOutput(cmd)
+			if err != nil {
+				return err
+			}
+
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			// 引数の解析に成功した時点で、エラーが起きてもUsageは表示しない
+			cmd.SilenceUsage = true
+
+			undoReport, err := runUndo(args[0], dryRun, output.Progress, output.isTable())
+			if err != nil {
+				return err
+			}
+
+			// ジャーナルには複数のmaildirの操作が含まれ得るので、maildirは無し
+			return output.write([]*report{completeReport(maildir{}, undoReport, nil)})
+		},
+	}
+
+	subCmd.Flags().BoolP("dry-run", "", false, "Show the mails to be moved back without actually moving them.")
+	addOutputFlag(subCmd.Flags())
+
+	return subCmd
+}
+
+func runUndo(journalPath string, dryRun bool, writer io.Writer, renderTable bool) (*report, error) {
+
+	fmt.Fprintf(writer, "Starts undoing the operations. journal: %s\n", journalPath)
+
+	if dryRun {
+		// 戻した場合の内容を表示するのみ
+		result, err := action.PlanUndo(journalPath)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(writer, "Dry run. The mails would be moved back as listed below.\n")
+		for _, entry := range result.Entries {
+			fmt.Fprintf(writer, "  %s -> %s\n", entry.Destination, entry.Source)
+		}
+		renderUndoSkipped(writer, result.Skipped)
+
+		return newUndoReport(result), nil
+	}
+
+	result, err := action.Undo(journalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Entries) == 0 {
+		fmt.Fprintf(writer, "Completed undo. There were no mails to move back.\n")
+	} else {
+		fmt.Fprintf(writer, "Completed undo. The mails moved back are listed below.\n")
+		if renderTable {
+			renderTargetMails(writer, result.RestoredMails)
+		}
+	}
+	renderUndoSkipped(writer, result.Skipped)
+
+	return newUndoReport(result), nil
+}
+
+func newUndoReport(result *action.UndoResult) *report {
+
+	// フォルダ毎の集計は戻した先(元のフォルダ)で
+	report := newReport("", "", result.RestoredMails)
+	report.addUndoneEntries(result.Entries, result.Skipped)
+
+	return report
+}
+
+func renderUndoSkipped(writer io.Writer, skipped []action.UndoSkipped) {
+
+	if len(skipped) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "Skipped operations:\n")
+	for _, s := range skipped {
+		fmt.Fprintf(writer, "  %s %s (%s)\n", s.Entry.Operation, s.Entry.Source, s.Reason)
+	}
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndoCmd(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "A\n")
+	journalPath := filepath.Join(t.TempDir(), "journal")
+
+	sourceMails := []collector.Mail{
+		createMailByYearMonth(t, temp, "", "cur", 2020, 12),
+		createMailByYearMonth(t, temp, "A", "new", 2021, 1),
+	}
+
+	// ジャーナルを記録しながらアーカイブしておく
+	{
+		archiveCmd := newRootCmd()
+		archiveCmd.SetArgs([]string{
+			"archive",
+			"-d", temp,
+			"-a", "10",
+			"--archive-pattern", "year",
+			"--journal", journalPath,
+		})
+		archiveCmd.SetOutput(new(bytes.Buffer))
+		require.NoError(t, archiveCmd.Execute())
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"undo",
+		journalPath,
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	for _, mail := range sourceMails {
+		assert.FileExists(t, mail.FullPath)
+	}
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts undoing the operations. journal: %s
+Completed undo. The mails moved back are listed below.
++-------+-----------------+------------------+
+| Name  | Number of mails | Total size(byte) |
++-------+-----------------+------------------+
+|       |               1 |            2,032 |
+| A     |               1 |            2,022 |
++-------+-----------------+------------------+
+| Total |               2 |            4,054 |
++-------+-----------------+------------------+
+`, journalPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestUndoCmd_DryRun(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+	journalPath := filepath.Join(t.TempDir(), "journal")
+
+	archivedMail := createMailByDays(t, temp, "", "cur", 20)
+	deletedMail := createMailByDays(t, temp, "", "cur", 30)
+
+	// 削除とアーカイブを記録しておく
+	for _, args := range [][]string{
+		{"delete", "-d", temp, "-a", "25", "--journal", journalPath},
+		{"archive", "-d", temp, "-a", "10", "--journal", journalPath},
+	} {
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOutput(new(bytes.Buffer))
+		require.NoError(t, cmd.Execute())
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"undo",
+		journalPath,
+		"--dry-run",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 戻されていないこと
+	assert.NoFileExists(t, archivedMail.FullPath)
+
+	// 標準出力の内容確認
+	result := buf.String()
+	expected := fmt.Sprintf(`Starts undoing the operations. journal: %s
+Dry run. The mails would be moved back as listed below.
+  %s -> %s
+Skipped operations:
+  delete %s (deleted mail cannot be restored)
+`, journalPath,
+		filepath.Join(temp, ".Archived", "cur", archivedMail.FileName), archivedMail.FullPath,
+		deletedMail.FullPath)
+	assert.Equal(t, expected, result)
+}
+
+func TestUndoCmd_OutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, "subscriptions"), "")
+	journalPath := filepath.Join(t.TempDir(), "journal")
+
+	archivedMail := createMailByDays(t, temp, "", "cur", 20)
+	deletedMail := createMailByDays(t, temp, "", "cur", 30)
+
+	// 削除とアーカイブを記録しておく
+	for _, args := range [][]string{
+		{"delete", "-d", temp, "-a", "25", "--journal", journalPath},
+		{"archive", "-d", temp, "-a", "10", "--journal", journalPath},
+	} {
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOutput(new(bytes.Buffer))
+		require.NoError(t, cmd.Execute())
+	}
+
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"undo",
+		journalPath,
+		"--output", "json",
+	})
+
+	stdout := new(bytes.Buffer)
+	rootCmd.SetOut(stdout)
+	rootCmd.SetErr(new(bytes.Buffer))
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.FileExists(t, archivedMail.FullPath)
+
+	var output struct {
+		Command  string   `json:"command"`
+		Maildirs []report `json:"maildirs"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	assert.Equal(t, "undo", output.Command)
+	require.Equal(t, 1, len(output.Maildirs))
+
+	// 戻したものと、戻せなかったものとその理由
+	assert.Equal(t, []folderReport{
+		{Name: "", Count: 1, Size: 20},
+	}, output.Maildirs[0].Folders)
+	assert.Equal(t, []undoneReport{
+		{
+			Operation:   "archive",
+			Folder:      "",
+			Source:      archivedMail.FullPath,
+			Destination: filepath.Join(temp, ".Archived", "cur", archivedMail.FileName),
+			Size:        20,
+		},
+	}, output.Maildirs[0].Undone)
+	assert.Equal(t, []undoneReport{
+		{
+			Operation: "delete",
+			Folder:    "",
+			Source:    deletedMail.FullPath,
+			Size:      30,
+			Reason:    "deleted mail cannot be restored",
+		},
+	}, output.Maildirs[0].Skipped)
+}
+
+func TestUndoCmd_NoArgs(t *testing.T) {
+
+	// ARRANGE
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{
+		"undo",
+	})
+
+	buf := new(bytes.Buffer)
+	rootCmd.SetOutput(buf)
+
+	// ACT
+	err := rootCmd.Execute()
+
+	// ASSERT
+	require.EqualError(t, err, "accepts 1 arg(s), received 0")
+}
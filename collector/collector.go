@@ -17,33 +17,154 @@ type Mail struct {
 	FileName   string
 	Size       int64
 	Time       time.Time
+	Flags      Flags
+}
+
+type Condition struct {
+	AgeOfDays          int64
+	MaxAgeOfDays       int64    // 0の場合は上限無し
+	FolderNames        []string // 指定された場合は、そのフォルダ(サブフォルダも含む)のみ対象に
+	ExcludeFolderNames []string
+	MinSize            int64           // 0の場合は下限無し
+	MaxSize            int64           // 0の場合は上限無し
+	KeepFlagged        bool            // フラグ付きのメールは対象外に
+	KeepUnread         bool            // 未読のメールは対象外に
+	OnlySeen           bool            // 既読のメールのみ対象に (KeepUnreadと同じ)
+	OnlyTrashed        bool            // 削除済みフラグが付いたメールのみ対象に
+	TimeSources        []TimeSource    // 未指定の場合はファイル名から
+	HeaderFilters      []*HeaderFilter // 全てに一致するものが対象
+	Location           *time.Location  // 指定された場合は、そのタイムゾーンでの当日0時から経過日を数える
+	KeepGoing          bool            // 読み込めないメールやフォルダがあっても、エラーを記録して続ける
+	KeepLast           KeepLast        // フォルダ毎に新しいものから指定件数は対象外に
+	ThreadAware        bool            // スレッド内で最も新しいメールが経過日を過ぎたものだけ対象に
+}
+
+// KeepGoingの場合に、エラーとなったメール(またはフォルダ)
+type MailError struct {
+	FolderName string
+	Path       string
+	Err        error
 }
 
 type Collector struct {
-	target func(Mail) bool
+	target      func(Mail) (bool, error)
+	timeSources []TimeSource
+	keepGoing   bool
+	keepLast    KeepLast
+	threadAware bool
+	threadTime  time.Time // スレッド内で最も新しいメールが、これより前であること
+	threads     *Threads
+	failures    []MailError
 }
 
 func NewCollector(ageOfDays int64, excludeFolderNames ...string) *Collector {
 
-	// 現在日時 - 経過日
-	targetMaxTime := time.Now().AddDate(0, 0, -int(ageOfDays))
+	return NewConditionCollector(Condition{
+		AgeOfDays:          ageOfDays,
+		ExcludeFolderNames: excludeFolderNames,
+	})
+}
+
+func NewConditionCollector(condition Condition) *Collector {
+
+	now := time.Now()
+	targetMaxTime := ageCutoffTime(now, condition.AgeOfDays, condition.Location)
+	targetMinTime := ageCutoffTime(now, condition.MaxAgeOfDays, condition.Location)
+
+	timeSources := condition.TimeSources
+	if len(timeSources) == 0 {
+		timeSources = []TimeSource{TimeSourceFileName}
+	}
 
 	return &Collector{
-		target: func(mail Mail) bool {
+		timeSources: timeSources,
+		keepGoing:   condition.KeepGoing,
+		keepLast:    condition.KeepLast,
+		threadAware: condition.ThreadAware,
+		threadTime:  targetMaxTime,
+		target: func(mail Mail) (bool, error) {
+
+			if len(condition.FolderNames) != 0 && !MatchFolder(mail.FolderName, condition.FolderNames) {
+				return false, nil
+			}
+
+			if excludeFolder(mail, condition.ExcludeFolderNames) {
+				return false, nil
+			}
+
+			if !matchSize(mail, condition.MinSize, condition.MaxSize) {
+				return false, nil
+			}
 
-			if excludeFolder(mail, excludeFolderNames) {
-				return false
+			if !matchFlags(mail, condition) {
+				return false, nil
 			}
 
 			// 日時が取れなかった場合(=0)は対象外
-			return mail.Time.Unix() != 0 && mail.Time.Before(targetMaxTime)
+			if mail.Time.Unix() == 0 || !mail.Time.Before(targetMaxTime) {
+				return false, nil
+			}
+
+			if condition.MaxAgeOfDays != 0 && mail.Time.Before(targetMinTime) {
+				return false, nil
+			}
+
+			// ヘッダの読み込みが必要なので最後に
+			return matchHeaders(mail, condition.HeaderFilters)
 		},
 	}
 }
 
+func ageCutoffTime(now time.Time, ageOfDays int64, location *time.Location) time.Time {
+
+	if location == nil {
+		// 現在日時 - 経過日
+		return now.AddDate(0, 0, -int(ageOfDays))
+	}
+
+	// 当日0時 - 経過日 (実行した時刻によって対象が変わらないように)
+	localNow := now.In(location)
+	return time.Date(localNow.Year(), localNow.Month(), localNow.Day()-int(ageOfDays), 0, 0, 0, 0, location)
+}
+
+func (c *Collector) Match(mail Mail) (bool, error) {
+	return c.target(mail)
+}
+
+// ThreadAwareの場合に、スレッド内で最も新しいメールも経過日を過ぎているか
+func (c *Collector) MatchThread(mail Mail, threads *Threads) (bool, error) {
+
+	if !c.threadAware {
+		return true, nil
+	}
+
+	// 対象のメールのヘッダを読み込めなかった場合は、スレッドが判断できないのでエラーに
+	if err := threads.Err(mail); err != nil {
+		return false, err
+	}
+
+	return threads.Newest(mail).Before(c.threadTime), nil
+}
+
+func (c *Collector) ThreadAware() bool {
+	return c.threadAware
+}
+
+// 直前のCollectで組み立てたスレッド (ThreadAwareで無い場合はnil)
+func (c *Collector) Threads() *Threads {
+	return c.threads
+}
+
+// 直前のCollectで、KeepGoingによってスキップしたもの
+func (c *Collector) Failures() []MailError {
+	return c.failures
+}
+
 func (c *Collector) Collect(rootMailFolderPath string) (*[]Mail, error) {
 
 	collectedMails := []Mail{}
+	c.failures = []MailError{}
+	c.threads = nil
 
 	// ルート(INBOX)
 	mails, err := c.collectMailFolder("", rootMailFolderPath, false)
@@ -84,12 +205,52 @@ func (c *Collector) Collect(rootMailFolderPath string) (*[]Mail, error) {
 		return collectedMails[i].FolderName < collectedMails[j].FolderName
 	})
 
+	if c.threadAware {
+		return c.filterByThread(rootMailFolderPath, &collectedMails)
+	}
+
 	return &collectedMails, nil
 }
 
+func (c *Collector) filterByThread(rootMailFolderPath string, mails *[]Mail) (*[]Mail, error) {
+
+	// スレッドは、対象外のフォルダや条件に一致しないものも含めた全てのメールから
+	// (読み込めなかったものは対象メールの収集時に記録しているので、ここでは含めないだけ)
+	allCollector := &Collector{
+		timeSources: c.timeSources,
+		keepGoing:   c.keepGoing,
+		target: func(mail Mail) (bool, error) {
+			return true, nil
+		},
+	}
+	allMails, err := allCollector.Collect(rootMailFolderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := BuildThreads(allMails)
+	c.threads = threads
+
+	filteredMails := []Mail{}
+	for _, mail := range *mails {
+		match, err := c.MatchThread(mail, threads)
+		if err != nil {
+			if c.skip(mail.FolderName, mail.FullPath, err) {
+				continue
+			}
+			return nil, err
+		}
+		if match {
+			filteredMails = append(filteredMails, mail)
+		}
+	}
+
+	return &filteredMails, nil
+}
+
 func (c *Collector) collectMailFolder(mailFolderName string, mailFolderPath string, skipSubdirMissing bool) (*[]Mail, error) {
 
-	collectedMails := []Mail{}
+	folderMails := []Mail{}
 
 	// tmpにあるのは配送中のものなので対象から除いておく
 	for _, subName := range []string{"new", "cur"} {
@@ -99,59 +260,117 @@ func (c *Collector) collectMailFolder(mailFolderName string, mailFolderPath stri
 			continue
 		}
 
-		mails, err := c.collectMails(mailFolderName, filepath.Join(mailFolderPath, subName))
+		mails, err := c.readMails(mailFolderName, subDir)
 		if err != nil {
+			if c.skip(mailFolderName, subDir, err) {
+				continue
+			}
 			return nil, err
 		}
 
-		collectedMails = append(collectedMails, *mails...)
+		folderMails = append(folderMails, *mails...)
+	}
+
+	// 新しいものから指定件数は残すので、条件に関わらず対象外に
+	keptMails := c.KeptMails(&folderMails)
+
+	collectedMails := []Mail{}
+	for _, mail := range folderMails {
+		if keptMails[mail.FullPath] {
+			continue
+		}
+
+		isTarget, err := c.target(mail)
+		if err != nil {
+			if c.skip(mailFolderName, mail.FullPath, err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if isTarget {
+			collectedMails = append(collectedMails, mail)
+		}
 	}
 
 	return &collectedMails, nil
 }
 
-func (c *Collector) collectMails(mailFolderName string, dirPath string) (*[]Mail, error) {
+func (c *Collector) readMails(mailFolderName string, dirPath string) (*[]Mail, error) {
 
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
 		return nil, err
 	}
 
-	collectedMails := []Mail{}
+	mails := []Mail{}
 
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 
+		fullPath := filepath.Join(dirPath, entry.Name())
+
 		info, err := entry.Info()
 		if err != nil {
+			if c.skip(mailFolderName, fullPath, err) {
+				continue
+			}
+			return nil, err
+		}
+
+		mailTime, err := MailTimeBySources(c.timeSources, fullPath, info)
+		if err != nil {
+			if c.skip(mailFolderName, fullPath, err) {
+				continue
+			}
 			return nil, err
 		}
 
 		mail := Mail{
-			FullPath:   filepath.Join(dirPath, info.Name()),
+			FullPath:   fullPath,
 			FolderName: mailFolderName,
 			SubDirName: filepath.Base(dirPath),
 			FileName:   info.Name(),
 			Size:       info.Size(),
-			Time:       MailTime(info.Name()),
+			Time:       mailTime,
+			Flags:      MailFlags(info.Name()),
 		}
 
-		if c.target(mail) {
-			collectedMails = append(collectedMails, mail)
-		}
+		mails = append(mails, mail)
 	}
 
-	return &collectedMails, nil
+	return &mails, nil
+}
+
+func (c *Collector) skip(mailFolderName string, path string, err error) bool {
+
+	if !c.keepGoing {
+		return false
+	}
+
+	// 配送や他の処理で消えたメールなどがあっても、残りは処理できるように
+	c.failures = append(c.failures, MailError{
+		FolderName: mailFolderName,
+		Path:       path,
+		Err:        err,
+	})
+	return true
 }
 
 func excludeFolder(mail Mail, excludeFolderNames []string) bool {
 
-	for _, excludeFolderName := range excludeFolderNames {
+	// 対象外のフォルダ名と一致(サブフォルダも考慮)
+	return MatchFolder(mail.FolderName, excludeFolderNames)
+}
+
+func MatchFolder(mailFolderName string, folderNames []string) bool {
 
-		if mail.FolderName == excludeFolderName || strings.HasPrefix(mail.FolderName, excludeFolderName+".") {
-			// 対象外のフォルダ名と一致(サブフォルダも考慮)
+	for _, folderName := range folderNames {
+
+		if mailFolderName == folderName || strings.HasPrefix(mailFolderName, folderName+".") {
+			// フォルダ名と一致(サブフォルダも考慮)
 			return true
 		}
 
@@ -159,3 +378,54 @@ func excludeFolder(mail Mail, excludeFolderNames []string) bool {
 
 	return false
 }
+
+func matchSize(mail Mail, minSize int64, maxSize int64) bool {
+
+	if minSize != 0 && mail.Size < minSize {
+		return false
+	}
+
+	if maxSize != 0 && mail.Size > maxSize {
+		return false
+	}
+
+	return true
+}
+
+func matchFlags(mail Mail, condition Condition) bool {
+
+	if condition.KeepFlagged && mail.Flags.Flagged {
+		return false
+	}
+
+	// 既読(S)が付いていないものが未読
+	if (condition.KeepUnread || condition.OnlySeen) && !mail.Flags.Seen {
+		return false
+	}
+
+	if condition.OnlyTrashed && !mail.Flags.Trashed {
+		return false
+	}
+
+	return true
+}
+
+func matchHeaders(mail Mail, headerFilters []*HeaderFilter) (bool, error) {
+
+	if len(headerFilters) == 0 {
+		return true, nil
+	}
+
+	header, err := ReadHeader(mail.FullPath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, headerFilter := range headerFilters {
+		if !headerFilter.Match(header) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -309,6 +311,307 @@ func TestCollector_ExcludeFolderNames(t *testing.T) {
 	assert.Equal(t, &expected, mails)
 }
 
+func TestCollector_Size(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	expected := []Mail{}
+
+	// INBOX
+	{
+		mailFolder := test.CreateMailFolder(t, temp, "")
+		test.CreateMailByTime(t, mailFolder, "new", test.AgoDays(t, 10), 9)  // 下限未満
+		test.CreateMailByTime(t, mailFolder, "new", test.AgoDays(t, 11), 21) // 上限超過
+		test.CreateMailByTime(t, mailFolder, "new", test.AgoDays(t, 1), 15)  // 経過日数未満
+		for i, size := range []int{10, 15, 20} {
+			// 収集対象
+			time := test.AgoDays(t, 20+i)
+			mailPath, fileName := test.CreateMailByTime(t, mailFolder, "cur", time, size)
+			expected = append(expected, Mail{
+				FullPath:   mailPath,
+				FolderName: "",
+				SubDirName: "cur",
+				FileName:   fileName,
+				Size:       int64(size),
+				Time:       time,
+			})
+		}
+	}
+
+	// ファイル名(Unix時間)でソートされるので、古いものから
+	expected[0], expected[2] = expected[2], expected[0]
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays: 2,
+		MinSize:   10,
+		MaxSize:   20,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &expected, mails)
+}
+
+func TestCollector_Flags(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	expected := []Mail{}
+
+	// INBOX
+	{
+		mailFolder := test.CreateMailFolder(t, temp, "")
+		test.CreateMailByName(t, mailFolder, "new", fmt.Sprintf("%d.a", test.AgoDays(t, 10).Unix()), 1)      // 未読
+		test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d.b:2,", test.AgoDays(t, 11).Unix()), 1)   // 未読
+		test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d.c:2,FS", test.AgoDays(t, 12).Unix()), 1) // フラグ付き
+		test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d.d:2,RST", test.AgoDays(t, 1).Unix()), 1) // 経過日数未満
+		{
+			// 収集対象
+			time := test.AgoDays(t, 13)
+			fileName := fmt.Sprintf("%d.e:2,RS", time.Unix())
+			mailPath, _ := test.CreateMailByName(t, mailFolder, "cur", fileName, 1)
+			expected = append(expected, Mail{
+				FullPath:   mailPath,
+				FolderName: "",
+				SubDirName: "cur",
+				FileName:   fileName,
+				Size:       1,
+				Time:       time,
+				Flags: Flags{
+					Replied: true,
+					Seen:    true,
+				},
+			})
+		}
+	}
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:   2,
+		KeepFlagged: true,
+		KeepUnread:  true,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &expected, mails)
+}
+
+func TestCollector_OnlyTrashed(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	expected := []Mail{}
+
+	// INBOX
+	{
+		mailFolder := test.CreateMailFolder(t, temp, "")
+		test.CreateMailByName(t, mailFolder, "new", fmt.Sprintf("%d.a", test.AgoDays(t, 10).Unix()), 1)
+		test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d.b:2,S", test.AgoDays(t, 11).Unix()), 1)
+		{
+			// 収集対象
+			time := test.AgoDays(t, 12)
+			fileName := fmt.Sprintf("%d.c:2,FT", time.Unix())
+			mailPath, _ := test.CreateMailByName(t, mailFolder, "cur", fileName, 1)
+			expected = append(expected, Mail{
+				FullPath:   mailPath,
+				FolderName: "",
+				SubDirName: "cur",
+				FileName:   fileName,
+				Size:       1,
+				Time:       time,
+				Flags: Flags{
+					Trashed: true,
+					Flagged: true,
+				},
+			})
+		}
+	}
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:   2,
+		OnlyTrashed: true,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &expected, mails)
+}
+
+func TestCollector_HeaderFilters(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	expected := []Mail{}
+
+	// INBOX
+	{
+		mailFolder := test.CreateMailFolder(t, temp, "")
+		{
+			// 収集対象
+			time := test.AgoDays(t, 10)
+			mailPath, fileName := test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d", time.Unix()), 0)
+			content := "From: News <news@example.com>\nSubject: =?UTF-8?B?44GK55+l44KJ44Gb?=\n\nbody"
+			test.CreateFile(t, mailPath, content)
+			expected = append(expected, Mail{
+				FullPath:   mailPath,
+				FolderName: "",
+				SubDirName: "cur",
+				FileName:   fileName,
+				Size:       int64(len(content)),
+				Time:       time,
+			})
+		}
+		{
+			// 対象外(Fromが一致しない)
+			mailPath, _ := test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d", test.AgoDays(t, 11).Unix()), 0)
+			test.CreateFile(t, mailPath, "From: info@example.com\nSubject: =?UTF-8?B?44GK55+l44KJ44Gb?=\n\nbody")
+		}
+		{
+			// 対象外(Subjectが一致しない)
+			mailPath, _ := test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d", test.AgoDays(t, 12).Unix()), 0)
+			test.CreateFile(t, mailPath, "From: news@example.com\nSubject: Hello\n\nbody")
+		}
+		{
+			// 対象外(経過日数未満)
+			mailPath, _ := test.CreateMailByName(t, mailFolder, "cur", fmt.Sprintf("%d", test.AgoDays(t, 1).Unix()), 0)
+			test.CreateFile(t, mailPath, "From: news@example.com\nSubject: =?UTF-8?B?44GK55+l44KJ44Gb?=\n\nbody")
+		}
+	}
+
+	fromFilter, err := NewGlobHeaderFilter("From", "news@*")
+	require.NoError(t, err)
+	subjectFilter, err := ParseHeaderFilter("Subject=~^お知らせ")
+	require.NoError(t, err)
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:     2,
+		HeaderFilters: []*HeaderFilter{fromFilter, subjectFilter},
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &expected, mails)
+}
+
+func TestCollector_MaxAge(t *testing.T) {
+
+	// ARRANGE
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:    10,
+		MaxAgeOfDays: 20,
+	})
+
+	// ACT
+	tooNew, err1 := collector.Match(Mail{Time: test.AgoDays(t, 9)})
+	inRange, err2 := collector.Match(Mail{Time: test.AgoDays(t, 15)})
+	tooOld, err3 := collector.Match(Mail{Time: test.AgoDays(t, 21)})
+
+	// ASSERT
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	require.NoError(t, err3)
+	assert.False(t, tooNew)
+	assert.True(t, inRange)
+	assert.False(t, tooOld)
+}
+
+func TestCollector_FolderNames(t *testing.T) {
+
+	// ARRANGE
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:          10,
+		FolderNames:        []string{"Archived"},
+		ExcludeFolderNames: []string{"Archived.B"},
+	})
+
+	// ACT
+	inbox, err1 := collector.Match(Mail{FolderName: "", Time: test.AgoDays(t, 11)})
+	archived, err2 := collector.Match(Mail{FolderName: "Archived", Time: test.AgoDays(t, 11)})
+	subFolder, err3 := collector.Match(Mail{FolderName: "Archived.A", Time: test.AgoDays(t, 11)})
+	excluded, err4 := collector.Match(Mail{FolderName: "Archived.B", Time: test.AgoDays(t, 11)})
+	similarName, err5 := collector.Match(Mail{FolderName: "Archived2", Time: test.AgoDays(t, 11)})
+
+	// ASSERT
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	require.NoError(t, err3)
+	require.NoError(t, err4)
+	require.NoError(t, err5)
+	assert.False(t, inbox)
+	assert.True(t, archived)
+	assert.True(t, subFolder) // サブフォルダも対象
+	assert.False(t, excluded)
+	assert.False(t, similarName)
+}
+
+func TestCollector_Location(t *testing.T) {
+
+	// ARRANGE
+	location, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	// Asia/Tokyoでの当日0時から10日前が境界
+	now := time.Now().In(location)
+	cutoffTime := time.Date(now.Year(), now.Month(), now.Day()-10, 0, 0, 0, 0, location)
+
+	collector := NewConditionCollector(Condition{
+		AgeOfDays: 10,
+		Location:  location,
+	})
+
+	// ACT
+	beforeCutoff, err1 := collector.Match(Mail{Time: cutoffTime.Add(-time.Second)})
+	atCutoff, err2 := collector.Match(Mail{Time: cutoffTime})
+
+	// ASSERT
+	require.NoError(t, err1)
+	require.NoError(t, err2)
+	assert.True(t, beforeCutoff)
+	assert.False(t, atCutoff)
+}
+
+func TestAgeCutoffTime(t *testing.T) {
+
+	// ARRANGE
+	now := time.Date(2024, 3, 10, 15, 4, 5, 0, time.UTC)
+
+	// ACT
+	cutoffTime := ageCutoffTime(now, 10, nil)
+
+	// ASSERT
+	// 現在日時から
+	assert.Equal(t, time.Date(2024, 2, 29, 15, 4, 5, 0, time.UTC), cutoffTime)
+}
+
+func TestAgeCutoffTime_Location(t *testing.T) {
+
+	// ARRANGE
+	location, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	// Asia/Tokyoでは既に3/11
+	now := time.Date(2024, 3, 10, 15, 4, 5, 0, time.UTC)
+
+	// ACT
+	cutoffTime := ageCutoffTime(now, 10, location)
+
+	// ASSERT
+	// Asia/Tokyoでの当日0時から
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, location), cutoffTime)
+}
+
 func TestCollector_TimeNotIncluded(t *testing.T) {
 
 	// ARRANGE
@@ -412,6 +715,50 @@ func TestCollector_InvalidFolderName(t *testing.T) {
 	assert.EqualError(t, err, "&A is invalid folder name: utf7: invalid UTF-7")
 }
 
+func TestCollector_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mailTime := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// INBOX
+	mailFolder := test.CreateMailFolder(t, temp, "")
+	mailPath := filepath.Join(mailFolder, "cur", "a")
+	test.CreateFile(t, mailPath, "Date: "+mailTime.Format(time.RFC1123Z)+"\r\n\r\nbody")
+
+	// 読み込めないメール(リンク先が無い)
+	brokenPath := filepath.Join(mailFolder, "cur", "b")
+	require.NoError(t, os.Symlink(filepath.Join(temp, "xx"), brokenPath))
+
+	// 読み込めないフォルダ(curがファイル)
+	brokenFolder := test.CreateDir(t, temp, ".A")
+	test.CreateFile(t, filepath.Join(brokenFolder, "cur"), "")
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:   1,
+		TimeSources: []TimeSource{TimeSourceDateHeader},
+		KeepGoing:   true,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 読み込めたものは収集されること
+	require.Equal(t, 1, len(*mails))
+	assert.Equal(t, mailPath, (*mails)[0].FullPath)
+	assert.Equal(t, mailTime, (*mails)[0].Time.UTC())
+
+	failures := collector.Failures()
+	require.Equal(t, 2, len(failures))
+	assert.Equal(t, "", failures[0].FolderName)
+	assert.Equal(t, brokenPath, failures[0].Path)
+	assert.Equal(t, "A", failures[1].FolderName)
+	assert.Equal(t, filepath.Join(brokenFolder, "cur"), failures[1].Path)
+}
+
 func TestCollector_RootFolderNotFound(t *testing.T) {
 
 	// ARRANGE
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 同じメールとみなされるもののまとまり
+type DuplicateGroup struct {
+	Key   string
+	Mails []Mail // 先頭が残すメール
+}
+
+func (g DuplicateGroup) Kept() Mail {
+	return g.Mails[0]
+}
+
+func (g DuplicateGroup) Duplicates() []Mail {
+	return g.Mails[1:]
+}
+
+type DuplicateGroups []DuplicateGroup
+
+// 渡されたメール全体(フォルダをまたいで)から、重複しているものをまとめる
+// 残すのは優先するフォルダ(指定順)にあるもの、その中で(無ければ全体で)最も古いもの
+// ゴミ箱にあるものは、他に無い場合を除いて残さない
+func (c *Collector) FindDuplicates(mails *[]Mail, preferredFolderNames []string, trashFolderName string) (DuplicateGroups, error) {
+
+	keys := []string{}
+	keyMails := map[string][]Mail{}
+
+	for _, mail := range *mails {
+		key, err := duplicateKey(mail.FullPath)
+		if err != nil {
+			if c.skip(mail.FolderName, mail.FullPath, err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if _, ok := keyMails[key]; !ok {
+			keys = append(keys, key)
+		}
+		keyMails[key] = append(keyMails[key], mail)
+	}
+
+	groups := DuplicateGroups{}
+	for _, key := range keys {
+		mails := keyMails[key]
+		if len(mails) < 2 {
+			continue
+		}
+
+		// 同じ条件の場合は元の並び(フォルダ名+ファイル名)で
+		sort.SliceStable(mails, func(i, j int) bool {
+			trashI := inTrash(mails[i], trashFolderName)
+			trashJ := inTrash(mails[j], trashFolderName)
+			if trashI != trashJ {
+				return !trashI
+			}
+			preferredI := preferredFolderIndex(mails[i], preferredFolderNames)
+			preferredJ := preferredFolderIndex(mails[j], preferredFolderNames)
+			if preferredI != preferredJ {
+				return preferredI < preferredJ
+			}
+			return mails[i].Time.Before(mails[j].Time)
+		})
+
+		groups = append(groups, DuplicateGroup{
+			Key:   key,
+			Mails: mails,
+		})
+	}
+
+	return groups, nil
+}
+
+// 残すもの以外のメール (フォルダ名+ファイル名でソート)
+func (g DuplicateGroups) DuplicateMails() *[]Mail {
+
+	duplicateMails := []Mail{}
+	for _, group := range g {
+		duplicateMails = append(duplicateMails, group.Duplicates()...)
+	}
+
+	sort.Slice(duplicateMails, func(i, j int) bool {
+		if duplicateMails[i].FolderName == duplicateMails[j].FolderName {
+			return duplicateMails[i].FileName < duplicateMails[j].FileName
+		}
+		return duplicateMails[i].FolderName < duplicateMails[j].FolderName
+	})
+
+	return &duplicateMails
+}
+
+func inTrash(mail Mail, trashFolderName string) bool {
+	return trashFolderName != "" && MatchFolder(mail.FolderName, []string{trashFolderName})
+}
+
+func preferredFolderIndex(mail Mail, preferredFolderNames []string) int {
+
+	for i, folderName := range preferredFolderNames {
+		if MatchFolder(mail.FolderName, []string{folderName}) {
+			return i
+		}
+	}
+
+	return len(preferredFolderNames)
+}
+
+// Message-IDが無い場合に比較するヘッダ
+var duplicateHeaderNames = []string{"Date", "From", "To", "Cc", "Subject"}
+
+func duplicateKey(path string) (string, error) {
+
+	header, err := ReadHeader(path)
+	if err != nil {
+		return "", err
+	}
+
+	// 配送毎に変わるヘッダ(Receivedなど)を除いた内容で
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	hash := "hash:" + normalizedHash(header, data)
+
+	// Message-IDが同じでも内容が異なるもの(Message-IDを使い回すメーラーなど)は別に
+	if ids := parseMessageIDs(header.Values("Message-Id")); len(ids) != 0 {
+		return "message-id:" + ids[0] + " " + hash, nil
+	}
+
+	return hash, nil
+}
+
+func normalizedHash(header Header, data []byte) string {
+
+	hash := sha256.New()
+
+	for _, name := range duplicateHeaderNames {
+		// 折り返しや空白の違いは無視
+		value := strings.Join(strings.Fields(strings.Join(header.Values(name), " ")), " ")
+		hash.Write([]byte(name + ": " + value + "\n"))
+	}
+	hash.Write([]byte("\n"))
+
+	// 本文は改行コードと末尾の空白の違いを無視
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	body := []byte{}
+	if index := bytes.Index(data, []byte("\n\n")); index != -1 {
+		body = data[index+2:]
+	}
+	hash.Write(bytes.TrimRight(body, " \t\n"))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
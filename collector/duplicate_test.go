@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicates(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	folderA := test.CreateMailFolder(t, temp, ".A")
+
+	createMail := func(folderDir string, name string, content string) string {
+		mailPath, _ := test.CreateMailByName(t, folderDir, "cur", name, 0)
+		test.CreateFile(t, mailPath, content)
+		return mailPath
+	}
+
+	// Message-IDが同じもの
+	id1 := createMail(inbox, "1", "Message-ID: <1@example.com>\r\nReceived: a\r\n\r\nbody")
+	id2 := createMail(folderA, "2", "Message-ID: <1@example.com>\r\nReceived: b\r\n\r\nbody")
+	id3 := createMail(folderA, "3", "Message-ID:  <1@example.com> \r\n\r\nbody")
+	// Message-IDが異なるもの
+	other := createMail(inbox, "4", "Message-ID: <2@example.com>\r\n\r\nbody")
+	// Message-IDが同じでも内容が異なるもの
+	otherBody := createMail(folderA, "8", "Message-ID: <1@example.com>\r\n\r\nother body")
+	// Message-IDが無いものは、ヘッダ(配送毎に変わるものを除く)と本文で
+	noID1 := createMail(inbox, "5", "Received: a\r\nSubject: Hello\r\n World\r\n\r\nbody\r\n")
+	noID2 := createMail(folderA, "6", "Received: b\nSubject: Hello World\n\nbody\n\n")
+	noIDOther := createMail(folderA, "7", "Subject: Hello World\n\nother body\n")
+
+	mails := []Mail{
+		{FullPath: id1, FolderName: "", FileName: "1", Time: time.Unix(300, 0)},
+		{FullPath: other, FolderName: "", FileName: "4", Time: time.Unix(100, 0)},
+		{FullPath: noID1, FolderName: "", FileName: "5", Time: time.Unix(200, 0)},
+		{FullPath: id2, FolderName: "A", FileName: "2", Time: time.Unix(100, 0)},
+		{FullPath: id3, FolderName: "A", FileName: "3", Time: time.Unix(100, 0)},
+		{FullPath: noID2, FolderName: "A", FileName: "6", Time: time.Unix(100, 0)},
+		{FullPath: noIDOther, FolderName: "A", FileName: "7", Time: time.Unix(100, 0)},
+		{FullPath: otherBody, FolderName: "A", FileName: "8", Time: time.Unix(50, 0)},
+	}
+
+	// ACT
+	groups, err := NewCollector(0).FindDuplicates(&mails, []string{}, "")
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Equal(t, 2, len(groups))
+
+	// 最も古いものを残す (同じ日時の場合は元の並び)
+	assert.True(t, strings.HasPrefix(groups[0].Key, "message-id:<1@example.com> hash:"))
+	assert.Equal(t, []Mail{mails[3], mails[4], mails[0]}, groups[0].Mails)
+	assert.Equal(t, mails[3], groups[0].Kept())
+
+	assert.Equal(t, []Mail{mails[5], mails[2]}, groups[1].Mails)
+
+	// 残すもの以外をフォルダ名+ファイル名で
+	assert.Equal(t, &[]Mail{mails[0], mails[2], mails[4]}, groups.DuplicateMails())
+}
+
+func TestFindDuplicates_PreferredFolder(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	folderAB := test.CreateMailFolder(t, temp, ".A.B")
+	folderC := test.CreateMailFolder(t, temp, ".C")
+
+	mailPaths := []string{}
+	for _, folderDir := range []string{inbox, folderAB, folderC} {
+		mailPath, _ := test.CreateMailByName(t, folderDir, "cur", "1", 0)
+		test.CreateFile(t, mailPath, "Message-ID: <1@example.com>\r\n\r\nbody")
+		mailPaths = append(mailPaths, mailPath)
+	}
+
+	mails := []Mail{
+		{FullPath: mailPaths[0], FolderName: "", FileName: "1", Time: time.Unix(100, 0)},
+		{FullPath: mailPaths[1], FolderName: "A.B", FileName: "1", Time: time.Unix(300, 0)},
+		{FullPath: mailPaths[2], FolderName: "C", FileName: "1", Time: time.Unix(200, 0)},
+	}
+
+	// ACT
+	// 指定順に優先 (サブフォルダも含む)
+	groups, err := NewCollector(0).FindDuplicates(&mails, []string{"X", "A", "C"}, "")
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, []Mail{mails[1], mails[2], mails[0]}, groups[0].Mails)
+}
+
+func TestFindDuplicates_Trash(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mailPaths := []string{}
+	for _, folderDir := range []string{
+		test.CreateMailFolder(t, temp, ".Trash"),
+		test.CreateMailFolder(t, temp, ".Trash.A"),
+		test.CreateMailFolder(t, temp, ".A"),
+	} {
+		mailPath, _ := test.CreateMailByName(t, folderDir, "cur", "1", 0)
+		test.CreateFile(t, mailPath, "Message-ID: <1@example.com>\r\n\r\nbody")
+		mailPaths = append(mailPaths, mailPath)
+	}
+
+	mails := []Mail{
+		{FullPath: mailPaths[0], FolderName: "Trash", FileName: "1", Time: time.Unix(100, 0)},
+		{FullPath: mailPaths[1], FolderName: "Trash.A", FileName: "1", Time: time.Unix(200, 0)},
+		{FullPath: mailPaths[2], FolderName: "A", FileName: "1", Time: time.Unix(300, 0)},
+	}
+
+	// ACT
+	// 優先するフォルダや日時よりも、ゴミ箱(サブフォルダも含む)に無いことを優先
+	groups, err := NewCollector(0).FindDuplicates(&mails, []string{"Trash"}, "Trash")
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, mails[2], groups[0].Kept())
+	assert.Equal(t, []Mail{mails[0], mails[1]}, groups[0].Duplicates())
+}
+
+func TestFindDuplicates_KeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	mailPath, _ := test.CreateMailByName(t, inbox, "cur", "1", 0)
+	test.CreateFile(t, mailPath, "Message-ID: <1@example.com>\r\n\r\nbody")
+
+	mails := []Mail{
+		{FullPath: mailPath, FileName: "1"},
+		{FullPath: mailPath + "_not_found", FileName: "2"},
+	}
+
+	collector := NewConditionCollector(Condition{KeepGoing: true})
+
+	// ACT
+	groups, err := collector.FindDuplicates(&mails, []string{}, "")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(groups))
+	require.Equal(t, 1, len(collector.Failures()))
+	assert.Equal(t, mailPath+"_not_found", collector.Failures()[0].Path)
+}
+
+func TestFindDuplicates_ReadError(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FullPath: "not_found"},
+	}
+
+	// ACT
+	_, err := NewCollector(0).FindDuplicates(&mails, []string{}, "")
+
+	// ASSERT
+	require.Error(t, err)
+}
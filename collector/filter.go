@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// メールアドレスを値として持つヘッダ
+var addressHeaderNames = map[string]bool{
+	"From":     true,
+	"To":       true,
+	"Cc":       true,
+	"Bcc":      true,
+	"Reply-To": true,
+	"Sender":   true,
+}
+
+type HeaderFilter struct {
+	Name    string
+	pattern *regexp.Regexp
+}
+
+func ParseHeaderFilter(value string) (*HeaderFilter, error) {
+	// "名前=glob" or "名前=~正規表現"
+	// 例: List-Id=*example.com*
+	//     List-Id=~^foo
+	index := strings.Index(value, "=")
+	if index <= 0 {
+		return nil, fmt.Errorf("invalid header filter '%s'", value)
+	}
+
+	name := strings.TrimSpace(value[:index])
+	pattern := value[index+1:]
+
+	if strings.HasPrefix(pattern, "~") {
+		return NewRegexpHeaderFilter(name, pattern[1:])
+	}
+	return NewGlobHeaderFilter(name, pattern)
+}
+
+func NewGlobHeaderFilter(name string, glob string) (*HeaderFilter, error) {
+
+	// globは全体一致で、大文字小文字は区別しない
+	var builder strings.Builder
+	builder.WriteString("(?is)^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	builder.WriteString("$")
+
+	return &HeaderFilter{
+		Name:    textproto.CanonicalMIMEHeaderKey(name),
+		pattern: regexp.MustCompile(builder.String()),
+	}, nil
+}
+
+func NewRegexpHeaderFilter(name string, expr string) (*HeaderFilter, error) {
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header filter pattern '%s': %w", expr, err)
+	}
+
+	return &HeaderFilter{
+		Name:    textproto.CanonicalMIMEHeaderKey(name),
+		pattern: pattern,
+	}, nil
+}
+
+func (f *HeaderFilter) Match(header Header) bool {
+
+	for _, value := range header.Values(f.Name) {
+
+		decodedValue := DecodeHeaderValue(value)
+		if f.pattern.MatchString(decodedValue) {
+			return true
+		}
+
+		if addressHeaderNames[f.Name] {
+			// アドレス部分のみでも判定
+			for _, address := range parseAddresses(value) {
+				if f.pattern.MatchString(address) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func parseAddresses(value string) []string {
+
+	parser := &mail.AddressParser{WordDecoder: wordDecoder}
+	addressList, err := parser.ParseList(value)
+	if err != nil {
+		return []string{}
+	}
+
+	addresses := []string{}
+	for _, address := range addressList {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeaderFilter_Glob(t *testing.T) {
+
+	// ACT
+	headerFilter, err := ParseHeaderFilter("list-id=*.example.com>")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "List-Id", headerFilter.Name)
+
+	assert.True(t, headerFilter.Match(Header{"List-Id": []string{"Foo <foo.example.com>"}}))
+	assert.True(t, headerFilter.Match(Header{"List-Id": []string{"FOO <FOO.EXAMPLE.COM>"}}))
+	assert.False(t, headerFilter.Match(Header{"List-Id": []string{"Foo <foo.example.com> x"}}))
+	assert.False(t, headerFilter.Match(Header{"List-Id": []string{"Foo <foo-example.com>"}}))
+	assert.False(t, headerFilter.Match(Header{"Subject": []string{"Foo <foo.example.com>"}}))
+}
+
+func TestParseHeaderFilter_Regexp(t *testing.T) {
+
+	// ACT
+	headerFilter, err := ParseHeaderFilter("List-Id=~foo\\.example")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "List-Id", headerFilter.Name)
+
+	assert.True(t, headerFilter.Match(Header{"List-Id": []string{"Foo <foo.example.com>"}}))
+	assert.False(t, headerFilter.Match(Header{"List-Id": []string{"Foo <foo-example.com>"}}))
+	assert.False(t, headerFilter.Match(Header{"List-Id": []string{"Foo <FOO.example.com>"}}))
+}
+
+func TestParseHeaderFilter_Invalid(t *testing.T) {
+
+	// ACT
+	_, err := ParseHeaderFilter("List-Id")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid header filter 'List-Id'")
+}
+
+func TestParseHeaderFilter_InvalidRegexp(t *testing.T) {
+
+	// ACT
+	_, err := ParseHeaderFilter("List-Id=~(a")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid header filter pattern '(a': error parsing regexp: missing closing ): `(a`")
+}
+
+func TestHeaderFilter_Address(t *testing.T) {
+
+	// ARRANGE
+	headerFilter, err := NewGlobHeaderFilter("from", "noreply@*")
+	require.NoError(t, err)
+
+	// ACT & ASSERT
+	assert.True(t, headerFilter.Match(Header{"From": []string{"Service <noreply@example.com>"}}))
+	assert.True(t, headerFilter.Match(Header{"From": []string{"noreply@example.com"}}))
+	assert.True(t, headerFilter.Match(Header{"From": []string{"=?UTF-8?B?44GK55+l44KJ44Gb?= <noreply@example.com>"}}))
+	assert.False(t, headerFilter.Match(Header{"From": []string{"Service <info@example.com>"}}))
+}
+
+func TestHeaderFilter_MultipleValues(t *testing.T) {
+
+	// ARRANGE
+	headerFilter, err := NewGlobHeaderFilter("To", "b@example.com")
+	require.NoError(t, err)
+
+	// ACT & ASSERT
+	assert.True(t, headerFilter.Match(Header{"To": []string{"a@example.com, B <b@example.com>"}}))
+	assert.True(t, headerFilter.Match(Header{"To": []string{"a@example.com", "b@example.com"}}))
+	assert.False(t, headerFilter.Match(Header{"To": []string{"a@example.com", "c@example.com"}}))
+}
+
+func TestHeaderFilter_EncodedWord(t *testing.T) {
+
+	// ARRANGE
+	headerFilter, err := NewGlobHeaderFilter("Subject", "*テスト*")
+	require.NoError(t, err)
+
+	// ACT & ASSERT
+	assert.True(t, headerFilter.Match(Header{"Subject": []string{"[info] =?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?= mail"}}))
+	assert.True(t, headerFilter.Match(Header{"Subject": []string{"=?utf-8?q?=E3=83=86=E3=82=B9=E3=83=88?="}}))
+	assert.False(t, headerFilter.Match(Header{"Subject": []string{"=?UTF-8?B?44GK55+l44KJ44Gb?="}}))
+}
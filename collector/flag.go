@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+)
+
+type Flags struct {
+	Passed  bool // P
+	Replied bool // R
+	Seen    bool // S
+	Trashed bool // T
+	Draft   bool // D
+	Flagged bool // F
+}
+
+func MailFlags(fileName string) Flags {
+	// ファイル名の":2,"以降がフラグ
+	// 例: 1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,FS
+	//     -> F(Flagged)とS(Seen)
+	index := strings.LastIndex(fileName, ":2,")
+	if index == -1 {
+		return Flags{}
+	}
+
+	flags := Flags{}
+	for _, flag := range fileName[index+3:] {
+		switch flag {
+		case 'P':
+			flags.Passed = true
+		case 'R':
+			flags.Replied = true
+		case 'S':
+			flags.Seen = true
+		case 'T':
+			flags.Trashed = true
+		case 'D':
+			flags.Draft = true
+		case 'F':
+			flags.Flagged = true
+		}
+	}
+
+	return flags
+}
+
+func AddMailFlag(fileName string, flag rune) string {
+	// フラグはASCII順に並べる必要がある
+	index := strings.LastIndex(fileName, ":2,")
+	if index == -1 {
+		return fileName + ":2," + string(flag)
+	}
+
+	flags := fileName[index+3:]
+	if strings.ContainsRune(flags, flag) {
+		return fileName
+	}
+
+	sortedFlags := []rune(flags + string(flag))
+	sort.Slice(sortedFlags, func(i, j int) bool {
+		return sortedFlags[i] < sortedFlags[j]
+	})
+
+	return fileName[:index+3] + string(sortedFlags)
+}
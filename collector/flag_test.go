@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMailFlags(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,DFPRST"
+
+	// ACT
+	flags := MailFlags(fileName)
+
+	// ASSERT
+	assert.Equal(t, Flags{
+		Passed:  true,
+		Replied: true,
+		Seen:    true,
+		Trashed: true,
+		Draft:   true,
+		Flagged: true,
+	}, flags)
+}
+
+func TestMailFlags_Part(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,FSa"
+
+	// ACT
+	flags := MailFlags(fileName)
+
+	// ASSERT
+	assert.Equal(t, Flags{
+		Seen:    true,
+		Flagged: true,
+	}, flags)
+}
+
+func TestMailFlags_Empty(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,"
+
+	// ACT
+	flags := MailFlags(fileName)
+
+	// ASSERT
+	assert.Equal(t, Flags{}, flags)
+}
+
+func TestMailFlags_NoInfo(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.M958571P8888.localhost.localdomain,S=545,W=562"
+
+	// ACT
+	flags := MailFlags(fileName)
+
+	// ASSERT
+	assert.Equal(t, Flags{}, flags)
+}
+
+func TestAddMailFlag(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,FS"
+
+	// ACT
+	added := AddMailFlag(fileName, 'T')
+
+	// ASSERT
+	assert.Equal(t, "1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,FST", added)
+}
+
+func TestAddMailFlag_Sort(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.localhost:2,ST"
+
+	// ACT
+	added := AddMailFlag(fileName, 'F')
+
+	// ASSERT
+	assert.Equal(t, "1674617693.localhost:2,FST", added)
+}
+
+func TestAddMailFlag_AlreadyExists(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.localhost:2,ST"
+
+	// ACT
+	added := AddMailFlag(fileName, 'T')
+
+	// ASSERT
+	assert.Equal(t, fileName, added)
+}
+
+func TestAddMailFlag_NoInfo(t *testing.T) {
+
+	// ARRANGE
+	fileName := "1674617693.localhost"
+
+	// ACT
+	added := AddMailFlag(fileName, 'T')
+
+	// ASSERT
+	assert.Equal(t, "1674617693.localhost:2,T", added)
+}
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ヘッダ部分が異常に大きい(空行が無い)ものは途中で打ち切る
+const maxHeaderSize = 1024 * 1024
+
+type Header map[string][]string
+
+func (h Header) Get(name string) string {
+	values := h[textproto.CanonicalMIMEHeaderKey(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (h Header) Values(name string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+func ReadHeader(path string) (Header, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseHeader(file)
+}
+
+func ParseHeader(r io.Reader) (Header, error) {
+
+	// ヘッダ部分(最初の空行まで)のみ読み込む
+	reader := bufio.NewReader(io.LimitReader(r, maxHeaderSize))
+	header := Header{}
+
+	lastName := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		trimmedLine := strings.TrimRight(line, "\r\n")
+		if trimmedLine == "" {
+			// 空行(ヘッダの終わり) or 終端
+			break
+		}
+
+		if (trimmedLine[0] == ' ' || trimmedLine[0] == '\t') && lastName != "" {
+			// 折り返された行なので、直前のヘッダの値に連結
+			values := header[lastName]
+			values[len(values)-1] += " " + strings.TrimLeft(trimmedLine, " \t")
+		} else if index := strings.Index(trimmedLine, ":"); index > 0 {
+			name := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(trimmedLine[:index]))
+			value := strings.TrimSpace(trimmedLine[index+1:])
+			header[name] = append(header[name], value)
+			lastName = name
+		}
+		// それ以外の不正な行は無視
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return header, nil
+}
+
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		// UTF-8, ISO-8859-1, US-ASCII 以外(ISO-2022-JPなど)
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported charset: %s", charset)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	},
+}
+
+func DecodeHeaderValue(value string) string {
+	// MIMEエンコードされた部分(=?ISO-2022-JP?B?...?=など)をデコード
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		// デコードできない場合は元の値のまま
+		return value
+	}
+	return decoded
+}
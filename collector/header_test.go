@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeader(t *testing.T) {
+
+	// ARRANGE
+	mail := "Return-Path: <a@example.com>\r\n" +
+		"Received: from mx.example.com\r\n" +
+		"\tby mail.example.com; Wed, 25 Jan 2023 12:34:56 +0900\r\n" +
+		"Received: from localhost; Wed, 25 Jan 2023 12:34:50 +0900\r\n" +
+		"subject: Hello\r\n" +
+		" World\r\n" +
+		"invalid line\r\n" +
+		"\r\n" +
+		"From: body@example.com\r\n"
+
+	// ACT
+	header, err := ParseHeader(strings.NewReader(mail))
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, Header{
+		"Return-Path": []string{"<a@example.com>"},
+		"Received": []string{
+			"from mx.example.com by mail.example.com; Wed, 25 Jan 2023 12:34:56 +0900",
+			"from localhost; Wed, 25 Jan 2023 12:34:50 +0900",
+		},
+		"Subject": []string{"Hello World"},
+	}, header)
+	assert.Equal(t, "Hello World", header.Get("SUBJECT"))
+	assert.Equal(t, "", header.Get("From"))
+	assert.Len(t, header.Values("received"), 2)
+}
+
+func TestParseHeader_NoBody(t *testing.T) {
+
+	// ARRANGE
+	mail := "Subject: a\nFrom: b@example.com"
+
+	// ACT
+	header, err := ParseHeader(strings.NewReader(mail))
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, Header{
+		"Subject": []string{"a"},
+		"From":    []string{"b@example.com"},
+	}, header)
+}
+
+func TestReadHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "mail")
+	test.CreateFile(t, mailPath, "Subject: a\n\nbody\n")
+
+	// ACT
+	header, err := ReadHeader(mailPath)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "a", header.Get("Subject"))
+}
+
+func TestReadHeader_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "mail")
+
+	// ACT
+	_, err := ReadHeader(mailPath)
+
+	// ASSERT
+	require.Error(t, err)
+	// OSによってエラーメッセージが異なるのでファイル名部分だけチェック
+	expect := "open " + mailPath
+	assert.Contains(t, err.Error(), expect)
+}
+
+func TestDecodeHeaderValue(t *testing.T) {
+
+	assert.Equal(t, "テスト", DecodeHeaderValue("=?ISO-2022-JP?B?GyRCJUYlOSVIGyhC?="))
+	assert.Equal(t, "お知らせ: テスト", DecodeHeaderValue("=?UTF-8?B?44GK55+l44KJ44Gb?=: =?iso-2022-jp?B?GyRCJUYlOSVIGyhC?="))
+	assert.Equal(t, "plain", DecodeHeaderValue("plain"))
+	// デコードできない場合はそのまま
+	assert.Equal(t, "=?X-UNKNOWN?B?44GK?=", DecodeHeaderValue("=?X-UNKNOWN?B?44GK?="))
+}
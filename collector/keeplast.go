@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"sort"
+)
+
+// フォルダ毎に、新しいものから残す件数
+type KeepLast struct {
+	Count        int            // 全てのフォルダ (0の場合は指定無し)
+	FolderCounts map[string]int // フォルダ毎 (サブフォルダも含む、Countより優先)
+}
+
+func (k KeepLast) count(mailFolderName string) int {
+
+	// 複数一致する場合は、より深いフォルダの指定を優先
+	count := k.Count
+	matchedFolderName := ""
+	matched := false
+	for folderName, folderCount := range k.FolderCounts {
+		if !MatchFolder(mailFolderName, []string{folderName}) {
+			continue
+		}
+
+		if !matched || len(folderName) > len(matchedFolderName) {
+			count = folderCount
+			matchedFolderName = folderName
+			matched = true
+		}
+	}
+
+	return count
+}
+
+// 指定件数分の残すメール(フルパス)
+// (渡されたメール全体の中で、フォルダ毎に新しいものから)
+func (c *Collector) KeptMails(mails *[]Mail) map[string]bool {
+
+	keptMails := map[string]bool{}
+	if c.keepLast.Count == 0 && len(c.keepLast.FolderCounts) == 0 {
+		return keptMails
+	}
+
+	folderMails := map[string][]Mail{}
+	for _, mail := range *mails {
+		folderMails[mail.FolderName] = append(folderMails[mail.FolderName], mail)
+	}
+
+	for folderName, mails := range folderMails {
+		count := c.keepLast.count(folderName)
+		if count == 0 {
+			continue
+		}
+
+		// 新しいものから (同じ日時の場合はファイル名の順で、順番が必ず同じになるように)
+		sort.Slice(mails, func(i, j int) bool {
+			if mails[i].Time.Equal(mails[j].Time) {
+				return mails[i].FileName > mails[j].FileName
+			}
+			return mails[i].Time.After(mails[j].Time)
+		})
+
+		for i := 0; i < count && i < len(mails); i++ {
+			keptMails[mails[i].FullPath] = true
+		}
+	}
+
+	return keptMails
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_KeepLast(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	inboxMails := []string{}
+	for _, days := range []int{50, 40, 30, 20, 5} {
+		mailPath, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, days), 1)
+		inboxMails = append(inboxMails, mailPath)
+	}
+
+	sent := test.CreateMailFolder(t, temp, ".Sent")
+	sentMails := []string{}
+	for _, days := range []int{50, 40, 30} {
+		mailPath, _ := test.CreateMailByTime(t, sent, "new", test.AgoDays(t, days), 1)
+		sentMails = append(sentMails, mailPath)
+	}
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays: 10,
+		KeepLast:  KeepLast{Count: 2},
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// フォルダ毎に新しいものから2件は残す (経過日数未満のものも数える)
+	assert.Equal(t, []string{inboxMails[0], inboxMails[1], inboxMails[2], sentMails[0]}, fullPaths(mails))
+}
+
+func TestCollector_KeepLastFolder(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	inboxMails := []string{}
+	for _, days := range []int{30, 20} {
+		mailPath, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, days), 1)
+		inboxMails = append(inboxMails, mailPath)
+	}
+
+	sent := test.CreateMailFolder(t, temp, ".Sent")
+	sentMails := []string{}
+	for _, days := range []int{30, 20} {
+		mailPath, _ := test.CreateMailByTime(t, sent, "cur", test.AgoDays(t, days), 1)
+		sentMails = append(sentMails, mailPath)
+	}
+
+	sentSub := test.CreateMailFolder(t, temp, ".Sent.2023")
+	sentSubMails := []string{}
+	for _, days := range []int{30, 20} {
+		mailPath, _ := test.CreateMailByTime(t, sentSub, "cur", test.AgoDays(t, days), 1)
+		sentSubMails = append(sentSubMails, mailPath)
+	}
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays: 10,
+		KeepLast: KeepLast{
+			Count: 2,
+			FolderCounts: map[string]int{
+				"Sent":      1, // サブフォルダも
+				"Sent.2023": 0, // より深いフォルダの指定を優先
+			},
+		},
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []string{sentMails[0], sentSubMails[0], sentSubMails[1]}, fullPaths(mails))
+}
+
+func TestCollector_KeptMails(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FullPath: "a", FileName: "a", FolderName: "", Time: time.Unix(100, 0)},
+		{FullPath: "b", FileName: "b", FolderName: "", Time: time.Unix(300, 0)},
+		{FullPath: "c", FileName: "c", FolderName: "", Time: time.Unix(200, 0)},
+		{FullPath: "d", FileName: "d", FolderName: "A", Time: time.Unix(100, 0)},
+		{FullPath: "e", FileName: "e", FolderName: "A", Time: time.Unix(100, 0)}, // 同じ日時はファイル名の順
+	}
+	collector := NewConditionCollector(Condition{KeepLast: KeepLast{Count: 1, FolderCounts: map[string]int{"": 2}}})
+
+	// ACT
+	keptMails := collector.KeptMails(&mails)
+
+	// ASSERT
+	assert.Equal(t, map[string]bool{"b": true, "c": true, "e": true}, keptMails)
+}
+
+func fullPaths(mails *[]Mail) []string {
+
+	paths := []string{}
+	for _, mail := range *mails {
+		paths = append(paths, mail.FullPath)
+	}
+	return paths
+}
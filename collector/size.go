@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 目標サイズまで減らす際に、メールを選ぶ順番
+type TargetSizeOrder string
+
+const (
+	TargetSizeOrderOldest  TargetSizeOrder = "oldest"  // 古いものから
+	TargetSizeOrderLargest TargetSizeOrder = "largest" // サイズが大きいものから
+)
+
+func ParseTargetSizeOrder(value string) (TargetSizeOrder, error) {
+
+	switch order := TargetSizeOrder(value); order {
+	case TargetSizeOrderOldest, TargetSizeOrderLargest:
+		return order, nil
+	default:
+		return "", fmt.Errorf("invalid target-order '%s'", value)
+	}
+}
+
+// メールボックスのサイズ(全てのフォルダのメールの合計)
+func MailboxSize(rootMailFolderPath string, keepGoing bool) (int64, error) {
+
+	// 対象外のフォルダもディスクやクォータを使っているので含める
+	// 読み込めなかったものは、対象メールの収集時にエラーとして記録されるので、ここでは数えないだけ
+	mails, err := CollectAll(rootMailFolderPath, []string{}, keepGoing)
+	if err != nil {
+		return 0, err
+	}
+
+	return TotalSize(mails), nil
+}
+
+// 経過日などの条件に関わらず、対象外のフォルダ以外の全てのメールを収集
+func CollectAll(rootMailFolderPath string, excludeFolderNames []string, keepGoing bool) (*[]Mail, error) {
+
+	collector := &Collector{
+		timeSources: []TimeSource{TimeSourceFileName},
+		keepGoing:   keepGoing,
+		target: func(mail Mail) (bool, error) {
+			return !excludeFolder(mail, excludeFolderNames), nil
+		},
+	}
+
+	return collector.Collect(rootMailFolderPath)
+}
+
+func TotalSize(mails *[]Mail) int64 {
+
+	totalSize := int64(0)
+	for _, mail := range *mails {
+		totalSize += mail.Size
+	}
+
+	return totalSize
+}
+
+// 残りのサイズが目標サイズ以下となるまで、指定の順番でメールを選ぶ
+// (対象のメールを全て選んでも届かない場合は全て)
+func SelectByTargetSize(mails *[]Mail, mailboxSize int64, targetSize int64, order TargetSizeOrder) *[]Mail {
+
+	indexes := make([]int, len(*mails))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	switch order {
+	case TargetSizeOrderOldest:
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return (*mails)[indexes[i]].Time.Before((*mails)[indexes[j]].Time)
+		})
+	case TargetSizeOrderLargest:
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return (*mails)[indexes[i]].Size > (*mails)[indexes[j]].Size
+		})
+	}
+
+	selected := make([]bool, len(*mails))
+	remainingSize := mailboxSize
+	for _, index := range indexes {
+		if remainingSize <= targetSize {
+			break
+		}
+
+		selected[index] = true
+		remainingSize -= (*mails)[index].Size
+	}
+
+	// 選んだものは元の並び(フォルダ名+ファイル名)で返す
+	selectedMails := []Mail{}
+	for i, mail := range *mails {
+		if selected[i] {
+			selectedMails = append(selectedMails, mail)
+		}
+	}
+
+	return &selectedMails
+}
@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailboxSize(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	test.CreateMailByTime(t, inbox, "new", test.AgoDays(t, 1), 10)
+	test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 100), 20)
+	test.CreateMailByTime(t, inbox, "tmp", test.AgoDays(t, 1), 1000) // 配送中のものは含めない
+	test.CreateMailByName(t, inbox, "cur", "unknown", 30)            // 日時が分からないものも含める
+
+	folderA := test.CreateMailFolder(t, temp, ".A")
+	test.CreateMailByTime(t, folderA, "cur", test.AgoDays(t, 1), 40)
+
+	// アーカイブフォルダなども含める
+	archived := test.CreateMailFolder(t, temp, ".Archived")
+	test.CreateMailByTime(t, archived, "cur", test.AgoDays(t, 1), 500)
+	archivedSub := test.CreateMailFolder(t, temp, ".Archived.2023")
+	test.CreateMailByTime(t, archivedSub, "cur", test.AgoDays(t, 1), 500)
+
+	// ACT
+	size, err := MailboxSize(temp, false)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, int64(1100), size)
+}
+
+func TestMailboxSize_RootFolderNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	_, err := MailboxSize(temp, false)
+
+	// ASSERT
+	require.Error(t, err)
+}
+
+func TestSelectByTargetSize_Oldest(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FileName: "a", FolderName: "", Size: 10, Time: time.Unix(300, 0)},
+		{FileName: "b", FolderName: "", Size: 30, Time: time.Unix(100, 0)},
+		{FileName: "c", FolderName: "A", Size: 20, Time: time.Unix(200, 0)},
+		{FileName: "d", FolderName: "A", Size: 40, Time: time.Unix(400, 0)},
+	}
+
+	// ACT
+	// 150 -> 100 以下になるまで古いものから (b:30, c:20)
+	selected := SelectByTargetSize(&mails, 150, 100, TargetSizeOrderOldest)
+
+	// ASSERT
+	// 元の並びで
+	assert.Equal(t, &[]Mail{mails[1], mails[2]}, selected)
+}
+
+func TestSelectByTargetSize_Largest(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FileName: "a", FolderName: "", Size: 10, Time: time.Unix(300, 0)},
+		{FileName: "b", FolderName: "", Size: 30, Time: time.Unix(100, 0)},
+		{FileName: "c", FolderName: "A", Size: 20, Time: time.Unix(200, 0)},
+		{FileName: "d", FolderName: "A", Size: 40, Time: time.Unix(400, 0)},
+	}
+
+	// ACT
+	// 150 -> 100 以下になるまで大きいものから (d:40, b:30)
+	selected := SelectByTargetSize(&mails, 150, 100, TargetSizeOrderLargest)
+
+	// ASSERT
+	assert.Equal(t, &[]Mail{mails[1], mails[3]}, selected)
+}
+
+func TestSelectByTargetSize_AlreadyUnderTarget(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FileName: "a", Size: 10, Time: time.Unix(100, 0)},
+	}
+
+	// ACT
+	selected := SelectByTargetSize(&mails, 100, 100, TargetSizeOrderOldest)
+
+	// ASSERT
+	assert.Equal(t, &[]Mail{}, selected)
+}
+
+func TestSelectByTargetSize_NotEnough(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FileName: "a", Size: 10, Time: time.Unix(200, 0)},
+		{FileName: "b", Size: 20, Time: time.Unix(100, 0)},
+	}
+
+	// ACT
+	// 対象のメールを全て選んでも届かない
+	selected := SelectByTargetSize(&mails, 1000, 100, TargetSizeOrderOldest)
+
+	// ASSERT
+	assert.Equal(t, &mails, selected)
+}
+
+func TestParseTargetSizeOrder(t *testing.T) {
+
+	// ARRANGE, ACT
+	oldest, err1 := ParseTargetSizeOrder("oldest")
+	largest, err2 := ParseTargetSizeOrder("largest")
+	_, err3 := ParseTargetSizeOrder("newest")
+
+	// ASSERT
+	require.NoError(t, err1)
+	assert.Equal(t, TargetSizeOrderOldest, oldest)
+	require.NoError(t, err2)
+	assert.Equal(t, TargetSizeOrderLargest, largest)
+	assert.EqualError(t, err3, "invalid target-order 'newest'")
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Message-ID, In-Reply-To, References で繋がるメールのまとまり
+type Threads struct {
+	ids    map[string]string    // メールのフルパス -> スレッドID
+	newest map[string]time.Time // スレッドID -> スレッド内で最も新しいメールの日時
+	counts map[string]int       // スレッドID -> スレッド内のメール数
+	errs   map[string]error     // メールのフルパス -> ヘッダを読み込めなかった際のエラー
+}
+
+// 渡されたメール全体(フォルダをまたいで)からスレッドを組み立てる
+// ヘッダを読み込めなかったものは単独のスレッドとし、エラーは対象のメールを判定する際に (MatchThread)
+func BuildThreads(mails *[]Mail) *Threads {
+
+	parents := unionFind{}
+	mailKeys := map[string]string{}
+	errs := map[string]error{}
+
+	for _, mail := range *mails {
+		// Message-IDが無いものは、そのメール単独で
+		key := "file:" + mail.FullPath
+		mailKeys[mail.FullPath] = key
+
+		header, err := ReadHeader(mail.FullPath)
+		if err != nil {
+			errs[mail.FullPath] = err
+			continue
+		}
+
+		if ids := parseMessageIDs(header.Values("Message-Id")); len(ids) != 0 {
+			key = ids[0]
+			mailKeys[mail.FullPath] = key
+		}
+
+		// 返信元や参照しているメールと同じスレッドに
+		// (参照先のメールが存在しなくても、同じものを参照しているメール同士は繋がる)
+		for _, name := range []string{"In-Reply-To", "References"} {
+			for _, id := range parseMessageIDs(header.Values(name)) {
+				parents.union(key, id)
+			}
+		}
+	}
+
+	threads := &Threads{
+		ids:    map[string]string{},
+		newest: map[string]time.Time{},
+		counts: map[string]int{},
+		errs:   errs,
+	}
+
+	for _, mail := range *mails {
+		id := parents.find(mailKeys[mail.FullPath])
+		threads.ids[mail.FullPath] = id
+		threads.counts[id]++
+
+		// 日時が取れなかったもの(=0)は含めない
+		if mail.Time.Unix() != 0 && mail.Time.After(threads.newest[id]) {
+			threads.newest[id] = mail.Time
+		}
+	}
+
+	return threads
+}
+
+func (t *Threads) ID(mail Mail) string {
+	return t.ids[mail.FullPath]
+}
+
+// スレッド内で最も新しいメールの日時
+func (t *Threads) Newest(mail Mail) time.Time {
+	return t.newest[t.ID(mail)]
+}
+
+// ヘッダを読み込めずにスレッドが分からなかった場合のエラー
+func (t *Threads) Err(mail Mail) error {
+	return t.errs[mail.FullPath]
+}
+
+// スレッド内のメール数
+func (t *Threads) MailCount(mail Mail) int {
+	return t.counts[t.ID(mail)]
+}
+
+// 渡されたメールが含まれるスレッドの数
+func (t *Threads) Count(mails *[]Mail) int {
+
+	ids := map[string]bool{}
+	for _, mail := range *mails {
+		ids[t.ID(mail)] = true
+	}
+
+	return len(ids)
+}
+
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+func parseMessageIDs(values []string) []string {
+
+	ids := []string{}
+	for _, value := range values {
+		found := messageIDPattern.FindAllString(value, -1)
+		if len(found) == 0 {
+			// <>で囲まれていない不正なものは、空白区切りでそのまま
+			found = strings.Fields(value)
+		}
+		ids = append(ids, found...)
+	}
+
+	return ids
+}
+
+// 繋がっているもの同士を同じ代表(ルート)にまとめる
+type unionFind map[string]string
+
+func (u unionFind) find(key string) string {
+
+	root := key
+	for {
+		parent, ok := u[root]
+		if !ok || parent == root {
+			break
+		}
+		root = parent
+	}
+
+	// 次回以降すぐにたどれるように、ルートに直接繋ぎ直す
+	for key != root {
+		next := u[key]
+		u[key] = root
+		key = next
+	}
+
+	return root
+}
+
+func (u unionFind) union(a string, b string) {
+
+	rootA := u.find(a)
+	rootB := u.find(b)
+	if rootA == rootB {
+		return
+	}
+
+	// 順番によって代表が変わらないように、小さい方を代表に
+	if rootA < rootB {
+		u[rootB] = rootA
+	} else {
+		u[rootA] = rootB
+	}
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_ThreadAware(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	sent := test.CreateMailFolder(t, temp, ".Sent")
+	archived := test.CreateMailFolder(t, temp, ".Archived")
+
+	// スレッド1: 返信がSentにあり、経過日数未満
+	thread1Mail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 50), 0)
+	test.CreateFile(t, thread1Mail, "Message-ID: <1@example.com>\r\nSubject: thread1\r\n\r\nbody")
+	thread1Reply, _ := test.CreateMailByTime(t, sent, "cur", test.AgoDays(t, 5), 0)
+	test.CreateFile(t, thread1Reply, "Message-ID: <1-1@example.com>\r\nIn-Reply-To: <1@example.com>\r\n\r\nbody")
+
+	// スレッド2: 全て経過日数を過ぎている (Referencesで繋がる)
+	thread2Mail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 40), 0)
+	test.CreateFile(t, thread2Mail, "Message-ID: <2@example.com>\r\n\r\nbody")
+	thread2Reply, _ := test.CreateMailByTime(t, sent, "cur", test.AgoDays(t, 30), 0)
+	test.CreateFile(t, thread2Reply, "Message-ID: <2-1@example.com>\r\nReferences: <2@example.com>\r\n\r\nbody")
+
+	// スレッド3: 新しい返信は対象外のフォルダにあっても考慮
+	// (参照先のメールが無くても、同じものを参照していれば同じスレッド)
+	thread3Mail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 30), 0)
+	test.CreateFile(t, thread3Mail, "Message-ID: <3-1@example.com>\r\nReferences: <3@example.com>\r\n\r\nbody")
+	thread3Reply, _ := test.CreateMailByTime(t, archived, "cur", test.AgoDays(t, 1), 0)
+	test.CreateFile(t, thread3Reply, "Message-ID: <3-2@example.com>\r\nReferences: <3@example.com>\r\n <3-1@example.com>\r\n\r\nbody")
+
+	// Message-IDが無いものは単独
+	noIDMail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 20), 0)
+	test.CreateFile(t, noIDMail, "Subject: no id\r\n\r\nbody")
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:          10,
+		ExcludeFolderNames: []string{"Archived"},
+		ThreadAware:        true,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// スレッド内で最も新しいメールが経過日数を過ぎているもののみ
+	assert.ElementsMatch(t, []string{thread2Mail, noIDMail, thread2Reply}, fullPaths(mails))
+
+	threads := collector.Threads()
+	require.NotNil(t, threads)
+	assert.Equal(t, 2, threads.Count(mails))
+
+	for _, mail := range *mails {
+		switch mail.FullPath {
+		case thread2Mail, thread2Reply:
+			assert.Equal(t, 2, threads.MailCount(mail))
+		case noIDMail:
+			assert.Equal(t, 1, threads.MailCount(mail))
+		}
+	}
+}
+
+func TestCollector_ThreadAwareDisabled(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	oldMail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 50), 0)
+	test.CreateFile(t, oldMail, "Message-ID: <1@example.com>\r\n\r\nbody")
+	newMail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 5), 0)
+	test.CreateFile(t, newMail, "Message-ID: <1-1@example.com>\r\nIn-Reply-To: <1@example.com>\r\n\r\nbody")
+
+	// ACT
+	collector := NewConditionCollector(Condition{
+		AgeOfDays: 10,
+	})
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 指定しない場合はスレッドを考慮しない
+	assert.Equal(t, []string{oldMail}, fullPaths(mails))
+	assert.Nil(t, collector.Threads())
+}
+
+func TestBuildThreads(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	paths := []string{}
+	for i, content := range []string{
+		"Message-ID: <a@example.com>\r\n\r\nbody",
+		"Message-ID: <b@example.com>\r\nIn-Reply-To: Re: <a@example.com> (comment)\r\n\r\nbody",
+		"Message-ID: <c@example.com>\r\nReferences: <b@example.com>\r\n\r\nbody",
+		"Message-ID: <d@example.com>\r\n\r\nbody",
+		"Message-ID: e@example.com\r\n\r\nbody", // <>で囲まれていない
+		"Message-ID: <f@example.com>\r\nIn-Reply-To: e@example.com\r\n\r\nbody",
+	} {
+		mailPath, _ := test.CreateMailByName(t, inbox, "cur", fmt.Sprintf("mail%d", i), 0)
+		test.CreateFile(t, mailPath, content)
+		paths = append(paths, mailPath)
+	}
+
+	mails := []Mail{
+		{FullPath: paths[0], Time: time.Unix(100, 0)},
+		{FullPath: paths[1], Time: time.Unix(300, 0)},
+		{FullPath: paths[2], Time: time.Unix(200, 0)},
+		{FullPath: paths[3], Time: time.Unix(400, 0)},
+		{FullPath: paths[4], Time: time.Unix(500, 0)},
+		{FullPath: paths[5], Time: time.Unix(0, 0)}, // 日時が取れなかったもの
+	}
+
+	// ACT
+	threads := BuildThreads(&mails)
+
+	// ASSERT
+	assert.Equal(t, 3, threads.Count(&mails))
+
+	assert.Equal(t, threads.ID(mails[0]), threads.ID(mails[1]))
+	assert.Equal(t, threads.ID(mails[0]), threads.ID(mails[2]))
+	assert.NotEqual(t, threads.ID(mails[0]), threads.ID(mails[3]))
+	assert.Equal(t, threads.ID(mails[4]), threads.ID(mails[5]))
+
+	assert.Equal(t, time.Unix(300, 0), threads.Newest(mails[0]))
+	assert.Equal(t, 3, threads.MailCount(mails[2]))
+	assert.Equal(t, time.Unix(400, 0), threads.Newest(mails[3]))
+	assert.Equal(t, time.Unix(500, 0), threads.Newest(mails[5]))
+}
+
+func TestBuildThreads_ReadError(t *testing.T) {
+
+	// ARRANGE
+	mails := []Mail{
+		{FullPath: "not_found", FolderName: "A", Time: time.Unix(100, 0)},
+	}
+
+	// ACT
+	threads := BuildThreads(&mails)
+
+	// ASSERT
+	// 読み込めなかったものは単独のスレッドとして
+	assert.Equal(t, 1, threads.MailCount(mails[0]))
+	assert.Equal(t, time.Unix(100, 0), threads.Newest(mails[0]))
+	assert.Error(t, threads.Err(mails[0]))
+}
+
+func TestCollector_ThreadAwareReadError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	archived := test.CreateMailFolder(t, temp, ".Archived")
+
+	targetMail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 30), 0)
+	test.CreateFile(t, targetMail, "Message-ID: <1@example.com>\r\n\r\nbody")
+
+	// 読み込めないメール (リンク先が無い)
+	brokenTargetMail := filepath.Join(inbox, "cur", filepath.Base(targetMail)+".broken")
+	require.NoError(t, os.Symlink(filepath.Join(temp, "not_found"), brokenTargetMail))
+	brokenOtherMail := filepath.Join(archived, "cur", filepath.Base(targetMail)+".broken")
+	require.NoError(t, os.Symlink(filepath.Join(temp, "not_found"), brokenOtherMail))
+
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:          10,
+		ExcludeFolderNames: []string{"Archived"},
+		ThreadAware:        true,
+		KeepGoing:          true,
+	})
+
+	// ACT
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []string{targetMail}, fullPaths(mails))
+
+	// 対象のメールのみエラーとして記録
+	require.Equal(t, 1, len(collector.Failures()))
+	assert.Equal(t, brokenTargetMail, collector.Failures()[0].Path)
+}
+
+func TestCollector_ThreadAwareReadErrorWithoutKeepGoing(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	archived := test.CreateMailFolder(t, temp, ".Archived")
+
+	targetMail, _ := test.CreateMailByTime(t, inbox, "cur", test.AgoDays(t, 30), 0)
+	test.CreateFile(t, targetMail, "Message-ID: <1@example.com>\r\n\r\nbody")
+
+	// 対象外のフォルダにある読み込めないメール
+	brokenOtherMail := filepath.Join(archived, "cur", filepath.Base(targetMail)+".broken")
+	require.NoError(t, os.Symlink(filepath.Join(temp, "not_found"), brokenOtherMail))
+
+	collector := NewConditionCollector(Condition{
+		AgeOfDays:          10,
+		ExcludeFolderNames: []string{"Archived"},
+		ThreadAware:        true,
+	})
+
+	// ACT
+	mails, err := collector.Collect(temp)
+
+	// ASSERT
+	// 対象外のメールは単独のスレッドとして扱い、中断しない
+	require.NoError(t, err)
+	assert.Equal(t, []string{targetMail}, fullPaths(mails))
+	assert.Empty(t, collector.Failures())
+}
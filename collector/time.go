@@ -1,11 +1,41 @@
 package collector
 
 import (
+	"fmt"
+	"io/fs"
+	"net/mail"
 	"strconv"
 	"strings"
 	"time"
 )
 
+type TimeSource string
+
+const (
+	TimeSourceFileName       TimeSource = "filename"
+	TimeSourceModTime        TimeSource = "mtime"
+	TimeSourceDateHeader     TimeSource = "date-header"
+	TimeSourceReceivedHeader TimeSource = "received-header"
+)
+
+func ParseTimeSources(value string) ([]TimeSource, error) {
+	// カンマ区切りで、先頭から順に日時が取れるまで試す
+	// 例: filename,mtime
+	timeSources := []TimeSource{}
+
+	for _, name := range strings.Split(value, ",") {
+		timeSource := TimeSource(strings.TrimSpace(name))
+		switch timeSource {
+		case TimeSourceFileName, TimeSourceModTime, TimeSourceDateHeader, TimeSourceReceivedHeader:
+			timeSources = append(timeSources, timeSource)
+		default:
+			return nil, fmt.Errorf("invalid time-source '%s'", name)
+		}
+	}
+
+	return timeSources, nil
+}
+
 func MailTime(fileName string) time.Time {
 	// ファイル名の先頭部分がUnix時間
 	// 例: 1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,S
@@ -18,3 +48,71 @@ func MailTime(fileName string) time.Time {
 
 	return time.Unix(unixtime, 0)
 }
+
+func MailTimeBySources(timeSources []TimeSource, fullPath string, info fs.FileInfo) (time.Time, error) {
+
+	// ヘッダは必要になった時に一度だけ読み込む
+	var header Header
+	readHeader := func() (Header, error) {
+		if header == nil {
+			h, err := ReadHeader(fullPath)
+			if err != nil {
+				return nil, err
+			}
+			header = h
+		}
+		return header, nil
+	}
+
+	for _, timeSource := range timeSources {
+
+		var mailTime time.Time
+
+		switch timeSource {
+		case TimeSourceFileName:
+			mailTime = MailTime(info.Name())
+		case TimeSourceModTime:
+			mailTime = time.Unix(info.ModTime().Unix(), 0)
+		case TimeSourceDateHeader:
+			header, err := readHeader()
+			if err != nil {
+				return time.Time{}, err
+			}
+			mailTime = headerTime(header.Get("Date"))
+		case TimeSourceReceivedHeader:
+			header, err := readHeader()
+			if err != nil {
+				return time.Time{}, err
+			}
+			mailTime = receivedTime(header.Get("Received"))
+		}
+
+		if mailTime.Unix() != 0 {
+			return mailTime, nil
+		}
+	}
+
+	// いずれからも取れなかった場合
+	return time.Unix(0, 0), nil
+}
+
+func receivedTime(received string) time.Time {
+	// 最後の";"以降が日時
+	// 例: from mx.example.com by mail.example.com; Wed, 25 Jan 2023 12:34:56 +0900
+	index := strings.LastIndex(received, ";")
+	if index == -1 {
+		return time.Unix(0, 0)
+	}
+
+	return headerTime(received[index+1:])
+}
+
+func headerTime(value string) time.Time {
+
+	parsedTime, err := mail.ParseDate(strings.TrimSpace(value))
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+
+	return time.Unix(parsedTime.Unix(), 0)
+}
@@ -1,9 +1,14 @@
 package collector
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/onozaty/maildir-cleaner/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMailTime(t *testing.T) {
@@ -41,3 +46,108 @@ func TestMailTime_NonTime(t *testing.T) {
 	// ASSERT
 	assert.Equal(t, int64(0), mailTime.Unix())
 }
+
+func TestParseTimeSources(t *testing.T) {
+
+	// ACT
+	timeSources, err := ParseTimeSources("filename, mtime,date-header,received-header")
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []TimeSource{TimeSourceFileName, TimeSourceModTime, TimeSourceDateHeader, TimeSourceReceivedHeader}, timeSources)
+}
+
+func TestParseTimeSources_Invalid(t *testing.T) {
+
+	// ACT
+	_, err := ParseTimeSources("filename,xxx")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid time-source 'xxx'")
+}
+
+func TestMailTimeBySources_FileName(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "1674617693.M958571P8888.localhost")
+	info := test.CreateFile(t, mailPath, "Date: Wed, 25 Jan 2023 12:34:56 +0900\n\nbody")
+
+	// ACT
+	mailTime, err := MailTimeBySources([]TimeSource{TimeSourceFileName, TimeSourceDateHeader}, mailPath, info)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, int64(1674617693), mailTime.Unix())
+}
+
+func TestMailTimeBySources_ModTime(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "abc")
+	test.CreateFile(t, mailPath, "body")
+
+	modTime := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, os.Chtimes(mailPath, modTime, modTime))
+	info, err := os.Stat(mailPath)
+	require.NoError(t, err)
+
+	// ACT
+	mailTime, err := MailTimeBySources([]TimeSource{TimeSourceFileName, TimeSourceModTime}, mailPath, info)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, modTime.Unix(), mailTime.Unix())
+}
+
+func TestMailTimeBySources_DateHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "abc")
+	info := test.CreateFile(t, mailPath, "Subject: a\r\nDate: Wed, 25 Jan 2023 12:34:56 +0900 (JST)\r\n\r\nbody")
+
+	// ACT
+	mailTime, err := MailTimeBySources([]TimeSource{TimeSourceFileName, TimeSourceDateHeader}, mailPath, info)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 25, 3, 34, 56, 0, time.UTC).Unix(), mailTime.Unix())
+}
+
+func TestMailTimeBySources_ReceivedHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "abc")
+	info := test.CreateFile(t, mailPath, "Received: from mx.example.com\n"+
+		" by mail.example.com; Wed, 25 Jan 2023 12:34:56 +0900\n"+
+		"Received: from localhost; Tue, 24 Jan 2023 12:34:56 +0900\n"+
+		"Date: Mon, 23 Jan 2023 12:34:56 +0900\n"+
+		"\n"+
+		"body")
+
+	// ACT
+	mailTime, err := MailTimeBySources([]TimeSource{TimeSourceReceivedHeader, TimeSourceDateHeader}, mailPath, info)
+
+	// ASSERT
+	require.NoError(t, err)
+	// 一番上(最後に受信したサーバ)のReceivedが使われること
+	assert.Equal(t, time.Date(2023, 1, 25, 3, 34, 56, 0, time.UTC).Unix(), mailTime.Unix())
+}
+
+func TestMailTimeBySources_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	mailPath := filepath.Join(temp, "abc")
+	info := test.CreateFile(t, mailPath, "Date: xxx\n\nbody")
+
+	// ACT
+	mailTime, err := MailTimeBySources([]TimeSource{TimeSourceFileName, TimeSourceDateHeader, TimeSourceReceivedHeader}, mailPath, info)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), mailTime.Unix())
+}
@@ -30,19 +30,22 @@ func EncodeMailFolderName(decodedName string) (string, error) {
 	return encodedName, nil
 }
 
+func MailFolderPath(rootMailFolderPath string, folderName string) (string, error) {
+
+	encodedFolderName, err := EncodeMailFolderName(folderName)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(rootMailFolderPath, "."+encodedFolderName), nil
+}
+
 func Setup(rootMailFolderPath string, folderName string) (string, error) {
 
 	// 親フォルダも含めて作成していく
-	currentFolderName := ""
 	lastFolderPath := ""
 
-	for i, partName := range strings.Split(folderName, ".") {
-
-		if i != 0 {
-			currentFolderName += "."
-		}
-
-		currentFolderName += partName
+	for _, currentFolderName := range withParentFolderNames(folderName) {
 
 		folderPath, err := setup(rootMailFolderPath, currentFolderName)
 		if err != nil {
@@ -55,6 +58,106 @@ func Setup(rootMailFolderPath string, folderName string) (string, error) {
 	return lastFolderPath, nil
 }
 
+func SetupRoot(rootMailFolderPath string) error {
+
+	// 親ディレクトリも含めて作成
+	if err := ensureDirAll(rootMailFolderPath); err != nil {
+		return err
+	}
+
+	// ルート自体もINBOXとしてメールフォルダに
+	for _, subName := range []string{"new", "cur", "tmp"} {
+		subDir := filepath.Join(rootMailFolderPath, subName)
+		if err := ensureDir(subDir); err != nil {
+			return err
+		}
+	}
+
+	subscriptionsPath := filepath.Join(rootMailFolderPath, "subscriptions")
+	if isNotExist(subscriptionsPath) {
+		file, err := os.OpenFile(subscriptionsPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return ChownInherited(subscriptionsPath)
+	}
+
+	return nil
+}
+
+func IsRoot(rootMailFolderPath string) bool {
+	// TODO: Dovecot 以外への対応
+	return !isNotExist(filepath.Join(rootMailFolderPath, "subscriptions"))
+}
+
+type SetupPlan struct {
+	CreateFolderNames    []string // 新たに作成されるフォルダ
+	SubscribeFolderNames []string // 新たに購読されるフォルダ
+}
+
+func PlanSetup(rootMailFolderPath string, folderName string) (*SetupPlan, error) {
+
+	// Setupした場合に何が行われるかを、実際には変更せずに返す
+	subscribedFolderNames, err := readSubscriptions(rootMailFolderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SetupPlan{
+		CreateFolderNames:    []string{},
+		SubscribeFolderNames: []string{},
+	}
+
+	for _, currentFolderName := range withParentFolderNames(folderName) {
+
+		encodedFolderName, err := EncodeMailFolderName(currentFolderName)
+		if err != nil {
+			return nil, err
+		}
+
+		if isNotExist(filepath.Join(rootMailFolderPath, "."+encodedFolderName)) {
+			plan.CreateFolderNames = append(plan.CreateFolderNames, currentFolderName)
+		}
+
+		if !subscribedFolderNames[encodedFolderName] {
+			plan.SubscribeFolderNames = append(plan.SubscribeFolderNames, currentFolderName)
+		}
+	}
+
+	return plan, nil
+}
+
+func PlanSetupInNewRoot(folderName string) *SetupPlan {
+
+	// ルートから作成する場合は、親フォルダも含めて全て作成・購読される
+	return &SetupPlan{
+		CreateFolderNames:    withParentFolderNames(folderName),
+		SubscribeFolderNames: withParentFolderNames(folderName),
+	}
+}
+
+func withParentFolderNames(folderName string) []string {
+
+	// "A.B.C" -> "A", "A.B", "A.B.C"
+	folderNames := []string{}
+	currentFolderName := ""
+
+	for i, partName := range strings.Split(folderName, ".") {
+
+		if i != 0 {
+			currentFolderName += "."
+		}
+
+		currentFolderName += partName
+		folderNames = append(folderNames, currentFolderName)
+	}
+
+	return folderNames
+}
+
 func setup(rootMailFolderPath string, folderName string) (string, error) {
 
 	encodedFolderName, err := EncodeMailFolderName(folderName)
@@ -127,6 +230,29 @@ func subscribe(rootMailFolderPath string, encodedFolderName string) error {
 	return nil
 }
 
+func readSubscriptions(rootMailFolderPath string) (map[string]bool, error) {
+
+	subscriptionsPath := filepath.Join(rootMailFolderPath, "subscriptions")
+	if isNotExist(subscriptionsPath) {
+		return nil, fmt.Errorf("subscriptions file not found: currently only dovecot is supported")
+	}
+
+	file, err := os.Open(subscriptionsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	subscribedFolderNames := map[string]bool{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		subscribedFolderNames[scanner.Text()] = true
+	}
+
+	return subscribedFolderNames, scanner.Err()
+}
+
 func ensureDir(dirPath string) error {
 	if isNotExist(dirPath) {
 		err := os.Mkdir(dirPath, 0777)
@@ -140,6 +266,20 @@ func ensureDir(dirPath string) error {
 	return nil
 }
 
+func ensureDirAll(dirPath string) error {
+	if isNotExist(dirPath) {
+		parentDirPath := filepath.Dir(dirPath)
+		if parentDirPath != dirPath {
+			if err := ensureDirAll(parentDirPath); err != nil {
+				return err
+			}
+		}
+		return ensureDir(dirPath)
+	}
+
+	return nil
+}
+
 func isNotExist(dirPath string) bool {
 	_, err := os.Stat(dirPath)
 	return os.IsNotExist(err)
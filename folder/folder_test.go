@@ -256,3 +256,103 @@ func TestSetup_RootDirNotFound(t *testing.T) {
 	expect := "mkdir " + filepath.Join(rootMailFolderPath, ".AA")
 	assert.Contains(t, err.Error(), expect)
 }
+
+func TestSetupRoot(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	rootMailFolderPath := filepath.Join(temp, "a", "b", "Maildir") // 親も含めて存在しないフォルダ
+
+	// ACT
+	err := SetupRoot(rootMailFolderPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.DirExists(t, filepath.Join(rootMailFolderPath, "cur"))
+	assert.DirExists(t, filepath.Join(rootMailFolderPath, "new"))
+	assert.DirExists(t, filepath.Join(rootMailFolderPath, "tmp"))
+	assert.Equal(t, "", test.ReadFile(t, filepath.Join(rootMailFolderPath, "subscriptions")))
+	assert.True(t, IsRoot(rootMailFolderPath))
+}
+
+func TestSetupRoot_AlreadyExists(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "A\n")
+	test.CreateMailFolder(t, temp, "")
+
+	// ACT
+	err := SetupRoot(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 既存のsubscriptionsは変更されないこと
+	assert.Equal(t, "A\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestIsRoot_SubscriptionsNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateMailFolder(t, temp, "")
+
+	// ACT
+	isRoot := IsRoot(temp)
+
+	// ASSERT
+	assert.False(t, isRoot)
+}
+
+func TestPlanSetupInNewRoot(t *testing.T) {
+
+	// ACT
+	plan := PlanSetupInNewRoot("X.Y.テスト")
+
+	// ASSERT
+	assert.Equal(t, []string{"X", "X.Y", "X.Y.テスト"}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"X", "X.Y", "X.Y.テスト"}, plan.SubscribeFolderNames)
+}
+
+func TestPlanSetup(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	subscriptionsPath := filepath.Join(temp, "subscriptions")
+	test.CreateFile(t, subscriptionsPath, "X\nX.Y\n")
+
+	// Xはフォルダ作成済み、X.Yは購読のみ
+	test.CreateMailFolder(t, temp, ".X")
+
+	// ACT
+	plan, err := PlanSetup(temp, "X.Y.テスト")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"X.Y", "X.Y.テスト"}, plan.CreateFolderNames)
+	assert.Equal(t, []string{"X.Y.テスト"}, plan.SubscribeFolderNames)
+
+	// 実際には作成されていないこと
+	assert.NoDirExists(t, filepath.Join(temp, ".X.Y"))
+	assert.Equal(t, "X\nX.Y\n", test.ReadFile(t, subscriptionsPath))
+}
+
+func TestPlanSetup_SubscriptionsNotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// subscriptions無し
+
+	// ACT
+	_, err := PlanSetup(temp, "AA")
+
+	// ASSERT
+	require.EqualError(t, err, "subscriptions file not found: currently only dovecot is supported")
+}
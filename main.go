@@ -1,6 +1,10 @@
 package main
 
-import "github.com/onozaty/maildir-cleaner/cmd"
+import (
+	_ "time/tzdata" // タイムゾーン情報が無い環境(Windowsなど)でも--timezoneを使えるように
+
+	"github.com/onozaty/maildir-cleaner/cmd"
+)
 
 func main() {
 	cmd.Execute()
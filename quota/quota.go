@@ -0,0 +1,206 @@
+package quota
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/folder"
+)
+
+// Maildir++ のクォータファイル
+const FileName = "maildirsize"
+
+// これより大きくなったら再計算して書き直す (Maildir++ の仕様)
+const maxFileSize = 5120
+
+type Usage struct {
+	LimitSize  int64 // 0の場合は無制限
+	LimitCount int64 // 0の場合は無制限
+	Size       int64
+	Count      int64
+}
+
+var sizeInFileNamePattern = regexp.MustCompile(`,S=(\d+)`)
+
+// クォータで数えるメールのサイズ
+func MailSize(mail collector.Mail) int64 {
+
+	// ファイル名にサイズ(S=)があれば、そちらを使う (Maildir++ の仕様)
+	// 例: 1674617693.M958571P8888.localhost.localdomain,S=545,W=562:2,S
+	//     -> 545
+	if match := sizeInFileNamePattern.FindStringSubmatch(mail.FileName); match != nil {
+		if size, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			return size
+		}
+	}
+
+	return mail.Size
+}
+
+// maildirsizeが無い場合はnil
+func Read(rootMailFolderPath string) (*Usage, error) {
+
+	file, err := os.Open(filepath.Join(rootMailFolderPath, FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	usage := &Usage{}
+
+	scanner := bufio.NewScanner(file)
+	if scanner.Scan() {
+		// 1行目はクォータの定義 (例: 1000000S,1000C)
+		usage.LimitSize, usage.LimitCount = parseDefinition(scanner.Text())
+	}
+
+	// 2行目以降はサイズと件数の増減 (途中まで書かれた行などは無視)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		size, err1 := strconv.ParseInt(fields[0], 10, 64)
+		count, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		usage.Size += size
+		usage.Count += count
+	}
+
+	return usage, scanner.Err()
+}
+
+func parseDefinition(definition string) (int64, int64) {
+
+	limitSize := int64(0)
+	limitCount := int64(0)
+
+	for _, part := range strings.Split(definition, ",") {
+		if len(part) < 2 {
+			continue
+		}
+
+		limit, err := strconv.ParseInt(part[:len(part)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch part[len(part)-1] {
+		case 'S':
+			limitSize = limit
+		case 'C':
+			limitCount = limit
+		}
+	}
+
+	return limitSize, limitCount
+}
+
+// 増減を追記 (maildirsizeが無い場合は何もしない)
+func Update(rootMailFolderPath string, size int64, count int64) error {
+
+	quotaPath := filepath.Join(rootMailFolderPath, FileName)
+
+	file, err := os.OpenFile(quotaPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// クォータが使われていない
+			return nil
+		}
+		return err
+	}
+
+	// 他のプロセスと混ざらないように1行を一度に書き込む
+	if _, err := file.WriteString(fmt.Sprintf("%d %d\n", size, count)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(quotaPath)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxFileSize {
+		// 大きくなりすぎたので実際のメールから数え直す
+		_, err := Recalculate(rootMailFolderPath)
+		return err
+	}
+
+	return nil
+}
+
+// 実際のメールから数え直して書き直す (maildirsizeが無い場合はnil)
+func Recalculate(rootMailFolderPath string) (*Usage, error) {
+
+	usage, err := Read(rootMailFolderPath)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+
+	mails, err := collector.CollectAll(rootMailFolderPath, []string{}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.Size = 0
+	usage.Count = 0
+	for _, mail := range *mails {
+		usage.Size += MailSize(mail)
+		usage.Count++
+	}
+
+	// 定義はそのままに、合計の1行に
+	quotaPath := filepath.Join(rootMailFolderPath, FileName)
+	definition, err := readDefinition(quotaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 読み込み途中のものが無いように、tmpに書き込んでから置き換え
+	tmpPath := filepath.Join(rootMailFolderPath, "tmp", fmt.Sprintf("%d.%d.%s", time.Now().Unix(), os.Getpid(), FileName))
+	content := fmt.Sprintf("%s\n%d %d\n", definition, usage.Size, usage.Count)
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+	if err := folder.ChownInherited(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, quotaPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+func readDefinition(quotaPath string) (string, error) {
+
+	file, err := os.Open(quotaPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+
+	return scanner.Text(), scanner.Err()
+}
@@ -0,0 +1,169 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onozaty/maildir-cleaner/collector"
+	"github.com/onozaty/maildir-cleaner/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailSize(t *testing.T) {
+
+	// ARRANGE, ACT, ASSERT
+	// ファイル名にサイズがあればそちら
+	assert.Equal(t, int64(545), MailSize(collector.Mail{FileName: "1674617693.M958571P8888.localhost,S=545,W=562:2,S", Size: 562}))
+	assert.Equal(t, int64(562), MailSize(collector.Mail{FileName: "1674617693.M958571P8888.localhost:2,S", Size: 562}))
+}
+
+func TestRead(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, FileName), "1000000S,1000C\n  1200   3\n-200 -1\n100 1\nbroken\n")
+
+	// ACT
+	usage, err := Read(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &Usage{
+		LimitSize:  1000000,
+		LimitCount: 1000,
+		Size:       1100,
+		Count:      3,
+	}, usage)
+}
+
+func TestRead_SizeOnly(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateFile(t, filepath.Join(temp, FileName), "5000S\n100 1\n")
+
+	// ACT
+	usage, err := Read(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &Usage{
+		LimitSize: 5000,
+		Size:      100,
+		Count:     1,
+	}, usage)
+}
+
+func TestRead_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	usage, err := Read(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Nil(t, usage)
+}
+
+func TestUpdate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	quotaPath := filepath.Join(temp, FileName)
+	test.CreateFile(t, quotaPath, "1000000S,1000C\n1200 3\n")
+
+	// ACT
+	err := Update(temp, -200, -1)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "1000000S,1000C\n1200 3\n-200 -1\n", test.ReadFile(t, quotaPath))
+}
+
+func TestUpdate_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// ACT
+	err := Update(temp, -200, -1)
+
+	// ASSERT
+	// クォータが使われていなければ作成しない
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(temp, FileName))
+}
+
+func TestUpdate_Recalculate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	test.CreateMailByName(t, inbox, "cur", "1.localhost,S=100:2,S", 10)
+	test.CreateMailByName(t, inbox, "new", "2.localhost", 20)
+	folderA := test.CreateMailFolder(t, temp, ".A")
+	test.CreateMailByName(t, folderA, "cur", "3.localhost", 30)
+
+	// 上限近くまで増減が書かれている
+	quotaPath := filepath.Join(temp, FileName)
+	test.CreateFile(t, quotaPath, "1000S\n"+strings.Repeat("1000 1\n", maxFileSize/7))
+
+	// ACT
+	err := Update(temp, -1000, -1)
+
+	// ASSERT
+	// 実際のメールから数え直して書き直される
+	require.NoError(t, err)
+	assert.Equal(t, "1000S\n150 3\n", test.ReadFile(t, quotaPath))
+
+	entries, err := os.ReadDir(filepath.Join(inbox, "tmp"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestRecalculate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inbox := test.CreateMailFolder(t, temp, "")
+	test.CreateMailByName(t, inbox, "cur", "1.localhost", 10)
+	test.CreateMailByName(t, inbox, "tmp", "2.localhost", 20) // 配送中のものは数えない
+
+	quotaPath := filepath.Join(temp, FileName)
+	test.CreateFile(t, quotaPath, "1000S,10C\n500 5\n")
+
+	// ACT
+	usage, err := Recalculate(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, &Usage{
+		LimitSize:  1000,
+		LimitCount: 10,
+		Size:       10,
+		Count:      1,
+	}, usage)
+	assert.Equal(t, "1000S,10C\n10 1\n", test.ReadFile(t, quotaPath))
+}
+
+func TestRecalculate_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	test.CreateMailFolder(t, temp, "")
+
+	// ACT
+	usage, err := Recalculate(temp)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Nil(t, usage)
+	assert.NoFileExists(t, filepath.Join(temp, FileName))
+}